@@ -1,12 +1,18 @@
 package main
 
 import (
+	"flag"
+
 	"github.com/joho/godotenv"
 	"github.com/suchimauz/walg-k8s-cron-backup/internal/app"
 )
 
 func main() {
-	app.Run(dotenv)
+	// Optional path to YAML or JSON config file, APP_CONFIG_FILE variable is used when empty
+	configFile := flag.String("config", "", "path to YAML or JSON config file")
+	flag.Parse()
+
+	app.Run(dotenv, *configFile)
 }
 
 func dotenv() {
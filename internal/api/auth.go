@@ -0,0 +1,223 @@
+package api
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// Tokens are read again after this interval, so rotated Secret is applied without restart
+const tokensReloadInterval = 30 * time.Second
+
+// Methods of authentication of callers
+const (
+	AuthMethodNone        = "none"        // Auth is disabled
+	AuthMethodToken       = "token"       // Bearer token
+	AuthMethodCertificate = "certificate" // Client certificate
+)
+
+// Errors of authentication
+var (
+	ErrUnauthenticated = errors.New("Valid bearer token or client certificate is required")
+	ErrNoRole          = errors.New("Role is not assigned to caller")
+)
+
+// Levels of roles, each role includes permissions of previous roles
+var roleLevels = map[string]int{
+	config.APIRoleViewer:   1,
+	config.APIRoleOperator: 2,
+	config.APIRoleAdmin:    3,
+}
+
+// Caller - authenticated caller of API
+type Caller struct {
+	Identity string
+	Role     string
+	Method   string
+}
+
+// Allowed checks, that role of caller includes role
+func (c *Caller) Allowed(role string) bool {
+	return roleLevels[c.Role] >= roleLevels[role]
+}
+
+// authenticator - authentication of callers by bearer tokens from files and client certificates
+type authenticator struct {
+	enabled bool
+	roles   map[string]string
+	tokens  *tokenStore
+}
+
+// Constructor, tokens are loaded at once, so invalid dir fails start
+func newAuthenticator(cfg *config.APIConfig) (*authenticator, error) {
+	auth := &authenticator{
+		enabled: cfg.AuthEnabled,
+		roles:   cfg.Roles,
+	}
+
+	if cfg.AuthEnabled && cfg.TokensDir != "" {
+		auth.tokens = &tokenStore{dir: cfg.TokensDir}
+		if err := auth.tokens.load(time.Now()); err != nil {
+			return nil, fmt.Errorf("Load tokens: %s", err.Error())
+		}
+	}
+
+	return auth, nil
+}
+
+// Private method for authenticate caller of request, client certificate is preferred over token
+// When role is not assigned to common name of certificate, caller is authenticated by token
+// Caller without role is returned with ErrNoRole, so its identity is audited
+func (a *authenticator) authenticate(r *http.Request) (*Caller, error) {
+	if !a.enabled {
+		return &Caller{Identity: "anonymous", Role: config.APIRoleAdmin, Method: AuthMethodNone}, nil
+	}
+
+	var callers []*Caller
+	// Certificates are verified by TLS handshake with client CA
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		callers = append(callers, &Caller{Identity: r.TLS.VerifiedChains[0][0].Subject.CommonName, Method: AuthMethodCertificate})
+	}
+	if token, ok := bearerToken(r); ok && a.tokens != nil {
+		if identity, ok := a.tokens.identity(token); ok {
+			callers = append(callers, &Caller{Identity: identity, Method: AuthMethodToken})
+		}
+	}
+	if len(callers) == 0 {
+		return nil, ErrUnauthenticated
+	}
+
+	for _, caller := range callers {
+		if role, ok := a.roles[caller.Identity]; ok {
+			caller.Role = role
+
+			return caller, nil
+		}
+	}
+
+	return callers[0], ErrNoRole
+}
+
+// tokenStore - bearer tokens from files of mounted Secret by names of callers
+type tokenStore struct {
+	dir string
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	// Names of callers by tokens
+	tokens map[string]string
+}
+
+// Private method for find caller by token, tokens are reloaded after interval
+// On reload error previous tokens are used
+func (ts *tokenStore) identity(token string) (string, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if now := time.Now(); now.Sub(ts.loadedAt) > tokensReloadInterval {
+		if err := ts.load(now); err != nil {
+			klog.Errorf("[API] Reload tokens from %s: %s", ts.dir, err.Error())
+		}
+	}
+
+	// All tokens are compared, so time of reply does not depend on matched token
+	identity, found := "", false
+	for known, name := range ts.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			identity, found = name, true
+		}
+	}
+
+	return identity, found
+}
+
+// Private method for read tokens from files of dir
+// Hidden entries are skipped, Kubernetes keeps versions of mounted Secret in ..data directories
+func (ts *tokenStore) load(now time.Time) error {
+	entries, err := os.ReadDir(ts.dir)
+	if err != nil {
+		return err
+	}
+
+	tokens := make(map[string]string)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(ts.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			continue
+		}
+		tokens[token] = entry.Name()
+	}
+
+	ts.tokens = tokens
+	ts.loadedAt = now
+
+	return nil
+}
+
+// Help func for read bearer token from Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+// Help func for role, which is required for manual run of job
+// Runs, which change or restore backups, require admin
+func jobRole(jobKind string) string {
+	switch jobKind {
+	case job.JobBackup, job.JobInfo, job.JobWalVerify:
+		return config.APIRoleOperator
+	}
+
+	return config.APIRoleAdmin
+}
+
+// Help func for TLS config of server, client certificates are verified by CA, when it is set
+// Certificates are optional, so callers with tokens are accepted too
+func newTLSConfig(cfg *config.APIConfig) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ClientCAFile != "" {
+		content, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Client CA: %s", err.Error())
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("Client CA: no certificates in %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// Prefix of all endpoints
+const pathPrefix = "/api/v1/"
+
+// Timeout of search of run in history store
+const getRunTimeout = 10 * time.Second
+
+// Scheduler - scheduled jobs of targets, it is implemented by job.Registry
+type Scheduler interface {
+	Entries() []*job.ScheduledEntry
+	Trigger(target string, jobKind string) (uuid.UUID, <-chan error, error)
+	FetchBackups(ctx context.Context, target string) ([]*job.BackupInfo, error)
+}
+
+// Runs - finished runs of jobs, it is implemented by history.History
+type Runs interface {
+	Get(ctx context.Context, id uuid.UUID) (*job.Run, error)
+	List(target string, jobKind string, limit int) []*job.Run
+}
+
+// Server - HTTP API for manual runs of jobs, list of scheduled entries and backups
+type Server struct {
+	scheduler Scheduler
+	runs      Runs
+	backups   *job.LatestBackupsInfo
+	// Reports, that this replica schedules jobs
+	scheduling func() bool
+	tracker    *tracker
+	auth       *authenticator
+
+	server      *http.Server
+	tlsCertFile string
+	tlsKeyFile  string
+}
+
+// handlerFunc - handler of request of authenticated caller
+type handlerFunc func(w http.ResponseWriter, r *http.Request, caller *Caller)
+
+// Constructor, tokens and client CA are loaded at once
+func NewServer(cfg *config.APIConfig, scheduler Scheduler, runs Runs, backups *job.LatestBackupsInfo, scheduling func() bool) (*Server, error) {
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		scheduler:   scheduler,
+		runs:        runs,
+		backups:     backups,
+		scheduling:  scheduling,
+		tracker:     newTracker(),
+		auth:        auth,
+		tlsCertFile: cfg.TLSCertFile,
+		tlsKeyFile:  cfg.TLSKeyFile,
+	}
+	s.server = &http.Server{
+		Addr:              cfg.Address,
+		Handler:           s.Handler(),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s, nil
+}
+
+// Handler of all endpoints, each request is authenticated and audited
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pathPrefix+"entries", s.handle(s.handleEntries))
+	mux.HandleFunc(pathPrefix+"targets/", s.handle(s.handleTargets))
+	mux.HandleFunc(pathPrefix+"runs", s.handle(s.handleListRuns))
+	mux.HandleFunc(pathPrefix+"runs/", s.handle(s.handleGetRun))
+
+	return mux
+}
+
+// Serve requests until Shutdown, http.ErrServerClosed is not returned
+// HTTPS is served, when certificate is set
+func (s *Server) ListenAndServe() error {
+	var err error
+	if s.tlsCertFile != "" {
+		klog.Infof("[API] Listen %s over HTTPS", s.server.Addr)
+		err = s.server.ListenAndServeTLS(s.tlsCertFile, s.tlsKeyFile)
+	} else {
+		klog.Infof("[API] Listen %s", s.server.Addr)
+		err = s.server.ListenAndServe()
+	}
+
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Stop accepting requests and wait active requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// GET /api/v1/entries - scheduled jobs of all targets with next and previous fire time
+func (s *Server) handleEntries(w http.ResponseWriter, r *http.Request, caller *Caller) {
+	if !allowMethod(w, r, http.MethodGet) || !authorize(w, caller, config.APIRoleViewer) {
+		return
+	}
+
+	entries := s.scheduler.Entries()
+	if entries == nil {
+		entries = []*job.ScheduledEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"scheduling": s.scheduling == nil || s.scheduling(),
+		"entries":    entries,
+	})
+}
+
+// Endpoints of target: backups and manual runs
+func (s *Server) handleTargets(w http.ResponseWriter, r *http.Request, caller *Caller) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, pathPrefix), "/")
+	switch {
+	case len(parts) == 3 && parts[1] != "" && parts[2] == "backups":
+		s.handleBackups(w, r, caller, parts[1])
+	case len(parts) == 5 && parts[1] != "" && parts[2] == "jobs" && parts[3] != "" && parts[4] == "runs":
+		s.handleTrigger(w, r, caller, parts[1], parts[3])
+	default:
+		writeError(w, http.StatusNotFound, "Endpoint is not found")
+	}
+}
+
+// GET /api/v1/targets/{target}/backups - backups of target from last info run or by info command, when it is missing
+func (s *Server) handleBackups(w http.ResponseWriter, r *http.Request, caller *Caller, target string) {
+	if !allowMethod(w, r, http.MethodGet) || !authorize(w, caller, config.APIRoleViewer) {
+		return
+	}
+
+	if s.backups != nil {
+		if info := s.backups.Get(target); info != nil {
+			writeJSON(w, http.StatusOK, info)
+
+			return
+		}
+	}
+
+	backups, err := s.scheduler.FetchBackups(r.Context(), target)
+	switch {
+	case errors.Is(err, job.ErrTargetNotFound), errors.Is(err, job.ErrJobNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+
+		return
+	case err != nil:
+		klog.Errorf("[API] %s: Fetch backups: %s", target, err.Error())
+		writeError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+	if backups == nil {
+		backups = []*job.BackupInfo{}
+	}
+
+	writeJSON(w, http.StatusOK, &job.TargetBackupsInfo{Target: target, Backups: backups, UpdatedAt: time.Now()})
+}
+
+// POST /api/v1/targets/{target}/jobs/{job}/runs - trigger manual run of job of target
+func (s *Server) handleTrigger(w http.ResponseWriter, r *http.Request, caller *Caller, target string, jobKind string) {
+	if !allowMethod(w, r, http.MethodPost) || !authorize(w, caller, jobRole(jobKind)) {
+		return
+	}
+
+	id, done, err := s.scheduler.Trigger(target, jobKind)
+	switch {
+	case errors.Is(err, job.ErrTargetNotFound), errors.Is(err, job.ErrJobNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+
+		return
+	case errors.Is(err, job.ErrRunning):
+		writeError(w, http.StatusConflict, err.Error())
+
+		return
+	case errors.Is(err, job.ErrNotScheduling):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	klog.Infof("[API] %s: Manual run %s of %s job is accepted from %s", target, id, jobKind, caller.Identity)
+
+	run := s.tracker.track(id, target, jobKind, done)
+
+	w.Header().Set("Location", pathPrefix+"runs/"+id.String())
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// GET /api/v1/runs?target=&job=&limit= - finished runs from history, newest first
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request, caller *Caller) {
+	if !allowMethod(w, r, http.MethodGet) || !authorize(w, caller, config.APIRoleViewer) {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "Limit must be non-negative integer")
+
+			return
+		}
+	}
+
+	runs := s.runs.List(query.Get("target"), query.Get("job"), limit)
+	if runs == nil {
+		runs = []*job.Run{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"runs": runs})
+}
+
+// GET /api/v1/runs/{id} - run from history or status of manual run, which is not finished
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request, caller *Caller) {
+	if !allowMethod(w, r, http.MethodGet) || !authorize(w, caller, config.APIRoleViewer) {
+		return
+	}
+
+	id, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, pathPrefix+"runs/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Run id must be UUID")
+
+		return
+	}
+
+	// Pending run is not in history yet, so store is not loaded on each poll
+	tracked := s.tracker.get(id)
+	if tracked != nil && tracked.Status == RunPending {
+		writeJSON(w, http.StatusOK, tracked)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), getRunTimeout)
+	defer cancel()
+
+	run, err := s.runs.Get(ctx, id)
+	if err != nil {
+		klog.Errorf("[API] Get run %s: %s", id, err.Error())
+		writeError(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	switch {
+	case run != nil:
+		writeJSON(w, http.StatusOK, run)
+	case tracked != nil:
+		writeJSON(w, http.StatusOK, tracked)
+	default:
+		writeError(w, http.StatusNotFound, "Run is not found")
+	}
+}
+
+// Private method for authenticate caller and audit request with its identity and status of reply
+// Handler authorizes caller by role, which is required for request
+func (s *Server) handle(handler handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		caller, err := s.auth.authenticate(r)
+		switch {
+		case errors.Is(err, ErrUnauthenticated):
+			rec.Header().Set("WWW-Authenticate", `Bearer realm="walg-k8s-cron-backup"`)
+			writeError(rec, http.StatusUnauthorized, err.Error())
+		case err != nil:
+			writeError(rec, http.StatusForbidden, err.Error())
+		default:
+			handler(rec, r, caller)
+		}
+
+		audit(r, caller, rec.status)
+	}
+}
+
+// statusRecorder - response writer, which keeps status of reply for audit
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// Required method for http.ResponseWriter interface
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Help func for write audit record of request, caller is nil, when it is not authenticated
+func audit(r *http.Request, caller *Caller, status int) {
+	identity, role, method := "unknown", "-", "-"
+	if caller != nil {
+		identity, method = caller.Identity, caller.Method
+		if caller.Role != "" {
+			role = caller.Role
+		}
+	}
+
+	klog.Infof("[API] Audit: %s %s by %s (auth %s, role %s) from %s: %d",
+		r.Method, r.URL.RequestURI(), identity, method, role, r.RemoteAddr, status)
+}
+
+// Help func for reply 403, when role of caller does not include role
+func authorize(w http.ResponseWriter, caller *Caller, role string) bool {
+	if caller.Allowed(role) {
+		return true
+	}
+
+	writeError(w, http.StatusForbidden, fmt.Sprintf("Role %s is required, caller has role %s", role, caller.Role))
+
+	return false
+}
+
+// Help func for reply 405, when method of request is not allowed
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "Method is not allowed")
+
+	return false
+}
+
+// Help func for reply error as JSON object
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Help func for reply JSON body
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		klog.Errorf("[API] Write response: %s", err.Error())
+	}
+}
@@ -0,0 +1,435 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+)
+
+// fakeScheduler - one target main with backup job, run is finished, when done is closed
+type fakeScheduler struct {
+	err  error
+	runs *fakeRuns
+	done chan struct{}
+}
+
+func (fs *fakeScheduler) Entries() []*job.ScheduledEntry {
+	next := time.Date(2024, 1, 10, 21, 0, 0, 0, time.UTC)
+
+	return []*job.ScheduledEntry{{Target: "main", Job: job.JobBackup, Next: &next}}
+}
+
+func (fs *fakeScheduler) Trigger(target string, jobKind string) (uuid.UUID, <-chan error, error) {
+	if fs.err != nil {
+		return uuid.Nil, nil, fs.err
+	}
+	if target != "main" {
+		return uuid.Nil, nil, job.ErrTargetNotFound
+	}
+	if jobKind != job.JobBackup {
+		return uuid.Nil, nil, job.ErrJobNotFound
+	}
+
+	id := uuid.New()
+	result := make(chan error, 1)
+	go func() {
+		<-fs.done
+		fs.runs.add(&job.Run{Id: id, Target: target, Job: jobKind, Trigger: job.TriggerManual, Status: job.RunSucceeded})
+		result <- nil
+	}()
+
+	return id, result, nil
+}
+
+func (fs *fakeScheduler) FetchBackups(ctx context.Context, target string) ([]*job.BackupInfo, error) {
+	if target != "main" {
+		return nil, job.ErrTargetNotFound
+	}
+
+	return []*job.BackupInfo{{BackupName: "base_000000010000000000000003"}}, nil
+}
+
+type fakeRuns struct {
+	runs chan *job.Run
+}
+
+func (fr *fakeRuns) add(run *job.Run) {
+	fr.runs <- run
+}
+
+func (fr *fakeRuns) Get(ctx context.Context, id uuid.UUID) (*job.Run, error) {
+	select {
+	case run := <-fr.runs:
+		fr.runs <- run
+		if run.Id == id {
+			return run, nil
+		}
+	default:
+	}
+
+	return nil, nil
+}
+
+func (fr *fakeRuns) List(target string, jobKind string, limit int) []*job.Run {
+	return nil
+}
+
+func TestServerTrigger(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		path       string
+		method     string
+		wantStatus int
+	}{
+		{
+			name:       "test run is accepted",
+			path:       "/api/v1/targets/main/jobs/backup/runs",
+			method:     http.MethodPost,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "test unknown target",
+			path:       "/api/v1/targets/analytics/jobs/backup/runs",
+			method:     http.MethodPost,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "test unscheduled job",
+			path:       "/api/v1/targets/main/jobs/verify/runs",
+			method:     http.MethodPost,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "test previous run is running",
+			err:        job.ErrRunning,
+			path:       "/api/v1/targets/main/jobs/backup/runs",
+			method:     http.MethodPost,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "test replica is not leader",
+			err:        job.ErrNotScheduling,
+			path:       "/api/v1/targets/main/jobs/backup/runs",
+			method:     http.MethodPost,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "test method is not allowed",
+			path:       "/api/v1/targets/main/jobs/backup/runs",
+			method:     http.MethodGet,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := &fakeRuns{runs: make(chan *job.Run, 1)}
+			scheduler := &fakeScheduler{err: tt.err, runs: runs, done: make(chan struct{})}
+			defer close(scheduler.done)
+
+			server, err := NewServer(&config.APIConfig{Address: ":0"}, scheduler, runs, nil, nil)
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestServerPollRun(t *testing.T) {
+	runs := &fakeRuns{runs: make(chan *job.Run, 1)}
+	scheduler := &fakeScheduler{runs: runs, done: make(chan struct{})}
+	server, err := NewServer(&config.APIConfig{Address: ":0"}, scheduler, runs, nil, nil)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	handler := server.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/targets/main/jobs/backup/runs", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("trigger status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, "/api/v1/runs/") {
+		t.Fatalf("Location = %q, want /api/v1/runs/{id}", location)
+	}
+
+	poll := func() string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, location, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("poll status = %d, want %d", rec.Code, http.StatusOK)
+		}
+
+		var body struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+
+		return body.Status
+	}
+
+	// Run is pending, until job is finished
+	if got := poll(); got != RunPending {
+		t.Errorf("status of run = %q, want %q", got, RunPending)
+	}
+
+	close(scheduler.done)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := poll()
+		if got == job.RunSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status of run = %q, want %q", got, job.RunSucceeded)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Unknown run
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/runs/"+uuid.New().String(), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status of unknown run = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestServerBackups(t *testing.T) {
+	backups := job.NewLatestBackupsInfo()
+	backups.Update("main", []*job.BackupInfo{{BackupName: "base_000000010000000000000002"}}, time.Now())
+
+	tests := []struct {
+		name       string
+		backups    *job.LatestBackupsInfo
+		path       string
+		wantStatus int
+		wantBackup string
+	}{
+		{
+			name:       "test backups from last info run",
+			backups:    backups,
+			path:       "/api/v1/targets/main/backups",
+			wantStatus: http.StatusOK,
+			wantBackup: "base_000000010000000000000002",
+		},
+		{
+			name:       "test backups by info command, when info run is missing",
+			backups:    job.NewLatestBackupsInfo(),
+			path:       "/api/v1/targets/main/backups",
+			wantStatus: http.StatusOK,
+			wantBackup: "base_000000010000000000000003",
+		},
+		{
+			name:       "test backups of unknown target",
+			backups:    backups,
+			path:       "/api/v1/targets/analytics/backups",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := &fakeRuns{runs: make(chan *job.Run, 1)}
+			scheduler := &fakeScheduler{runs: runs, done: make(chan struct{})}
+
+			server, err := NewServer(&config.APIConfig{Address: ":0"}, scheduler, runs, tt.backups, nil)
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantBackup == "" {
+				return
+			}
+
+			var info job.TargetBackupsInfo
+			if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if len(info.Backups) != 1 || info.Backups[0].BackupName != tt.wantBackup {
+				t.Errorf("backups = %+v, want %s", info.Backups, tt.wantBackup)
+			}
+		})
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	dir := t.TempDir()
+	tokens := map[string]string{"grafana": "viewer-token", "ci": "operator-token", "dba": "admin-token\n", "intruder": "other-token"}
+	for name, token := range tokens {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(token), 0600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	cfg := &config.APIConfig{
+		Address:     ":0",
+		AuthEnabled: true,
+		TokensDir:   dir,
+		Roles: map[string]string{
+			"grafana": config.APIRoleViewer,
+			"ci":      config.APIRoleOperator,
+			"dba":     config.APIRoleAdmin,
+		},
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		// Common name of verified client certificate
+		commonName string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{
+			name:       "test request without token",
+			method:     http.MethodGet,
+			path:       "/api/v1/entries",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "test request with unknown token",
+			token:      "guess",
+			method:     http.MethodGet,
+			path:       "/api/v1/entries",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "test caller without role",
+			token:      "other-token",
+			method:     http.MethodGet,
+			path:       "/api/v1/entries",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "test viewer lists entries",
+			token:      "viewer-token",
+			method:     http.MethodGet,
+			path:       "/api/v1/entries",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "test viewer lists backups",
+			token:      "viewer-token",
+			method:     http.MethodGet,
+			path:       "/api/v1/targets/main/backups",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "test caller without role does not list backups",
+			token:      "other-token",
+			method:     http.MethodGet,
+			path:       "/api/v1/targets/main/backups",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "test viewer does not trigger backup",
+			token:      "viewer-token",
+			method:     http.MethodPost,
+			path:       "/api/v1/targets/main/jobs/backup/runs",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "test operator triggers backup",
+			token:      "operator-token",
+			method:     http.MethodPost,
+			path:       "/api/v1/targets/main/jobs/backup/runs",
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "test operator does not trigger retention",
+			token:      "operator-token",
+			method:     http.MethodPost,
+			path:       "/api/v1/targets/main/jobs/retention/runs",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "test certificate with role",
+			commonName: "dba",
+			method:     http.MethodPost,
+			path:       "/api/v1/targets/main/jobs/retention/runs",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "test certificate without role falls back to token",
+			commonName: "ingress",
+			token:      "operator-token",
+			method:     http.MethodPost,
+			path:       "/api/v1/targets/main/jobs/backup/runs",
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "test certificate without role and without token",
+			commonName: "ingress",
+			method:     http.MethodGet,
+			path:       "/api/v1/entries",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "test admin passes role check of retention, which is not scheduled",
+			token:      "admin-token",
+			method:     http.MethodPost,
+			path:       "/api/v1/targets/main/jobs/retention/runs",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := &fakeRuns{runs: make(chan *job.Run, 1)}
+			scheduler := &fakeScheduler{runs: runs, done: make(chan struct{})}
+			defer close(scheduler.done)
+
+			server, err := NewServer(cfg, scheduler, runs, nil, nil)
+			if err != nil {
+				t.Fatalf("NewServer() error = %v", err)
+			}
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.commonName != "" {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{
+					{{Subject: pkix.Name{CommonName: tt.commonName}}},
+				}}
+			}
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+)
+
+// Statuses of manual runs, which are not in history
+const (
+	RunPending = "pending" // Run is waiting previous run or is running
+	RunSkipped = "skipped" // Previous run is still running, run is skipped by overlap policy
+	RunDropped = "dropped" // Scheduling is stopped, while run was waiting, or run is not saved to history
+)
+
+// Time for keep finished manual runs in tracker, after it they are searched only in history
+const trackerTTL = time.Hour
+
+// ManualRun - manual run, which is accepted by API, until it is found in history
+type ManualRun struct {
+	Id         uuid.UUID `json:"id"`
+	Target     string    `json:"target"`
+	Job        string    `json:"job"`
+	Trigger    string    `json:"trigger"`
+	AcceptedAt time.Time `json:"accepted_at"`
+	Status     string    `json:"status"`
+	Message    string    `json:"message,omitempty"`
+
+	finished   bool
+	finishedAt time.Time
+}
+
+// tracker - manual runs of this replica, which are accepted and not finished yet or finished recently
+type tracker struct {
+	mu   sync.Mutex
+	runs map[uuid.UUID]*ManualRun
+}
+
+// Constructor
+func newTracker() *tracker {
+	return &tracker{runs: make(map[uuid.UUID]*ManualRun)}
+}
+
+// Private method for track accepted run until result is received from done channel
+func (t *tracker) track(id uuid.UUID, target string, jobKind string, done <-chan error) *ManualRun {
+	run := &ManualRun{
+		Id:         id,
+		Target:     target,
+		Job:        jobKind,
+		Trigger:    job.TriggerManual,
+		AcceptedAt: time.Now(),
+		Status:     RunPending,
+	}
+
+	t.mu.Lock()
+	t.prune(time.Now())
+	t.runs[id] = run
+	record := *run
+	t.mu.Unlock()
+
+	go func() {
+		err := <-done
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		run.finished = true
+		run.finishedAt = time.Now()
+		switch {
+		case err == nil:
+			// Finished run is in history, run is dropped, when it is not found there
+			run.Status = RunDropped
+			run.Message = "Run is not found in history, scheduling was stopped before start of run"
+		case errors.Is(err, job.ErrRunning):
+			run.Status = RunSkipped
+			run.Message = err.Error()
+		default:
+			run.Status = RunDropped
+			run.Message = err.Error()
+		}
+	}()
+
+	return &record
+}
+
+// Private method for get copy of tracked run, nil when it is not tracked
+func (t *tracker) get(id uuid.UUID) *ManualRun {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	run, ok := t.runs[id]
+	if !ok {
+		return nil
+	}
+	record := *run
+
+	return &record
+}
+
+// Private method for remove runs, which are finished longer than ttl ago
+func (t *tracker) prune(now time.Time) {
+	for id, run := range t.runs {
+		if run.finished && now.Sub(run.finishedAt) > trackerTTL {
+			delete(t.runs, id)
+		}
+	}
+}
@@ -1,59 +1,56 @@
 package app
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
 	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
 	"github.com/suchimauz/walg-k8s-cron-backup/pkg/storage"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	cr "github.com/robfig/cron/v3"
+	capi "github.com/suchimauz/walg-k8s-cron-backup/internal/api"
+	cbot "github.com/suchimauz/walg-k8s-cron-backup/internal/bot"
+	ctrl "github.com/suchimauz/walg-k8s-cron-backup/internal/controller"
+	chistory "github.com/suchimauz/walg-k8s-cron-backup/internal/history"
 	cjobs "github.com/suchimauz/walg-k8s-cron-backup/internal/job"
 	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
 )
 
-func Run(dotenv func()) {
+func Run(dotenv func(), configFile string) {
 	// Initialize config
-	cfg, err := config.Init(dotenv)
+	cfg, err := config.Init(dotenv, configFile)
 	if err != nil {
 		klog.Errorf("[ENV] %s", err.Error())
 
 		return
 	}
 
-	// Initialize Kubernetes tls config for set insecure: true of false from config
-	tlsClientConfig := &rest.TLSClientConfig{Insecure: cfg.Kubernetes.Insecure}
-
-	// Initialize Kubernetes BearerToken config
-	kubeConfig := &rest.Config{
-		Host:            cfg.Kubernetes.Host,
-		APIPath:         cfg.Kubernetes.ApiVersion,
-		BearerToken:     cfg.Kubernetes.BearerToken,
-		TLSClientConfig: *tlsClientConfig,
-	}
-
-	// Create new kubernetes client from kubeConfig
-	clientset, err := kubernetes.NewForConfig(kubeConfig)
+	// Initialize Kubernetes config by auth mode from config
+	kubeConfig, err := newKubeConfig(cfg)
 	if err != nil {
 		klog.Errorf("[KubeConfig] %s", err.Error())
 
 		return
 	}
 
-	// Create new local KubeJob pkg object
-	kjob, err := kube.NewKubeJob(clientset, kubeConfig, cfg.Kubernetes.Namespace,
-		cfg.Kubernetes.LabelSelector, cfg.Kubernetes.ContainerName)
+	// Create new kubernetes client from kubeConfig
+	clientset, err := kubernetes.NewForConfig(kubeConfig)
 	if err != nil {
-		klog.Errorf("[KubeJob] %s", err.Error())
+		klog.Errorf("[KubeConfig] %s", err.Error())
 
 		return
 	}
@@ -76,7 +73,7 @@ func Run(dotenv func()) {
 		tgclient.Transport = transport
 	}
 
-	if cfg.Telegram.NotificationsEnabled() {
+	if cfg.NotificationsEnabled() || cfg.Telegram.Commands.Enabled {
 		tgbot, err = tgbotapi.NewBotAPIWithClient(cfg.Telegram.BotToken, cfg.Telegram.ApiEndpoint, tgclient)
 		if err != nil {
 			klog.Errorf("[TelegramBotApi] %s", err.Error())
@@ -98,19 +95,175 @@ func Run(dotenv func()) {
 
 	// Make new cron object, calls constructor
 	cron := cr.New(cr.WithSeconds(), cr.WithLocation(config.TimeZone))
+	// Context of all jobs, it is cancelled on shutdown after grace period
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cron is started and stopped by leadership, overlap of runs is checked by guards of jobs
+	sched := &scheduler{cron: cron, ctx: ctx}
+
+	// Recorder of Kubernetes events about jobs, nil when events are disabled
+	var events *kube.EventRecorder
+	if cfg.Kubernetes.EventsEnabled {
+		events = kube.NewEventRecorder(clientset, cfg.Kubernetes.EventsObject == config.EventsObjectOwner)
+		// Failures before pod selection are recorded on pod of service
+		events.Fallback = kube.SelfReference(ctx, clientset)
+		defer events.Shutdown()
+	}
+
+	deps := &cjobs.Dependencies{
+		Client:         clientset,
+		KubeConfig:     kubeConfig,
+		TelegramBotApi: tgbot,
+		Storage:        storageProvider,
+		Events:         events,
+		Scheduling:     sched.scheduling,
+		RunContext:     sched.runContext,
+	}
 
-	// Insert jobs to cron
-	jobIds, err := cjobs.InsertJobs(cron, cfg, kjob, tgbot, storageProvider)
+	// Latest backups info of targets for SLA on failed info runs, /backups command and backups endpoint of API
+	deps.BackupsInfo = cjobs.NewLatestBackupsInfo()
+
+	// History of finished runs, saved runs are loaded before jobs are scheduled
+	historyStore, err := chistory.NewStore(&cfg.History, clientset)
 	if err != nil {
+		klog.Errorf("[History] %s", err.Error())
+
+		return
+	}
+	history := chistory.NewHistory(historyStore, &cfg.History)
+	if err := loadHistory(ctx, history); err != nil {
+		klog.Errorf("[History] Load: %s", err.Error())
+
+		return
+	}
+	deps.Observers = append(deps.Observers, history)
+	deps.History = history
+
+	// Informers of pods of targets, they are stopped with jobs context
+	if cfg.Kubernetes.PodCacheEnabled {
+		deps.Pods = kube.NewPodCache(ctx, clientset)
+	}
+
+	registry := cjobs.NewRegistry(ctx, cron, cfg, deps)
+	// Runs out of cron are waited on loss of leadership too
+	sched.wait = registry.Wait
+
+	// Runs, which were missed while service was down or was not leader, are caught up on start of scheduling
+	// History is loaded again, because previous leader could save runs after start of this replica
+	sched.onStart = func() {
+		if err := loadHistory(ctx, history); err != nil {
+			klog.Errorf("[History] Load: %s, missed runs are not caught up", err.Error())
+
+			return
+		}
+
+		registry.CatchUp()
+	}
+
+	// Controller of BackupSchedule resources, it writes results of runs to status
+	var controller *ctrl.Controller
+	if cfg.Controller.Enabled {
+		dynamicClient, err := dynamic.NewForConfig(kubeConfig)
+		if err != nil {
+			klog.Errorf("[KubeConfig] %s", err.Error())
+
+			return
+		}
+
+		controller = ctrl.NewController(cfg, dynamicClient, registry)
+		deps.Observers = append(deps.Observers, controller)
+	}
+
+	// Insert jobs of targets from config to cron
+	if err := registry.Sync(cjobs.SourceConfig, cfg.Targets); err != nil {
 		klog.Errorf("[Cron] Error inserting jobs: %s", err.Error())
 
 		return
 	}
 
-	// Start the cron scheduler in its own goroutine
-	cron.Start()
+	// Context of discovery, controller and bot commands, it is cancelled on shutdown
+	// Targets are synced to cron on all replicas, only leader runs them
+	syncCtx, syncCancel := context.WithCancel(context.Background())
+	defer syncCancel()
+	var syncWg sync.WaitGroup
+
+	if cfg.Discovery.Enabled {
+		syncWg.Add(1)
+		go func() {
+			defer syncWg.Done()
+
+			cjobs.RunDiscovery(syncCtx, cfg, registry)
+		}()
+	}
+	if controller != nil {
+		syncWg.Add(1)
+		go func() {
+			defer syncWg.Done()
+
+			controller.Run(syncCtx)
+		}()
+	}
+
+	// Commands of Telegram bot, they are handled only by replica, which schedules jobs
+	if cfg.Telegram.Commands.Enabled {
+		bot := cbot.NewBot(tgbot, &cfg.Telegram.Commands, registry, history, deps.BackupsInfo, sched.scheduling)
 
-	klog.Infof("[Cron] Started! JobIds %v", jobIds)
+		syncWg.Add(1)
+		go func() {
+			defer syncWg.Done()
+
+			if err := bot.Run(syncCtx); err != nil {
+				klog.Errorf("[TelegramBot] %s", err.Error())
+			}
+		}()
+	}
+
+	// HTTP API for manual runs, runs are accepted only while this replica schedules jobs
+	var apiServer *capi.Server
+	if cfg.API.Enabled {
+		apiServer, err = capi.NewServer(&cfg.API, registry, history, deps.BackupsInfo, sched.scheduling)
+		if err != nil {
+			klog.Errorf("[API] %s", err.Error())
+
+			return
+		}
+		go func() {
+			if err := apiServer.ListenAndServe(); err != nil {
+				klog.Errorf("[API] %s", err.Error())
+			}
+		}()
+	}
+
+	// Context of leader election, on cancel lease is released
+	leCtx, leCancel := context.WithCancel(context.Background())
+	defer leCancel()
+	leDone := make(chan struct{})
+
+	if cfg.LeaderElection.Enabled {
+		elector, err := newLeaderElector(&cfg.LeaderElection, clientset, sched)
+		if err != nil {
+			klog.Errorf("[LeaderElection] %s", err.Error())
+
+			return
+		}
+
+		// Start the cron scheduler, when this replica becomes leader
+		go func() {
+			defer close(leDone)
+
+			runLeaderElection(leCtx, elector)
+		}()
+
+		klog.Info("[Cron] Jobs are inserted, wait leadership!")
+	} else {
+		close(leDone)
+
+		// Start the cron scheduler in its own goroutine
+		sched.start(ctx)
+
+		klog.Info("[Cron] Started!")
+	}
 
 	// Graceful Shutdown
 
@@ -124,12 +277,95 @@ func Run(dotenv func()) {
 	<-quit
 
 	// When someone call SIGTERM or SIGINT signals, we'll get to here
-	// cron.Stop() -> Wait jobs and stop
-	cron.Stop()
+	// Stop discovery, controller and bot commands
+	syncCancel()
+	syncWg.Wait()
+
+	// Stop accepting manual runs, accepted runs are waited with cron jobs
+	if apiServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := apiServer.Shutdown(shutdownCtx); err != nil {
+			klog.Errorf("[API] Shutdown: %s", err.Error())
+		}
+		shutdownCancel()
+	}
+
+	// Stop scheduling, returned context is done when running jobs are finished
+	stopCtx := sched.stopForever()
+
+	klog.Infof("[Cron] Stopping! Wait running jobs %s", cfg.ShutdownGracePeriod.Duration())
+
+	// Lease is released only after running jobs are returned, so other replica does not run the same targets meanwhile
+	waitJobs(stopCtx, registry.Wait, cfg.ShutdownGracePeriod.Duration(), cancel, func() {
+		leCancel()
+		<-leDone
+	})
 
 	klog.Info("[Cron] Stopped! Exit")
 }
 
+// Private func for wait cron jobs and runs out of cron after stop of scheduling
+// After grace period in-flight execs are cancelled by cancel and jobs reports are waited
+// Release is called only after all jobs are returned
+func waitJobs(stopCtx context.Context, wait func(), grace time.Duration, cancel func(), release func()) {
+	// Closed, when cron jobs and runs out of cron are finished
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		<-stopCtx.Done()
+		wait()
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(grace):
+		// Grace period is over, cancel in-flight execs and wait jobs reports
+		klog.Warn("[Cron] Grace period is over, cancel running jobs")
+
+		cancel()
+		<-stopped
+	}
+
+	release()
+}
+
+// Private func for load history with timeout, so unavailable store does not block start
+func loadHistory(ctx context.Context, history *chistory.History) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return history.Load(ctx)
+}
+
+func newKubeConfig(cfg *config.Config) (*rest.Config, error) {
+	switch cfg.Kubernetes.AuthMode {
+	// ServiceAccount token and CA, which are mounted to pod
+	case config.AuthModeInCluster:
+		return rest.InClusterConfig()
+
+	// Kubeconfig file: explicit path or KUBECONFIG variable or ~/.kube/config
+	case config.AuthModeKubeconfig:
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = cfg.Kubernetes.Kubeconfig
+
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: cfg.Kubernetes.Context}
+
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	}
+
+	// Initialize Kubernetes tls config for set insecure: true of false from config
+	tlsClientConfig := &rest.TLSClientConfig{Insecure: cfg.Kubernetes.Insecure}
+
+	// Initialize Kubernetes BearerToken config
+	return &rest.Config{
+		Host:            cfg.Kubernetes.Host,
+		APIPath:         cfg.Kubernetes.ApiVersion,
+		BearerToken:     cfg.Kubernetes.BearerToken,
+		TLSClientConfig: *tlsClientConfig,
+	}, nil
+}
+
 func newStorageProvider(cfg *config.Config) (storage.Provider, error) {
 	client, err := minio.New(cfg.FileStorage.Endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(cfg.FileStorage.AccessKey, cfg.FileStorage.SecretKey, ""),
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	cr "github.com/robfig/cron/v3"
+)
+
+func TestWaitJobs(t *testing.T) {
+	tests := []struct {
+		name string
+		// Duration of running job, it is interrupted by cancel
+		jobDuration time.Duration
+		grace       time.Duration
+		wantCancel  bool
+	}{
+		{
+			name:        "test lease is released after job is finished",
+			jobDuration: 50 * time.Millisecond,
+			grace:       time.Second,
+		},
+		{
+			name:        "test lease is released after job is cancelled and returned",
+			jobDuration: time.Hour,
+			grace:       50 * time.Millisecond,
+			wantCancel:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var events []string
+			record := func(event string) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				events = append(events, event)
+			}
+
+			jobCtx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Cron job is running, stop context is done when it is returned
+			stopCtx, stopDone := context.WithCancel(context.Background())
+			go func() {
+				defer stopDone()
+
+				select {
+				case <-time.After(tt.jobDuration):
+				case <-jobCtx.Done():
+				}
+				// Job writes report after cancel, lease must be held meanwhile
+				time.Sleep(20 * time.Millisecond)
+				record("job returned")
+			}()
+
+			waitJobs(stopCtx, func() { record("runs waited") }, tt.grace, func() {
+				record("cancel")
+				cancel()
+			}, func() { record("release") })
+
+			want := []string{"job returned", "runs waited", "release"}
+			if tt.wantCancel {
+				want = append([]string{"cancel"}, want...)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(events) != len(want) {
+				t.Fatalf("events = %v, want %v", events, want)
+			}
+			for i := range want {
+				if events[i] != want[i] {
+					t.Fatalf("events = %v, want %v", events, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerStopCancelsAndWaitsJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		events = append(events, event)
+	}
+
+	// Run out of cron, for example manual run, is waited by wait
+	runDone := make(chan struct{})
+	sched := &scheduler{cron: cr.New(cr.WithSeconds()), ctx: ctx, wait: func() {
+		<-runDone
+		record("runs waited")
+	}}
+	sched.start(ctx)
+
+	runCtx := sched.runContext()
+	go func() {
+		defer close(runDone)
+
+		select {
+		case <-runCtx.Done():
+		case <-time.After(time.Second):
+			t.Errorf("run is not cancelled on loss of leadership")
+		}
+		// Run writes report after cancel, replica must not take part in election meanwhile
+		time.Sleep(20 * time.Millisecond)
+		record("run returned")
+	}()
+
+	sched.stop()
+	record("stopped")
+
+	if sched.scheduling() {
+		t.Errorf("scheduling() = true after stop")
+	}
+	if ctx.Err() != nil {
+		t.Errorf("context of jobs is cancelled on loss of leadership")
+	}
+
+	// Next term has new context of runs
+	sched.start(ctx)
+	if sched.runContext().Err() != nil {
+		t.Errorf("context of runs of new term is cancelled")
+	}
+	sched.stopForever()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []string{"run returned", "runs waited", "stopped"}
+	if len(events) != len(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("events = %v, want %v", events, want)
+		}
+	}
+}
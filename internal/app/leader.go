@@ -0,0 +1,163 @@
+package app
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	cr "github.com/robfig/cron/v3"
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// scheduler - cron, which is started and stopped by leadership
+// After shutdown is started, cron is never started again
+type scheduler struct {
+	mu       sync.Mutex
+	cron     *cr.Cron
+	running  bool
+	shutdown bool
+	// Parent context of terms, it is cancelled on shutdown after grace period
+	ctx context.Context
+	// Context of runs of current term, it is cancelled on loss of leadership
+	term       context.Context
+	cancelTerm context.CancelFunc
+	// Called in own goroutine after each start, for example for catch-up of missed runs
+	onStart func()
+	// Waits runs out of cron on loss of leadership, nil when there are no such runs
+	wait func()
+}
+
+// Start scheduling of jobs, when shutdown is not started and ctx is not done
+// Leadership ctx is checked under lock, so cron is not started after loss of leadership
+func (s *scheduler) start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shutdown || ctx.Err() != nil {
+		return
+	}
+	s.term, s.cancelTerm = context.WithCancel(s.ctx)
+	s.cron.Start()
+	s.running = true
+
+	if s.onStart != nil {
+		go s.onStart()
+	}
+}
+
+// Stop scheduling on loss of leadership, running jobs of term are cancelled and waited
+// So replica takes part in election again only after its jobs are returned, and new leader does not run them twice
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	s.running = false
+	if s.cancelTerm != nil {
+		s.cancelTerm()
+	}
+	stopCtx := s.cron.Stop()
+	s.mu.Unlock()
+
+	// Runs check scheduling under lock, so they are waited without it
+	<-stopCtx.Done()
+	if s.wait != nil {
+		s.wait()
+	}
+}
+
+// Stop scheduling forever, running jobs are not interrupted, they are cancelled after grace period
+// Returned context is done when running cron jobs are finished
+func (s *scheduler) stopForever() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = false
+	s.shutdown = true
+
+	return s.cron.Stop()
+}
+
+// Check cron is scheduling jobs now, queued runs are dropped, when it is stopped
+func (s *scheduler) scheduling() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.running
+}
+
+// Get context of runs of current term, it is cancelled on loss of leadership
+// Before first start it is parent context of terms
+func (s *scheduler) runContext() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.term == nil {
+		return s.ctx
+	}
+
+	return s.term
+}
+
+// Private func for make leader elector by Lease, scheduler is started on acquire of lease and stopped on loss
+// On cancel of context of elector lease is released, so other replica becomes leader without waiting lease duration
+func newLeaderElector(cfg *config.LeaderElectionConfig, client *kubernetes.Clientset, sched *scheduler) (*leaderelection.LeaderElector, error) {
+	identity := cfg.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		identity = hostname
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      cfg.LeaseName,
+			Namespace: cfg.Namespace,
+		},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	klog.Infof("[LeaderElection] %s: Wait leadership of lease %s/%s", identity, cfg.Namespace, cfg.LeaseName)
+
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   cfg.LeaseDuration.Duration(),
+		RenewDeadline:   cfg.RenewDeadline.Duration(),
+		RetryPeriod:     cfg.RetryPeriod.Duration(),
+		ReleaseOnCancel: true,
+		Name:            cfg.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				klog.Infof("[LeaderElection] %s: Leadership is acquired, start cron", identity)
+
+				sched.start(leaderCtx)
+			},
+			OnStoppedLeading: func() {
+				klog.Warnf("[LeaderElection] %s: Leadership is lost, stop cron, cancel and wait running jobs", identity)
+
+				sched.stop()
+
+				klog.Infof("[LeaderElection] %s: Running jobs are returned, wait leadership again", identity)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					klog.Infof("[LeaderElection] %s: Leader is %s", identity, leader)
+				}
+			},
+		},
+	})
+}
+
+// Private func for take part in leader election until ctx is cancelled
+// After loss of leadership replica takes part in election again, when its running jobs are returned
+func runLeaderElection(ctx context.Context, elector *leaderelection.LeaderElector) {
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+}
@@ -0,0 +1,407 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// Timeout of long polling request, shutdown waits it at most
+const pollTimeout = 10 * time.Second
+
+// Interval of check of leadership and retry of failed polling
+const pollRetryInterval = 5 * time.Second
+
+// Max length of message in Telegram, tags of HTML are counted too, so parts are not longer in any case
+const messageMaxLength = 4096
+
+// Header of webhook request with secret token, which is set on registration of webhook
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Types of updates, which are handled by bot
+var allowedUpdates = []string{"message", "callback_query"}
+
+// API - methods of Telegram Bot API, it is implemented by tgbotapi.BotAPI
+type API interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	GetUpdates(config tgbotapi.UpdateConfig) ([]tgbotapi.Update, error)
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+}
+
+// Scheduler - scheduled jobs of targets, it is implemented by job.Registry
+type Scheduler interface {
+	Entries() []*job.ScheduledEntry
+	Trigger(target string, jobKind string) (uuid.UUID, <-chan error, error)
+	FetchBackups(ctx context.Context, target string) ([]*job.BackupInfo, error)
+}
+
+// Runs - finished runs of jobs, it is implemented by history.History
+type Runs interface {
+	Get(ctx context.Context, id uuid.UUID) (*job.Run, error)
+	List(target string, jobKind string, limit int) []*job.Run
+}
+
+// Bot - handler of commands from whitelisted chats
+// Updates are received only while this replica schedules jobs, so replicas do not handle same commands
+type Bot struct {
+	api       API
+	cfg       *config.TelegramCommandsConfig
+	allowed   map[int64]bool
+	scheduler Scheduler
+	runs      Runs
+	backups   *job.LatestBackupsInfo
+	// Reports, that this replica schedules jobs, nil means always scheduling
+	scheduling func() bool
+
+	// Updates are handled in own goroutines, so slow command does not delay other chats
+	handlers sync.WaitGroup
+
+	mu sync.Mutex
+	// Handled confirmation messages with time of handling, each press of button has new id,
+	// so confirmation is identified by message and second press does not start second run
+	callbacks map[confirmation]time.Time
+}
+
+// confirmation - message with buttons of confirmation
+type confirmation struct {
+	chatId    int64
+	messageId int
+}
+
+// Constructor
+func NewBot(api API, cfg *config.TelegramCommandsConfig, scheduler Scheduler, runs Runs, backups *job.LatestBackupsInfo, scheduling func() bool) *Bot {
+	allowed := make(map[int64]bool, len(cfg.ChatIds))
+	for _, chatId := range cfg.ChatIds {
+		allowed[chatId] = true
+	}
+
+	return &Bot{
+		api:        api,
+		cfg:        cfg,
+		allowed:    allowed,
+		scheduler:  scheduler,
+		runs:       runs,
+		backups:    backups,
+		scheduling: scheduling,
+		callbacks:  make(map[confirmation]time.Time),
+	}
+}
+
+// Run receives and handles updates by mode from config until ctx is done
+func (b *Bot) Run(ctx context.Context) error {
+	// Commands are shown in menu of chats
+	if _, err := b.api.Request(tgbotapi.NewSetMyCommands(commands...)); err != nil {
+		klog.Warnf("[TelegramBot] Set commands: %s", err.Error())
+	}
+
+	if b.cfg.Mode == config.TelegramCommandsModeWebhook {
+		return b.serveWebhook(ctx)
+	}
+
+	return b.poll(ctx)
+}
+
+// Private method for receive updates by long polling, webhook is deleted, because Telegram does not allow both
+// Running handlers of updates are waited before return
+func (b *Bot) poll(ctx context.Context) error {
+	if _, err := b.api.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return err
+	}
+	defer b.handlers.Wait()
+
+	klog.Info("[TelegramBot] Receive commands by long polling")
+
+	offset := 0
+	for ctx.Err() == nil {
+		// Updates are kept by Telegram, until leader receives them
+		if !b.isScheduling() {
+			sleep(ctx, pollRetryInterval)
+
+			continue
+		}
+
+		updates, err := b.api.GetUpdates(tgbotapi.UpdateConfig{
+			Offset:         offset,
+			Timeout:        int(pollTimeout.Seconds()),
+			AllowedUpdates: allowedUpdates,
+		})
+		if err != nil {
+			klog.Errorf("[TelegramBot] Get updates: %s", err.Error())
+			sleep(ctx, pollRetryInterval)
+
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+
+			b.dispatch(ctx, update)
+		}
+
+		// Handled updates are confirmed at once, so new leader does not receive them again
+		if len(updates) > 0 {
+			if _, err := b.api.GetUpdates(tgbotapi.UpdateConfig{Offset: offset, Timeout: 0}); err != nil {
+				klog.Errorf("[TelegramBot] Confirm updates: %s", err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// Private method for receive updates by webhook, it is registered in Telegram on start
+// Replica, which does not schedule jobs, replies error, so Telegram sends update again
+// Running handlers of updates are waited before return
+func (b *Bot) serveWebhook(ctx context.Context) error {
+	if err := b.setWebhook(); err != nil {
+		return err
+	}
+	defer b.handlers.Wait()
+
+	webhookURL, err := url.Parse(b.cfg.WebhookURL)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(webhookURL.Path, func(w http.ResponseWriter, r *http.Request) {
+		b.handleWebhook(ctx, w, r)
+	})
+
+	server := &http.Server{
+		Addr:              b.cfg.WebhookAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	klog.Infof("[TelegramBot] Receive commands by webhook on %s", b.cfg.WebhookAddress)
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Private method for handle webhook request, requests without secret token of webhook are rejected
+// Update is accepted at once and handled with ctx of bot, so slow command is not sent again by Telegram
+func (b *Bot) handleWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+	// Requests not from Telegram do not know secret token
+	token := r.Header.Get(webhookSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(b.cfg.WebhookSecret)) != 1 {
+		klog.Warnf("[TelegramBot] Rejected webhook request without secret token from %s", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+	if !b.isScheduling() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		klog.Errorf("[TelegramBot] Decode update: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	b.dispatch(ctx, update)
+}
+
+// Private method for handle update in own goroutine, so slow command does not delay other updates
+func (b *Bot) dispatch(ctx context.Context, update tgbotapi.Update) {
+	b.handlers.Add(1)
+	go func() {
+		defer b.handlers.Done()
+
+		b.handleUpdate(ctx, update)
+	}()
+}
+
+// Private method for register webhook with secret token
+// Raw request is made, because WebhookConfig of tgbotapi has no secret token
+func (b *Bot) setWebhook() error {
+	params := make(tgbotapi.Params)
+	params["url"] = b.cfg.WebhookURL
+	params["secret_token"] = b.cfg.WebhookSecret
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return err
+	}
+
+	_, err := b.api.MakeRequest("setWebhook", params)
+
+	return err
+}
+
+// Private method for handle command or confirmation, updates of not whitelisted chats are rejected
+func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	switch {
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		callback := update.CallbackQuery
+		if !b.allow(callback.Message.Chat.ID, callback.From, "confirmation "+callback.Data) {
+			b.answer(callback.ID, "Chat is not allowed")
+
+			return
+		}
+
+		b.handleCallback(callback)
+	case update.Message != nil && update.Message.IsCommand():
+		message := update.Message
+		if !b.allow(message.Chat.ID, message.From, "/"+message.Command()) {
+			b.reply(message.Chat.ID, "Chat is not allowed")
+
+			return
+		}
+
+		b.handleCommand(ctx, message)
+	}
+}
+
+// Private method for check chat in whitelist, action is logged with user
+func (b *Bot) allow(chatId int64, user *tgbotapi.User, action string) bool {
+	if !b.allowed[chatId] {
+		klog.Warnf("[TelegramBot] Rejected %s from not allowed chat %d by %s", action, chatId, userName(user))
+
+		return false
+	}
+
+	klog.Infof("[TelegramBot] %s from chat %d by %s", action, chatId, userName(user))
+
+	return true
+}
+
+// Private method for mark confirmation message as handled, false when it is already handled
+// Confirmations older than TTL are rejected by time, so they are forgotten
+func (b *Bot) markCallback(message *tgbotapi.Message) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for key, handledAt := range b.callbacks {
+		if now.Sub(handledAt) > confirmTTL {
+			delete(b.callbacks, key)
+		}
+	}
+
+	key := confirmation{chatId: message.Chat.ID, messageId: message.MessageID}
+	if _, ok := b.callbacks[key]; ok {
+		return false
+	}
+	b.callbacks[key] = now
+
+	return true
+}
+
+// Private method for check this replica schedules jobs
+func (b *Bot) isScheduling() bool {
+	return b.scheduling == nil || b.scheduling()
+}
+
+// Private method for send HTML message to chat, long message is sent by parts
+func (b *Bot) reply(chatId int64, text string) {
+	for _, part := range splitMessage(text, messageMaxLength) {
+		msg := tgbotapi.NewMessage(chatId, part)
+		msg.ParseMode = tgbotapi.ModeHTML
+
+		if _, err := b.api.Send(msg); err != nil {
+			klog.Errorf("[TelegramBot] Send message to chat %d: %s", chatId, err.Error())
+
+			return
+		}
+	}
+}
+
+// Private method for replace text of message, buttons of message are removed
+func (b *Bot) edit(chatId int64, messageId int, text string) {
+	msg := tgbotapi.NewEditMessageText(chatId, messageId, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+
+	if _, err := b.api.Send(msg); err != nil {
+		klog.Errorf("[TelegramBot] Edit message in chat %d: %s", chatId, err.Error())
+	}
+}
+
+// Private method for answer callback query, so client stops progress of button
+func (b *Bot) answer(callbackId string, text string) {
+	if _, err := b.api.Request(tgbotapi.NewCallback(callbackId, text)); err != nil {
+		klog.Errorf("[TelegramBot] Answer callback: %s", err.Error())
+	}
+}
+
+// Help func for name of user in logs and messages
+func userName(user *tgbotapi.User) string {
+	switch {
+	case user == nil:
+		return "unknown"
+	case user.UserName != "":
+		return "@" + user.UserName
+	}
+
+	return user.FirstName
+}
+
+// Help func for split message to parts of max length by lines, tags of messages do not cross lines
+// Line, which is longer than max, is cut by symbols
+func splitMessage(text string, max int) []string {
+	var parts []string
+	var part []rune
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
+		if len(part) > 0 && len(part)+1+len(runes) > max {
+			parts = append(parts, string(part))
+			part = nil
+		}
+		if len(part) > 0 {
+			part = append(part, '\n')
+		}
+		part = append(part, runes...)
+
+		for len(part) > max {
+			parts = append(parts, string(part[:max]))
+			part = part[max:]
+		}
+	}
+	if len(part) > 0 || len(parts) == 0 {
+		parts = append(parts, string(part))
+	}
+
+	return parts
+}
+
+// Help func for wait interval or ctx
+func sleep(ctx context.Context, interval time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(interval):
+	}
+}
@@ -0,0 +1,487 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeAPI - records sent messages and edits of messages, updates are received by first long polling
+type fakeAPI struct {
+	mu      sync.Mutex
+	texts   []string
+	updates []tgbotapi.Update
+}
+
+func (fa *fakeAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+
+	switch msg := c.(type) {
+	case tgbotapi.MessageConfig:
+		fa.texts = append(fa.texts, msg.Text)
+	case tgbotapi.EditMessageTextConfig:
+		fa.texts = append(fa.texts, msg.Text)
+	}
+
+	return tgbotapi.Message{}, nil
+}
+
+func (fa *fakeAPI) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (fa *fakeAPI) GetUpdates(config tgbotapi.UpdateConfig) ([]tgbotapi.Update, error) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+
+	// Confirmation of updates
+	if config.Timeout == 0 {
+		return nil, nil
+	}
+	if len(fa.updates) == 0 {
+		time.Sleep(10 * time.Millisecond)
+
+		return nil, nil
+	}
+
+	updates := fa.updates
+	fa.updates = nil
+
+	return updates, nil
+}
+
+func (fa *fakeAPI) MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (fa *fakeAPI) last() string {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+
+	if len(fa.texts) == 0 {
+		return ""
+	}
+
+	return fa.texts[len(fa.texts)-1]
+}
+
+// fakeScheduler - target main with backup job, triggered runs are recorded
+type fakeScheduler struct {
+	mu        sync.Mutex
+	triggered []string
+}
+
+func (fs *fakeScheduler) Entries() []*job.ScheduledEntry {
+	next := time.Date(2024, 1, 10, 21, 0, 0, 0, time.UTC)
+
+	return []*job.ScheduledEntry{
+		{Target: "analytics", Job: job.JobInfo, Next: &next},
+		{Target: "main", Job: job.JobBackup, Next: &next},
+		{Target: "main", Job: job.JobInfo, Next: &next},
+	}
+}
+
+func (fs *fakeScheduler) FetchBackups(ctx context.Context, target string) ([]*job.BackupInfo, error) {
+	return []*job.BackupInfo{{BackupName: "base_000000010000000000000003", Time: time.Now()}}, nil
+}
+
+func (fs *fakeScheduler) Trigger(target string, jobKind string) (uuid.UUID, <-chan error, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.triggered = append(fs.triggered, target+"/"+jobKind)
+	done := make(chan error, 1)
+	done <- nil
+
+	return uuid.New(), done, nil
+}
+
+// blockingScheduler - info command of backups does not finish until ctx is done
+type blockingScheduler struct {
+	fakeScheduler
+	fetching chan struct{}
+}
+
+func (bs *blockingScheduler) FetchBackups(ctx context.Context, target string) ([]*job.BackupInfo, error) {
+	close(bs.fetching)
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+// longTargetScheduler - one target with long name, which does not fit in data of button
+type longTargetScheduler struct {
+	fakeScheduler
+	target string
+}
+
+func (ls *longTargetScheduler) Entries() []*job.ScheduledEntry {
+	return []*job.ScheduledEntry{{Target: ls.target, Job: job.JobBackup}}
+}
+
+type fakeRuns struct {
+	runs []*job.Run
+}
+
+func (fr *fakeRuns) Get(ctx context.Context, id uuid.UUID) (*job.Run, error) {
+	return nil, nil
+}
+
+func (fr *fakeRuns) List(target string, jobKind string, limit int) []*job.Run {
+	return fr.runs
+}
+
+func commandUpdate(chatId int64, text string) tgbotapi.Update {
+	command := strings.Fields(text)[0]
+
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		Chat:     &tgbotapi.Chat{ID: chatId},
+		From:     &tgbotapi.User{UserName: "dba"},
+		Text:     text,
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}},
+	}}
+}
+
+func callbackUpdate(chatId int64, data string, sentAt time.Time) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   "1",
+		From: &tgbotapi.User{UserName: "dba"},
+		Data: data,
+		Message: &tgbotapi.Message{
+			MessageID: 10,
+			Chat:      &tgbotapi.Chat{ID: chatId},
+			Date:      int(sentAt.Unix()),
+			ReplyMarkup: &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
+				{tgbotapi.NewInlineKeyboardButtonData("Run backup", data)},
+			}},
+		},
+	}}
+}
+
+func TestBotCommands(t *testing.T) {
+	config.TimeZone = time.UTC
+
+	backups := job.NewLatestBackupsInfo()
+	backups.Update("main", []*job.BackupInfo{{BackupName: "base_000000010000000000000002", Time: time.Now()}}, time.Now())
+
+	runs := &fakeRuns{runs: []*job.Run{{Id: uuid.New(), Target: "main", Job: job.JobBackup, Trigger: job.TriggerManual,
+		StartedAt: time.Now(), Status: job.RunFailed, Reason: "exit_code"}}}
+
+	tests := []struct {
+		name     string
+		update   tgbotapi.Update
+		wantText string
+	}{
+		{
+			name:     "test command of not allowed chat is rejected",
+			update:   commandUpdate(2, "/status"),
+			wantText: "Chat is not allowed",
+		},
+		{
+			name:     "test backups",
+			update:   commandUpdate(1, "/backups"),
+			wantText: "base_000000010000000000000002",
+		},
+		{
+			name:     "test backups of target without info run are fetched",
+			update:   commandUpdate(1, "/backups analytics"),
+			wantText: "base_000000010000000000000003",
+		},
+		{
+			name:     "test backups of unknown target",
+			update:   commandUpdate(1, "/backups billing"),
+			wantText: "Target <b>billing</b> is not found",
+		},
+		{
+			name:     "test status",
+			update:   commandUpdate(1, "/status"),
+			wantText: "backup: <b>failed</b>",
+		},
+		{
+			name:     "test history",
+			update:   commandUpdate(1, "/history main 5"),
+			wantText: "MAIN backup: <b>failed</b> (manual), reason: exit_code",
+		},
+		{
+			name:     "test backup now asks confirmation",
+			update:   commandUpdate(1, "/backup_now"),
+			wantText: "Run backup of <b>MAIN</b> now?",
+		},
+		{
+			name:     "test backup now of unknown target",
+			update:   commandUpdate(1, "/backup_now analytics"),
+			wantText: "Target <b>analytics</b> is not found",
+		},
+		{
+			name:     "test expired confirmation",
+			update:   callbackUpdate(1, callbackBackupNow+"main", time.Now().Add(-time.Hour)),
+			wantText: "Confirmation is expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeAPI{}
+			scheduler := &fakeScheduler{}
+			bot := NewBot(api, &config.TelegramCommandsConfig{ChatIds: []int64{1}}, scheduler, runs, backups, nil)
+
+			bot.handleUpdate(context.Background(), tt.update)
+
+			if got := api.last(); !strings.Contains(got, tt.wantText) {
+				t.Errorf("reply = %q, want contains %q", got, tt.wantText)
+			}
+			if len(scheduler.triggered) != 0 {
+				t.Errorf("triggered = %v, want no runs", scheduler.triggered)
+			}
+		})
+	}
+}
+
+func TestBotBackupNowConfirmation(t *testing.T) {
+	config.TimeZone = time.UTC
+
+	api := &fakeAPI{}
+	scheduler := &fakeScheduler{}
+	bot := NewBot(api, &config.TelegramCommandsConfig{ChatIds: []int64{1}}, scheduler, &fakeRuns{}, nil, nil)
+
+	// Confirmation from not allowed chat does not start run
+	bot.handleUpdate(context.Background(), callbackUpdate(2, callbackBackupNow+"main", time.Now()))
+	if len(scheduler.triggered) != 0 {
+		t.Fatalf("triggered = %v, want no runs", scheduler.triggered)
+	}
+
+	bot.handleUpdate(context.Background(), callbackUpdate(1, callbackBackupNow+"main", time.Now()))
+	if len(scheduler.triggered) != 1 || scheduler.triggered[0] != "main/backup" {
+		t.Fatalf("triggered = %v, want [main/backup]", scheduler.triggered)
+	}
+
+	// Same confirmation, which is received again, second press of button with new id, while buttons are not removed yet,
+	// and confirmation without buttons do not start second run
+	bot.handleUpdate(context.Background(), callbackUpdate(1, callbackBackupNow+"main", time.Now()))
+	pressed := callbackUpdate(1, callbackBackupNow+"main", time.Now())
+	pressed.CallbackQuery.ID = "2"
+	bot.handleUpdate(context.Background(), pressed)
+	handled := callbackUpdate(1, callbackBackupNow+"main", time.Now())
+	handled.CallbackQuery.ID = "3"
+	handled.CallbackQuery.Message.ReplyMarkup = nil
+	bot.handleUpdate(context.Background(), handled)
+	if len(scheduler.triggered) != 1 {
+		t.Fatalf("triggered = %v, want one run", scheduler.triggered)
+	}
+
+	// Confirmation in other message starts run
+	other := callbackUpdate(1, callbackBackupNow+"main", time.Now())
+	other.CallbackQuery.ID = "4"
+	other.CallbackQuery.Message.MessageID = 11
+	bot.handleUpdate(context.Background(), other)
+	if len(scheduler.triggered) != 2 {
+		t.Fatalf("triggered = %v, want second run of other confirmation", scheduler.triggered)
+	}
+
+	// Result of run is replied, when run is finished
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(api.last(), "is finished") {
+		if time.Now().After(deadline) {
+			t.Fatalf("reply = %q, want result of run", api.last())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBotPollHandlesUpdatesConcurrently(t *testing.T) {
+	config.TimeZone = time.UTC
+
+	api := &fakeAPI{}
+	scheduler := &blockingScheduler{fetching: make(chan struct{})}
+	bot := NewBot(api, &config.TelegramCommandsConfig{ChatIds: []int64{1}}, scheduler, &fakeRuns{}, nil, nil)
+
+	backups := commandUpdate(1, "/backups main")
+	backups.UpdateID = 1
+	status := commandUpdate(2, "/status")
+	status.UpdateID = 2
+	api.updates = []tgbotapi.Update{backups, status}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- bot.poll(ctx) }()
+
+	// Reply to other chat is sent, while info command of /backups is running
+	<-scheduler.fetching
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(api.last(), "Chat is not allowed") {
+		if time.Now().After(deadline) {
+			t.Fatalf("reply = %q, want reply to other chat", api.last())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Info command is cancelled with bot, poll waits its reply
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("poll() error = %v", err)
+	}
+	if got := api.last(); !strings.Contains(got, "is not received") {
+		t.Errorf("reply = %q, want backups info is not received", got)
+	}
+}
+
+func TestBotBackupNowLongTarget(t *testing.T) {
+	config.TimeZone = time.UTC
+
+	target := config.TargetName(config.TargetNamePrefixStatefulSet, "analytics-production", "postgres-analytics-cluster")
+	scheduler := &longTargetScheduler{target: target}
+	bot := NewBot(&fakeAPI{}, &config.TelegramCommandsConfig{ChatIds: []int64{1}}, scheduler, &fakeRuns{}, nil, nil)
+
+	data := backupNowData(target)
+	if len(data) > callbackDataMaxLength {
+		t.Fatalf("len(%q) = %d, want <= %d", data, len(data), callbackDataMaxLength)
+	}
+	if data == callbackBackupNow+target {
+		t.Fatalf("data = %q, want hash of long target", data)
+	}
+
+	bot.handleUpdate(context.Background(), callbackUpdate(1, data, time.Now()))
+	if len(scheduler.triggered) != 1 || scheduler.triggered[0] != target+"/backup" {
+		t.Fatalf("triggered = %v, want [%s/backup]", scheduler.triggered, target)
+	}
+}
+
+func TestBotWebhookSecret(t *testing.T) {
+	config.TimeZone = time.UTC
+
+	secret := strings.Repeat("a", 32)
+	body := `{"update_id":1,"message":{"message_id":1,"chat":{"id":1},"text":"/status","entities":[{"type":"bot_command","offset":0,"length":7}]}}`
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		wantReply  bool
+	}{
+		{
+			name:       "test request without secret token is rejected",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "test request with wrong secret token is rejected",
+			token:      strings.Repeat("b", 32),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "test request with secret token is handled",
+			token:      secret,
+			wantStatus: http.StatusOK,
+			wantReply:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeAPI{}
+			cfg := &config.TelegramCommandsConfig{ChatIds: []int64{1}, WebhookSecret: secret}
+			bot := NewBot(api, cfg, &fakeScheduler{}, &fakeRuns{}, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(body))
+			if tt.token != "" {
+				req.Header.Set(webhookSecretHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			bot.handleWebhook(context.Background(), rec, req)
+			bot.handlers.Wait()
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := api.last() != ""; got != tt.wantReply {
+				t.Errorf("replied = %t, want %t", got, tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestBotWebhookRepliesBeforeCommand(t *testing.T) {
+	config.TimeZone = time.UTC
+
+	api := &fakeAPI{}
+	scheduler := &blockingScheduler{fetching: make(chan struct{})}
+	secret := strings.Repeat("a", 32)
+	cfg := &config.TelegramCommandsConfig{ChatIds: []int64{1}, WebhookSecret: secret}
+	bot := NewBot(api, cfg, scheduler, &fakeRuns{}, nil, nil)
+
+	body := `{"update_id":1,"message":{"message_id":1,"chat":{"id":1},"text":"/backups main","entities":[{"type":"bot_command","offset":0,"length":8}]}}`
+	req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(body))
+	req.Header.Set(webhookSecretHeader, secret)
+	rec := httptest.NewRecorder()
+
+	// Request is accepted, while info command of /backups is running
+	ctx, cancel := context.WithCancel(context.Background())
+	bot.handleWebhook(ctx, rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	<-scheduler.fetching
+	if got := api.last(); got != "" {
+		t.Fatalf("reply = %q, want no reply before info command is finished", got)
+	}
+
+	// Info command is cancelled with bot, not with request
+	cancel()
+	bot.handlers.Wait()
+	if got := api.last(); !strings.Contains(got, "is not received") {
+		t.Errorf("reply = %q, want backups info is not received", got)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		max       int
+		wantParts []string
+	}{
+		{
+			name:      "test short message is not split",
+			text:      "line1\nline2",
+			max:       20,
+			wantParts: []string{"line1\nline2"},
+		},
+		{
+			name:      "test message is split by lines",
+			text:      "line1\nline2\nline3",
+			max:       11,
+			wantParts: []string{"line1\nline2", "line3"},
+		},
+		{
+			name:      "test long line is cut by symbols",
+			text:      "бэкап\nбэкапы",
+			max:       4,
+			wantParts: []string{"бэка", "п", "бэка", "пы"},
+		},
+		{
+			name:      "test empty message",
+			text:      "",
+			max:       4,
+			wantParts: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitMessage(tt.text, tt.max); !reflect.DeepEqual(got, tt.wantParts) {
+				t.Errorf("splitMessage() = %q, want %q", got, tt.wantParts)
+			}
+		})
+	}
+}
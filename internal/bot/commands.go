@@ -0,0 +1,394 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// Confirmation of backup run is expired after this time
+const confirmTTL = 5 * time.Minute
+
+// Limits of runs in /history
+const (
+	defaultHistoryLimit = 10
+	maxHistoryLimit     = 50
+)
+
+// Data of buttons of confirmation
+const (
+	callbackBackupNow = "backup_now:"
+	// Target, which name does not fit in data of button, is passed by hash of name
+	callbackBackupNowHash = "backup_now#"
+	callbackCancel        = "cancel"
+)
+
+// Max length of data of button in Telegram, in bytes
+const callbackDataMaxLength = 64
+
+// Format of dates in messages
+const dateFormat = "02.01.2006 15:04"
+
+// Commands in menu of chats
+var commands = []tgbotapi.BotCommand{
+	{Command: "backups", Description: "Latest backups of targets"},
+	{Command: "status", Description: "Last run and next schedule of each job"},
+	{Command: "backup_now", Description: "Run backup of target now"},
+	{Command: "history", Description: "Last runs of jobs"},
+}
+
+// Private method for handle command of whitelisted chat
+func (b *Bot) handleCommand(ctx context.Context, message *tgbotapi.Message) {
+	chatId := message.Chat.ID
+	args := strings.Fields(message.CommandArguments())
+
+	switch message.Command() {
+	case "backups":
+		// Backups of each target are sent by separate message
+		for _, msg := range b.backupsMessages(ctx, args) {
+			b.reply(chatId, msg)
+		}
+	case "status":
+		b.reply(chatId, b.statusMessage(args))
+	case "backup_now":
+		b.confirmBackup(chatId, args)
+	case "history":
+		b.reply(chatId, b.historyMessage(args))
+	case "start", "help":
+		b.reply(chatId, helpMessage())
+	default:
+		b.reply(chatId, "Unknown command, see /help")
+	}
+}
+
+// Private method for handle button of confirmation
+func (b *Bot) handleCallback(callback *tgbotapi.CallbackQuery) {
+	chatId := callback.Message.Chat.ID
+	messageId := callback.Message.MessageID
+
+	if callback.Data != callbackCancel && !strings.HasPrefix(callback.Data, callbackBackupNow) &&
+		!strings.HasPrefix(callback.Data, callbackBackupNowHash) {
+		b.answer(callback.ID, "Unknown action")
+
+		return
+	}
+
+	// Buttons are removed from handled confirmation, update may be received again after restart or by new leader.
+	// Buttons stay until edit of message is done, so second press is rejected by message
+	if callback.Message.ReplyMarkup == nil || !b.markCallback(callback.Message) {
+		b.answer(callback.ID, "Confirmation is already handled")
+
+		return
+	}
+
+	switch {
+	case callback.Data == callbackCancel:
+		b.answer(callback.ID, "")
+		b.edit(chatId, messageId, "Backup run is cancelled")
+	default:
+		target, ok := b.callbackTarget(callback.Data)
+		if !ok {
+			b.answer(callback.ID, "Target is not found")
+			b.edit(chatId, messageId, "Target of backup is not found, send /backup_now again")
+
+			return
+		}
+
+		// Old confirmations are not accepted, so button is not pressed by mistake much later
+		if time.Since(callback.Message.Time()) > confirmTTL {
+			b.answer(callback.ID, "Confirmation is expired")
+			b.edit(chatId, messageId, "Confirmation is expired, send /backup_now again")
+
+			return
+		}
+
+		b.answer(callback.ID, "")
+		b.triggerBackup(chatId, messageId, target, callback.From)
+	}
+}
+
+// Private method for ask confirmation of backup run of target
+// Target may be omitted, when only one target has backup job
+func (b *Bot) confirmBackup(chatId int64, args []string) {
+	targets := b.targetsWithJob(job.JobBackup)
+
+	var target string
+	switch {
+	case len(args) > 0:
+		target = args[0]
+	case len(targets) == 1:
+		target = targets[0]
+	default:
+		b.reply(chatId, "Usage: /backup_now &lt;target&gt;\nTargets: "+strings.Join(targets, ", "))
+
+		return
+	}
+
+	if !contains(targets, target) {
+		b.reply(chatId, fmt.Sprintf("Target <b>%s</b> is not found, targets: %s", html.EscapeString(target), strings.Join(targets, ", ")))
+
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf("Run backup of <b>%s</b> now?", strings.ToUpper(target)))
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Run backup", backupNowData(target)),
+		tgbotapi.NewInlineKeyboardButtonData("Cancel", callbackCancel),
+	))
+
+	if _, err := b.api.Send(msg); err != nil {
+		klog.Errorf("[TelegramBot] Send confirmation to chat %d: %s", chatId, err.Error())
+	}
+}
+
+// Private method for get target of button of backup run, hash of name is searched in targets with backup job
+func (b *Bot) callbackTarget(data string) (string, bool) {
+	if strings.HasPrefix(data, callbackBackupNow) {
+		return strings.TrimPrefix(data, callbackBackupNow), true
+	}
+
+	for _, target := range b.targetsWithJob(job.JobBackup) {
+		if backupNowData(target) == data {
+			return target, true
+		}
+	}
+
+	return "", false
+}
+
+// Private method for trigger confirmed backup run, result of run is replied, when run is finished
+func (b *Bot) triggerBackup(chatId int64, messageId int, target string, user *tgbotapi.User) {
+	id, done, err := b.scheduler.Trigger(target, job.JobBackup)
+	switch {
+	case errors.Is(err, job.ErrRunning):
+		b.edit(chatId, messageId, fmt.Sprintf("Backup of <b>%s</b> is not started: previous run is still running", strings.ToUpper(target)))
+
+		return
+	case err != nil:
+		b.edit(chatId, messageId, fmt.Sprintf("Backup of <b>%s</b> is not started: %s", strings.ToUpper(target), html.EscapeString(err.Error())))
+
+		return
+	}
+
+	klog.Infof("[TelegramBot] %s: Manual run %s of backup job is started by %s", target, id, userName(user))
+
+	b.edit(chatId, messageId, fmt.Sprintf("Backup of <b>%s</b> is started by %s\nUuid: <b>%s</b>",
+		strings.ToUpper(target), html.EscapeString(userName(user)), id))
+
+	go b.replyResult(chatId, id, target, done)
+}
+
+// Private method for wait run and reply its result from history
+func (b *Bot) replyResult(chatId int64, id uuid.UUID, target string, done <-chan error) {
+	if err := <-done; err != nil {
+		b.reply(chatId, fmt.Sprintf("Backup %s of <b>%s</b> is not run: %s", id, strings.ToUpper(target), html.EscapeString(err.Error())))
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	run, err := b.runs.Get(ctx, id)
+	if err != nil || run == nil {
+		// Queued run is dropped, when scheduling is stopped
+		b.reply(chatId, fmt.Sprintf("Backup %s of <b>%s</b> is finished, result is not found in history", id, strings.ToUpper(target)))
+
+		return
+	}
+
+	b.reply(chatId, fmt.Sprintf("Backup %s of <b>%s</b> is finished:\n%s", id, strings.ToUpper(target), runLine(run)))
+}
+
+// Private method for make messages of latest backups info of target or all targets, one message of each target
+// Backups info, which is not received by info runs yet, is fetched by info command
+func (b *Bot) backupsMessages(ctx context.Context, args []string) []string {
+	targets := b.targetsWithJob(job.JobInfo)
+	if len(args) > 0 {
+		if !contains(targets, args[0]) {
+			return []string{fmt.Sprintf("Target <b>%s</b> is not found, targets: %s", html.EscapeString(args[0]), strings.Join(targets, ", "))}
+		}
+		targets = args[:1]
+	}
+
+	if len(targets) == 0 {
+		return []string{"Info job is not scheduled for targets"}
+	}
+
+	var messages []string
+	for _, target := range targets {
+		info, err := b.targetBackupsInfo(ctx, target)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("Backups info of <b>%s</b> is not received: %s",
+				strings.ToUpper(target), html.EscapeString(err.Error())))
+
+			continue
+		}
+
+		msg := job.MakeTargetBackupsInfoMessage(info.Target, info.Backups)
+		msg += fmt.Sprintf("\n\nUpdated: %s", info.UpdatedAt.In(config.TimeZone).Format(dateFormat))
+		messages = append(messages, msg)
+	}
+
+	return messages
+}
+
+// Private method for get backups info of target from last info run or by info command, when it is missing
+// Info command is cancelled with ctx of bot
+func (b *Bot) targetBackupsInfo(ctx context.Context, target string) (*job.TargetBackupsInfo, error) {
+	if b.backups != nil {
+		if info := b.backups.Get(target); info != nil {
+			return info, nil
+		}
+	}
+
+	klog.Infof("[TelegramBot] %s: Backups info is not received yet, fetch it by info command", target)
+
+	backups, err := b.scheduler.FetchBackups(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job.TargetBackupsInfo{Target: target, Backups: backups, UpdatedAt: time.Now()}, nil
+}
+
+// Private method for make message of last run and next fire time of each job of target or all targets
+func (b *Bot) statusMessage(args []string) string {
+	var lines []string
+	var lastTarget string
+	for _, entry := range b.scheduler.Entries() {
+		if len(args) > 0 && entry.Target != args[0] {
+			continue
+		}
+		if entry.Target != lastTarget {
+			if lastTarget != "" {
+				lines = append(lines, "")
+			}
+			lines = append(lines, fmt.Sprintf("<b>%s</b>", strings.ToUpper(entry.Target)))
+			lastTarget = entry.Target
+		}
+
+		line := fmt.Sprintf("%s: ", entry.Job)
+		if runs := b.runs.List(entry.Target, entry.Job, 1); len(runs) > 0 {
+			line += fmt.Sprintf("<b>%s</b> %s", runs[0].Status, runs[0].StartedAt.In(config.TimeZone).Format(dateFormat))
+		} else {
+			line += "no runs"
+		}
+		if entry.Next != nil {
+			line += fmt.Sprintf(", next %s", entry.Next.In(config.TimeZone).Format(dateFormat))
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return "Jobs are not scheduled"
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Private method for make message of last runs of target or all targets, limit is second argument
+func (b *Bot) historyMessage(args []string) string {
+	target := ""
+	if len(args) > 0 {
+		target = args[0]
+	}
+
+	limit := defaultHistoryLimit
+	if len(args) > 1 {
+		value, err := strconv.Atoi(args[1])
+		if err != nil || value < 1 {
+			return "Usage: /history [target] [limit]"
+		}
+		limit = value
+		if limit > maxHistoryLimit {
+			limit = maxHistoryLimit
+		}
+	}
+
+	runs := b.runs.List(target, "", limit)
+	if len(runs) == 0 {
+		return "History of runs is empty"
+	}
+
+	lines := []string{"<b>Last runs:</b>"}
+	for _, run := range runs {
+		lines = append(lines, runLine(run))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Private method for names of targets, which have job, sorted
+func (b *Bot) targetsWithJob(jobKind string) []string {
+	var targets []string
+	for _, entry := range b.scheduler.Entries() {
+		if entry.Job == jobKind {
+			targets = append(targets, entry.Target)
+		}
+	}
+
+	return targets
+}
+
+// Help func for make data of button of backup run, long name of target is replaced by hash
+func backupNowData(target string) string {
+	data := callbackBackupNow + target
+	if len(data) <= callbackDataMaxLength {
+		return data
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(target))
+
+	return fmt.Sprintf("%s%016x", callbackBackupNowHash, hash.Sum64())
+}
+
+// Help func for make line of run in messages
+func runLine(run *job.Run) string {
+	line := fmt.Sprintf("%s %s %s: <b>%s</b>",
+		run.StartedAt.In(config.TimeZone).Format(dateFormat), strings.ToUpper(run.Target), run.Job, run.Status)
+	if run.Trigger != "" && run.Trigger != job.TriggerSchedule {
+		line += fmt.Sprintf(" (%s)", run.Trigger)
+	}
+	if run.Status == job.RunFailed && run.Reason != "" {
+		line += fmt.Sprintf(", reason: %s", html.EscapeString(run.Reason))
+	}
+
+	return line
+}
+
+// Help func for make message of commands
+func helpMessage() string {
+	msg := "<b>Commands:</b>"
+	msg += "\n/backups [target] - latest backups from last info run or by info command"
+	msg += "\n/status [target] - last run and next schedule of each job"
+	msg += "\n/backup_now [target] - run backup now, run is confirmed by button"
+	msg += "\n/history [target] [limit] - last runs of jobs"
+
+	return msg
+}
+
+// Help func for check value in list
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
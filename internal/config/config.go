@@ -3,93 +3,539 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
 )
 
 const (
 	appName = "cron_backup"
 )
 
+// Kubernetes authentication modes
+const (
+	AuthModeToken      = "token"      // K8S_HOST + K8S_AUTH_TOKEN
+	AuthModeInCluster  = "incluster"  // ServiceAccount of pod, when service runs in cluster
+	AuthModeKubeconfig = "kubeconfig" // Kubeconfig file and context, when service runs locally
+)
+
+// Objects of Kubernetes events about jobs
+const (
+	EventsObjectPod   = "pod"   // Target pod
+	EventsObjectOwner = "owner" // Owning StatefulSet of target pod, pod when it has no owner
+)
+
+// Executor modes of backup command
+const (
+	ExecutorModeExec = "exec" // Exec into database pod container
+	ExecutorModeJob  = "job"  // Create batch/v1 Job from template
+)
+
+// Policies of new run of job, when previous run is still running
+const (
+	OverlapPolicySkip    = "skip"    // New run is skipped
+	OverlapPolicyQueue   = "queue"   // New run waits finish of previous run
+	OverlapPolicyReplace = "replace" // Previous run is cancelled, new run waits its finish
+)
+
+// Policies of run of job, which was missed, while scheduling was stopped
+const (
+	CatchUpPolicySkip = "skip" // Missed run is skipped
+	CatchUpPolicyOnce = "once" // Missed run is run once on start of scheduling
+)
+
+// Stores of history of runs
+const (
+	HistoryStoreMemory    = "memory"    // History is lost on restart
+	HistoryStoreFile      = "file"      // JSON file, for example on persistent volume
+	HistoryStoreConfigMap = "configmap" // ConfigMap, for stateless deployments
+)
+
+// Roles of callers of HTTP API, each role includes permissions of previous roles
+const (
+	APIRoleViewer   = "viewer"   // List scheduled entries and history of runs
+	APIRoleOperator = "operator" // Trigger backup, info and WAL archive check runs
+	APIRoleAdmin    = "admin"    // Trigger retention and restore verification runs
+)
+
+// Modes of receiving of updates of Telegram bot commands
+const (
+	TelegramCommandsModePolling = "polling" // Long polling of Telegram Bot API
+	TelegramCommandsModeWebhook = "webhook" // Updates are sent by Telegram to webhook URL
+)
+
+// Placeholders of commands of retention and restore verification
+const (
+	BackupNamePlaceholder = "{backup}" // Name of backup
+	SQLPlaceholder        = "{sql}"    // Shell quoted SQL of verify check
+)
+
+// Failure reasons of jobs, which may be retried, same as failure reasons in job package
+var retryFailureReasons = []string{
+	"pod_not_found", "pod_not_ready", "container_not_found", "exit_code", "stream", "timeout", "output",
+}
+
+// Target name is used as environment variables prefix, so it must be a valid env name part
+var targetNameRegexp = regexp.MustCompile("^[A-Za-z][A-Za-z0-9_]*$")
+
+// Secret token of Telegram webhook: allowed symbols of Bot API, at least 32 symbols for enough entropy
+var webhookSecretRegexp = regexp.MustCompile("^[A-Za-z0-9_-]{32,256}$")
+
 // Not modify this variable!!!
 // This variable will be filled when initializing the config
 var TimeZone *time.Location
 
 type (
 	Config struct {
-		Timezone    string `envconfig:"app_timezone" default:"UTC"` // String timezone format
-		SaveLogs    bool   `envconfig:"app_save_logs" default:"false"`
-		Kubernetes  KubernetesConfig
-		Exec        ExecConfig
-		Cron        CronConfig
-		Telegram    TelegramConfig
-		FileStorage FileStorageConfig
+		Timezone    string   `json:"timezone" envconfig:"app_timezone"` // String timezone format
+		SaveLogs    bool     `json:"save_logs" envconfig:"app_save_logs"`
+		TargetNames []string `json:"-" envconfig:"app_targets"` // Names of backup targets, example: main,analytics
+		// Time for wait running jobs on shutdown, after it running jobs are cancelled
+		ShutdownGracePeriod Duration             `json:"shutdown_grace_period" envconfig:"app_shutdown_grace_period"`
+		Kubernetes          KubernetesConfig     `json:"kubernetes"`
+		LeaderElection      LeaderElectionConfig `json:"leader_election"`
+		Discovery           DiscoveryConfig      `json:"discovery"`
+		Controller          ControllerConfig     `json:"controller"`
+		History             HistoryConfig        `json:"history"`
+		API                 APIConfig            `json:"api"`
+		Telegram            TelegramConfig       `json:"telegram"`
+		FileStorage         FileStorageConfig    `json:"file_storage"`
+		// Filled from config file and TargetNames, each target reads variables with prefix <NAME>_
+		Targets []TargetConfig `json:"targets" ignored:"true"`
 	}
 
 	KubernetesConfig struct {
 		// Kind default Pod
-		ApiVersion    string `default:"v1"`
-		Host          string `envconfig:"k8s_host" required:"true"`
-		Insecure      bool   `envconfig:"k8s_insecure" default:"true"`
-		BearerToken   string `envconfig:"k8s_auth_token" required:"true"`
-		Namespace     string `envconfig:"k8s_namespace" required:"true"`
-		LabelSelector string `envconfig:"k8s_label_selector" required:"true"`
-		ContainerName string `envconfig:"k8s_pod_container_name" required:"true"`
+		ApiVersion  string `json:"api_version"`
+		AuthMode    string `json:"auth_mode" envconfig:"k8s_auth_mode"`
+		Host        string `json:"host" envconfig:"k8s_host"`
+		Insecure    bool   `json:"insecure" envconfig:"k8s_insecure"`
+		BearerToken string `json:"bearer_token" envconfig:"k8s_auth_token"`
+		// Used in kubeconfig mode, empty values mean default loading rules and current context
+		Kubeconfig string `json:"kubeconfig" envconfig:"k8s_kubeconfig"`
+		Context    string `json:"context" envconfig:"k8s_context"`
+		// Read pods from informer cache instead of list on each run, requires watch access to pods
+		PodCacheEnabled bool `json:"pod_cache_enabled" envconfig:"k8s_pod_cache_enabled"`
+		// Record core/v1 Events about jobs
+		EventsEnabled bool   `json:"events_enabled" envconfig:"k8s_events_enabled"`
+		EventsObject  string `json:"events_object" envconfig:"k8s_events_object"`
+	}
+
+	// Leader election by coordination.k8s.io Lease, only leader replica schedules jobs
+	LeaderElectionConfig struct {
+		Enabled   bool   `json:"enabled" envconfig:"k8s_leader_election_enabled"`
+		LeaseName string `json:"lease_name" envconfig:"k8s_leader_election_lease_name"`
+		Namespace string `json:"namespace" envconfig:"k8s_leader_election_namespace"`
+		// Unique name of replica, hostname when empty
+		Identity      string   `json:"identity" envconfig:"k8s_leader_election_identity"`
+		LeaseDuration Duration `json:"lease_duration" envconfig:"k8s_leader_election_lease_duration"`
+		RenewDeadline Duration `json:"renew_deadline" envconfig:"k8s_leader_election_renew_deadline"`
+		RetryPeriod   Duration `json:"retry_period" envconfig:"k8s_leader_election_retry_period"`
+	}
+
+	// Discovery of targets by annotations of StatefulSets and standalone pods
+	DiscoveryConfig struct {
+		Enabled bool `json:"enabled" envconfig:"k8s_discovery_enabled"`
+		// Namespaces for search, all namespaces when empty
+		Namespaces []string `json:"namespaces" envconfig:"k8s_discovery_namespaces"`
+		Interval   Duration `json:"interval" envconfig:"k8s_discovery_interval"`
+		// Prefix of annotations, example: walg-backup/schedule
+		AnnotationPrefix string `json:"annotation_prefix" envconfig:"k8s_discovery_annotation_prefix"`
+		// Default values of discovered targets, variables without prefix are applied over it
+		Template *TargetConfig `json:"template" ignored:"true"`
+	}
+
+	// Controller of BackupSchedule custom resources
+	ControllerConfig struct {
+		Enabled bool `json:"enabled" envconfig:"k8s_controller_enabled"`
+		// Namespace of watched resources, all namespaces when empty
+		Namespace string `json:"namespace" envconfig:"k8s_controller_namespace"`
+		// Namespaces, in which resources are scheduled, all watched namespaces when empty
+		// Resource runs its commands in pods of own namespace, so only trusted namespaces should be allowed
+		AllowedNamespaces []string `json:"allowed_namespaces" envconfig:"k8s_controller_allowed_namespaces"`
+	}
+
+	// History of finished runs of jobs of all targets
+	HistoryConfig struct {
+		Store string `json:"store" envconfig:"history_store"`
+		// Path of JSON file in file store
+		Path string `json:"path" envconfig:"history_path"`
+		// ConfigMap of configmap store
+		ConfigMapName string `json:"configmap_name" envconfig:"history_configmap_name"`
+		Namespace     string `json:"namespace" envconfig:"history_configmap_namespace"`
+		// Newest runs, which are kept for each job of target
+		MaxRuns int `json:"max_runs" envconfig:"history_max_runs"`
+		// Older runs are removed, 0 disables limit
+		MaxAge Duration `json:"max_age" envconfig:"history_max_age"`
+	}
+
+	// HTTP API for manual runs of jobs and list of scheduled entries
+	APIConfig struct {
+		Enabled bool   `json:"enabled" envconfig:"api_enabled"`
+		Address string `json:"address" envconfig:"api_address"`
+		// Requests without valid token or client certificate are rejected
+		AuthEnabled bool `json:"auth_enabled" envconfig:"api_auth_enabled"`
+		// Directory of mounted Secret, name of each file is name of caller, content is its bearer token
+		TokensDir string `json:"tokens_dir" envconfig:"api_auth_tokens_dir"`
+		// Roles by names of callers from tokens and common names of client certificates
+		// Example: ci:operator,grafana:viewer
+		Roles map[string]string `json:"roles" envconfig:"api_auth_roles"`
+		// Server certificate, API is served over HTTPS when it is set
+		TLSCertFile string `json:"tls_cert_file" envconfig:"api_tls_cert_file"`
+		TLSKeyFile  string `json:"tls_key_file" envconfig:"api_tls_key_file"`
+		// CA of client certificates, enables mTLS authentication
+		ClientCAFile string `json:"client_ca_file" envconfig:"api_tls_client_ca_file"`
+	}
+
+	// TargetConfig - one Postgres cluster, which will be backed up by own jobs
+	TargetConfig struct {
+		Name         string                     `json:"name" ignored:"true"`
+		Pod          PodConfig                  `json:"pod"`
+		Exec         ExecConfig                 `json:"exec"`
+		Executor     ExecutorConfig             `json:"executor"`
+		Retry        RetryConfig                `json:"retry"`
+		Overlap      OverlapConfig              `json:"overlap"`
+		CatchUp      CatchUpConfig              `json:"catch_up"`
+		Retention    RetentionConfig            `json:"retention"`
+		Verify       VerifyConfig               `json:"verify"`
+		SLA          SLAConfig                  `json:"sla"`
+		Cron         CronConfig                 `json:"cron"`
+		Notification TelegramNotificationConfig `json:"notification"`
+	}
+
+	PodConfig struct {
+		Namespace     string `json:"namespace" envconfig:"k8s_namespace"`
+		LabelSelector string `json:"label_selector" envconfig:"k8s_label_selector"`
+		// Optional, example: metadata.name=db-0
+		FieldSelector string `json:"field_selector" envconfig:"k8s_field_selector"`
+		ContainerName string `json:"container_name" envconfig:"k8s_pod_container_name"`
+		// Selection by role label, for example spilo-role of Patroni
+		RoleLabel     string   `json:"role_label" envconfig:"k8s_role_label"`
+		RolePolicy    string   `json:"role_policy" envconfig:"k8s_role_policy"`
+		LeaderValues  []string `json:"leader_values" envconfig:"k8s_role_leader_values"`
+		ReplicaValues []string `json:"replica_values" envconfig:"k8s_role_replica_values"`
 	}
 
 	ExecConfig struct {
-		Backup string `envconfig:"exec_backup" required:"true"`
-		Info   string `envconfig:"exec_info" default:"echo 1"`
+		Backup string `json:"backup" envconfig:"exec_backup"`
+		Info   string `json:"info" envconfig:"exec_info"`
+		// Check of WAL archive with JSON output, it is executed, when cron wal verify is set
+		WalVerify string `json:"wal_verify" envconfig:"exec_wal_verify"`
+		// Max duration of command, after it command is cancelled
+		BackupTimeout    Duration `json:"backup_timeout" envconfig:"exec_backup_timeout"`
+		InfoTimeout      Duration `json:"info_timeout" envconfig:"exec_info_timeout"`
+		WalVerifyTimeout Duration `json:"wal_verify_timeout" envconfig:"exec_wal_verify_timeout"`
+	}
+
+	// Executor of backup command, info command is always executed in database pod
+	ExecutorConfig struct {
+		Mode string `json:"mode" envconfig:"executor_mode"`
+		// Path to batch/v1 Job manifest, metadata.name is used as prefix of Job names
+		JobTemplate string `json:"job_template" envconfig:"executor_job_template"`
+		// Container of Job template for command, first container when empty
+		JobContainer string `json:"job_container" envconfig:"executor_job_container"`
+	}
+
+	// Retry of failed runs of backup and info jobs, each attempt has own timeout
+	RetryConfig struct {
+		// Attempts including first, 1 means without retries
+		MaxAttempts int `json:"max_attempts" envconfig:"retry_max_attempts"`
+		// Delay before second attempt, it is doubled before each next attempt up to max
+		InitialBackoff Duration `json:"initial_backoff" envconfig:"retry_initial_backoff"`
+		MaxBackoff     Duration `json:"max_backoff" envconfig:"retry_max_backoff"`
+		// Failure reasons, which are retried
+		RetryOn []string `json:"retry_on" envconfig:"retry_on"`
+	}
+
+	// Overlap of runs of one job, for example next backup by cron while previous backup-push is running
+	OverlapConfig struct {
+		Policy string `json:"policy" envconfig:"overlap_policy"`
+		// Notify skipped runs to chats of job notifications, when they are enabled
+		NotifySkipped bool `json:"notify_skipped" envconfig:"overlap_notify_skipped"`
+	}
+
+	// Catch-up of runs, which were missed, while service was down or was not leader
+	// Missed run is found by last succeeded run in history
+	CatchUpConfig struct {
+		// Policies of jobs
+		Backup    string `json:"backup" envconfig:"catchup_backup"`
+		Info      string `json:"info" envconfig:"catchup_info"`
+		Retention string `json:"retention" envconfig:"catchup_retention"`
+		Verify    string `json:"verify" envconfig:"catchup_verify"`
+		WalVerify string `json:"wal_verify" envconfig:"catchup_wal_verify"`
+		// Older missed runs are skipped
+		Window Duration `json:"window" envconfig:"catchup_window"`
+	}
+
+	// GFS retention of full backups, RetentionJob is scheduled, when cron retention is set
+	RetentionConfig struct {
+		// Newest full backups of last days, weeks and months, which are kept, 0 disables level
+		KeepDaily   int `json:"keep_daily" envconfig:"retention_keep_daily"`
+		KeepWeekly  int `json:"keep_weekly" envconfig:"retention_keep_weekly"`
+		KeepMonthly int `json:"keep_monthly" envconfig:"retention_keep_monthly"`
+		// Result is only reported, delete and mark commands are not executed
+		DryRun bool `json:"dry_run" envconfig:"retention_dry_run"`
+		// Kept backups are marked permanent, permanent backups, which are not kept, are unmarked and deleted
+		// When disabled, permanent backups are always kept and not counted by policy
+		MarkPermanent bool `json:"mark_permanent" envconfig:"retention_mark_permanent"`
+		// Commands in database pod, {backup} is replaced by backup name
+		List    string   `json:"list" envconfig:"retention_exec_list"`
+		Delete  string   `json:"delete" envconfig:"retention_exec_delete"`
+		Mark    string   `json:"mark" envconfig:"retention_exec_mark"`
+		Unmark  string   `json:"unmark" envconfig:"retention_exec_unmark"`
+		Timeout Duration `json:"timeout" envconfig:"retention_exec_timeout"`
+	}
+
+	// Restore of latest full backup in Job from template, VerifyJob is scheduled, when cron verify is set
+	// Latest full backup is selected by exec info command in database pod
+	VerifyConfig struct {
+		// Path to batch/v1 Job manifest with wal-g, Postgres and scratch volume for PGDATA
+		JobTemplate string `json:"job_template" envconfig:"verify_job_template"`
+		// Container of Job template for script, first container when empty
+		JobContainer string `json:"job_container" envconfig:"verify_job_container"`
+		// Fetch of backup and start of Postgres in recovery, {backup} is replaced by backup name
+		// Postgres must accept connections after it
+		Restore string `json:"restore" envconfig:"verify_exec_restore"`
+		// Sanity check after restore, {sql} is replaced by shell quoted SQL
+		Check string `json:"check" envconfig:"verify_exec_check"`
+		SQL   string `json:"sql" envconfig:"verify_sql"`
+		// Max duration of Job, after it Job is deleted
+		Timeout Duration `json:"timeout" envconfig:"verify_timeout"`
+	}
+
+	// Freshness SLA of backups, it is checked by InfoJob on each backups info, 0 disables check
+	SLAConfig struct {
+		// Max age of newest full backup
+		MaxFullBackupAge Duration `json:"max_full_backup_age" envconfig:"sla_max_full_backup_age"`
+		// Max age of newest backup, full or incremental
+		MaxBackupAge Duration `json:"max_backup_age" envconfig:"sla_max_backup_age"`
 	}
 
 	CronConfig struct {
-		Backup string `envconfig:"cron_backup" required:"true"`
-		Info   string `envconfig:"cron_info"`
+		Backup    string `json:"backup" envconfig:"cron_backup"`
+		Info      string `json:"info" envconfig:"cron_info"`
+		Retention string `json:"retention" envconfig:"cron_retention"`
+		Verify    string `json:"verify" envconfig:"cron_verify"`
+		WalVerify string `json:"wal_verify" envconfig:"cron_wal_verify"`
 	}
 
 	TelegramConfig struct {
-		ApiEndpoint  string `envconfig:"tg_bot_api_endpoint" default:"https://api.telegram.org/bot%s/%s"`
-		HttpProxy    string `envconfig:"tg_bot_http_proxy"`
-		BotToken     string `envconfig:"tg_bot_token"`
-		Notification TelegramNotificationConfig
+		ApiEndpoint string `json:"api_endpoint" envconfig:"tg_bot_api_endpoint"`
+		HttpProxy   string `json:"http_proxy" envconfig:"tg_bot_http_proxy"`
+		BotToken    string `json:"bot_token" envconfig:"tg_bot_token"`
+
+		Commands TelegramCommandsConfig `json:"commands"`
+	}
+
+	// Commands of Telegram bot: /backups, /status, /backup_now, /history
+	TelegramCommandsConfig struct {
+		Enabled bool `json:"enabled" envconfig:"tg_commands_enabled"`
+		// Whitelist of chats, commands of other chats are rejected
+		ChatIds []int64 `json:"chats" envconfig:"tg_commands_chats" split_words:"true"`
+		Mode    string  `json:"mode" envconfig:"tg_commands_mode"`
+		// Public URL of webhook
+		WebhookURL     string `json:"webhook_url" envconfig:"tg_commands_webhook_url"`
+		WebhookAddress string `json:"webhook_address" envconfig:"tg_commands_webhook_address"`
+		// Secret token of webhook, Telegram sends it in header of each update, other requests are rejected
+		WebhookSecret string `json:"webhook_secret" envconfig:"tg_commands_webhook_secret"`
 	}
 
 	TelegramNotificationConfig struct {
-		Backup TelegramNotificationBackupConfig
-		Info   TelegramNotificationInfoConfig
+		Backup    TelegramNotificationBackupConfig    `json:"backup"`
+		Info      TelegramNotificationInfoConfig      `json:"info"`
+		Retention TelegramNotificationRetentionConfig `json:"retention"`
+		Verify    TelegramNotificationVerifyConfig    `json:"verify"`
+		SLA       TelegramNotificationSLAConfig       `json:"sla"`
 	}
 
 	TelegramNotificationBackupConfig struct {
-		Enabled bool    `envconfig:"tg_backup_notification_enabled" default:"false"`
-		ChatIds []int64 `envconfig:"tg_backup_notification_chats" split_words:"true"`
+		Enabled bool    `json:"enabled" envconfig:"tg_backup_notification_enabled"`
+		ChatIds []int64 `json:"chats" envconfig:"tg_backup_notification_chats" split_words:"true"`
+		// Chats for failed backups with sound, chats of backup notifications are used, when it is empty
+		FailureChatIds []int64 `json:"failure_chats" envconfig:"tg_backup_failure_notification_chats" split_words:"true"`
 	}
 
 	TelegramNotificationInfoConfig struct {
-		Enabled bool    `envconfig:"tg_info_notification_enabled" default:"false"`
-		ChatIds []int64 `envconfig:"tg_info_notification_chats" split_words:"true"`
+		Enabled bool    `json:"enabled" envconfig:"tg_info_notification_enabled"`
+		ChatIds []int64 `json:"chats" envconfig:"tg_info_notification_chats" split_words:"true"`
+	}
+
+	TelegramNotificationRetentionConfig struct {
+		Enabled bool    `json:"enabled" envconfig:"tg_retention_notification_enabled"`
+		ChatIds []int64 `json:"chats" envconfig:"tg_retention_notification_chats" split_words:"true"`
+	}
+
+	TelegramNotificationVerifyConfig struct {
+		Enabled bool    `json:"enabled" envconfig:"tg_verify_notification_enabled"`
+		ChatIds []int64 `json:"chats" envconfig:"tg_verify_notification_chats" split_words:"true"`
+	}
+
+	// Violations of SLA are sent with sound, recoveries are sent silently
+	TelegramNotificationSLAConfig struct {
+		Enabled bool    `json:"enabled" envconfig:"tg_sla_notification_enabled"`
+		ChatIds []int64 `json:"chats" envconfig:"tg_sla_notification_chats" split_words:"true"`
 	}
 
 	FileStorageConfig struct {
-		Endpoint  string `envconfig:"fs_host"`
-		Bucket    string `envconfig:"fs_bucket"`
-		AccessKey string `envconfig:"fs_access_key"`
-		SecretKey string `envconfig:"fs_secret_key"`
-		Secure    bool   `envconfig:"fs_secure" default:"true"`
+		Endpoint  string `json:"host" envconfig:"fs_host"`
+		Bucket    string `json:"bucket" envconfig:"fs_bucket"`
+		AccessKey string `json:"access_key" envconfig:"fs_access_key"`
+		SecretKey string `json:"secret_key" envconfig:"fs_secret_key"`
+		Secure    bool   `json:"secure" envconfig:"fs_secure"`
 	}
 )
 
-func Init(dotenv func()) (*Config, error) {
-	var cfg Config
+// Config with default values, config file and environment variables are applied over it
+func newConfig() *Config {
+	return &Config{
+		Timezone:            "UTC",
+		ShutdownGracePeriod: Duration(30 * time.Second),
+		Kubernetes: KubernetesConfig{
+			ApiVersion:   "v1",
+			AuthMode:     AuthModeToken,
+			Insecure:     true,
+			EventsObject: EventsObjectOwner,
+		},
+		LeaderElection: LeaderElectionConfig{
+			LeaseName:     "walg-k8s-cron-backup",
+			LeaseDuration: Duration(15 * time.Second),
+			RenewDeadline: Duration(10 * time.Second),
+			RetryPeriod:   Duration(2 * time.Second),
+		},
+		Discovery: DiscoveryConfig{
+			Interval:         Duration(time.Minute),
+			AnnotationPrefix: "walg-backup",
+		},
+		History: HistoryConfig{
+			Store:         HistoryStoreMemory,
+			Path:          "/var/lib/walg-k8s-cron-backup/history.json",
+			ConfigMapName: "walg-k8s-cron-backup-history",
+			MaxRuns:       100,
+		},
+		API: APIConfig{
+			Address:     ":8080",
+			AuthEnabled: true,
+		},
+		Telegram: TelegramConfig{
+			ApiEndpoint: "https://api.telegram.org/bot%s/%s",
+			Commands: TelegramCommandsConfig{
+				Mode:           TelegramCommandsModePolling,
+				WebhookAddress: ":8443",
+			},
+		},
+		FileStorage: FileStorageConfig{
+			Secure: true,
+		},
+	}
+}
+
+// Target config with default values
+func NewTargetConfig(name string) TargetConfig {
+	return TargetConfig{
+		Name: name,
+		Pod: PodConfig{
+			RolePolicy:    kube.RolePolicyAny,
+			LeaderValues:  []string{"master", "primary"},
+			ReplicaValues: []string{"replica"},
+		},
+		Exec: ExecConfig{
+			Info:             "echo 1",
+			WalVerify:        "wal-g wal-verify integrity timeline --json",
+			BackupTimeout:    Duration(24 * time.Hour),
+			InfoTimeout:      Duration(10 * time.Minute),
+			WalVerifyTimeout: Duration(30 * time.Minute),
+		},
+		Executor: ExecutorConfig{
+			Mode: ExecutorModeExec,
+		},
+		Retry: RetryConfig{
+			MaxAttempts:    1,
+			InitialBackoff: Duration(time.Minute),
+			MaxBackoff:     Duration(30 * time.Minute),
+			RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+		},
+		Overlap: OverlapConfig{
+			Policy: OverlapPolicySkip,
+		},
+		CatchUp: CatchUpConfig{
+			Backup:    CatchUpPolicySkip,
+			Info:      CatchUpPolicySkip,
+			Retention: CatchUpPolicySkip,
+			Verify:    CatchUpPolicySkip,
+			WalVerify: CatchUpPolicySkip,
+			Window:    Duration(24 * time.Hour),
+		},
+		Retention: RetentionConfig{
+			List:    "wal-g backup-list --json --detail",
+			Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+			Mark:    "wal-g backup-mark {backup}",
+			Unmark:  "wal-g backup-mark -i {backup}",
+			Timeout: Duration(time.Hour),
+		},
+		Verify: VerifyConfig{
+			Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+				` && touch "$PGDATA/recovery.signal"` +
+				` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+				` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+				` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+			Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+			SQL:     "SELECT 1",
+			Timeout: Duration(6 * time.Hour),
+		},
+	}
+}
+
+// Init config with priority: environment variables > config file > default values
+// When configFile is empty, path is read from APP_CONFIG_FILE variable, file is optional
+func Init(dotenv func(), configFile string) (*Config, error) {
+	cfg := newConfig()
 
 	dotenv()
 
+	if configFile == "" {
+		configFile = os.Getenv("APP_CONFIG_FILE")
+	}
+
+	// Parse variables from config file or return err
+	if configFile != "" {
+		if err := cfg.readFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+
 	// Parse variables from environment or return err
-	err := envconfig.Process(appName, &cfg)
+	err := envconfig.Process(appName, cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	// Parse targets variables from environment or return err
+	// With discovery or controller single target without prefix is not built,
+	// its variables are defaults of discovered targets
+	if !(cfg.Discovery.Enabled || cfg.Controller.Enabled) || len(cfg.TargetNames) > 0 || len(cfg.Targets) > 0 {
+		cfg.Targets, err = processTargets(cfg.TargetNames, cfg.Targets)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Discovery.Enabled {
+		// Template of config file is not overridden by variables without prefix
+		legacy := cfg.Discovery.Template == nil
+		if legacy {
+			template := NewTargetConfig("")
+			cfg.Discovery.Template = &template
+		}
+		if err := cfg.Discovery.Template.process(appName, legacy); err != nil {
+			return nil, err
+		}
+	}
+
 	// Parse timezone from cfg.tz or return err
 	TimeZone, err = time.LoadLocation(cfg.Timezone)
 	if err != nil {
@@ -100,16 +546,195 @@ func Init(dotenv func()) (*Config, error) {
 		return nil, err
 	}
 
-	return &cfg, nil
+	return cfg, nil
+}
+
+// Private func for merge targets from config file with targets from environment
+// When no targets passed, single target is built from variables without prefix
+func processTargets(names []string, targets []TargetConfig) ([]TargetConfig, error) {
+	if len(names) < 1 && len(targets) < 1 {
+		target := NewTargetConfig("")
+
+		if err := target.process(appName, true); err != nil {
+			return nil, err
+		}
+		target.Name = target.Pod.Namespace
+
+		// Empty namespace is reported by validate as required variable
+		if target.Name != "" {
+			if err := validateTargetName(target.Name, nil); err != nil {
+				return nil, fmt.Errorf("%s, it is namespace of single target, declare named target by APP_TARGETS", err.Error())
+			}
+		}
+
+		return []TargetConfig{target}, nil
+	}
+
+	// Targets of config file are not overridden by variables without prefix
+	fileTargets := len(targets)
+
+	// Targets from APP_TARGETS, which are not declared in config file
+	for i, name := range names {
+		if findTarget(targets, name) == nil {
+			targets = append(targets, NewTargetConfig(name))
+		} else if containsString(names[:i], name) {
+			return nil, fmt.Errorf("Target name %q is duplicated", name)
+		}
+	}
+
+	seen := make(map[string]bool, len(targets))
+	for i := range targets {
+		target := &targets[i]
+
+		if err := validateTargetName(target.Name, seen); err != nil {
+			return nil, err
+		}
+
+		if err := target.process(target.Name, i >= fileTargets); err != nil {
+			return nil, fmt.Errorf("Target %s: %s", target.Name, err.Error())
+		}
+	}
+
+	return targets, nil
+}
+
+// Private func for check charset of target name and that name is not in seen, name is added to seen
+// Nil seen is used for single target
+func validateTargetName(name string, seen map[string]bool) error {
+	if !targetNameRegexp.MatchString(name) {
+		return fmt.Errorf("Target name %q is invalid, allowed only latin letters, digits and underscore", name)
+	}
+	if seen[name] {
+		return fmt.Errorf("Target name %q is duplicated", name)
+	}
+	if seen != nil {
+		seen[name] = true
+	}
+
+	return nil
+}
+
+// Private func for search target by name
+func findTarget(targets []TargetConfig, name string) *TargetConfig {
+	for i := range targets {
+		if targets[i].Name == name {
+			return &targets[i]
+		}
+	}
+
+	return nil
+}
+
+// Private func for check string is in list
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Private method for parse target variables with prefix
+// Variable <PREFIX>_K8S_NAMESPACE has priority, K8S_NAMESPACE is used as fallback, when legacy is true
+// Without legacy values of config file are kept, when variable with prefix is not set
+func (tcfg *TargetConfig) process(prefix string, legacy bool) error {
+	sections := []interface{}{
+		&tcfg.Pod,
+		&tcfg.Exec,
+		&tcfg.Executor,
+		&tcfg.Retry,
+		&tcfg.Overlap,
+		&tcfg.CatchUp,
+		&tcfg.Retention,
+		&tcfg.Verify,
+		&tcfg.SLA,
+		&tcfg.Cron,
+		&tcfg.Notification.Backup,
+		&tcfg.Notification.Info,
+		&tcfg.Notification.Retention,
+		&tcfg.Notification.Verify,
+		&tcfg.Notification.SLA,
+	}
+	for _, section := range sections {
+		if err := processSection(prefix, section, legacy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Private func for parse variables of section with prefix
+// envconfig falls back to variable without prefix, so without legacy fields,
+// which have no variable with prefix, are restored after parse
+func processSection(prefix string, section interface{}, legacy bool) error {
+	value := reflect.ValueOf(section).Elem()
+	before := reflect.New(value.Type()).Elem()
+	before.Set(value)
+
+	if err := envconfig.Process(prefix, section); err != nil {
+		return err
+	}
+	if legacy {
+		return nil
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		tag := value.Type().Field(i).Tag.Get("envconfig")
+		if tag == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(strings.ToUpper(prefix + "_" + tag)); !ok {
+			value.Field(i).Set(before.Field(i))
+		}
+	}
+
+	return nil
 }
 
 func (cfg *Config) validate() error {
+	if err := cfg.Kubernetes.validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.LeaderElection.validate(); err != nil {
+		return err
+	}
+	if err := cfg.History.validate(); err != nil {
+		return err
+	}
+	if cfg.API.Enabled {
+		if err := cfg.API.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, target := range cfg.Targets {
+		if err := target.validate(); err != nil {
+			return fmt.Errorf("Target %s: %s", target.Name, err.Error())
+		}
+		// Missed runs are found by last succeeded run, memory history is empty after restart
+		if target.CatchUp.Enabled() && cfg.History.Store == HistoryStoreMemory {
+			return fmt.Errorf("Target %s: Catch-up requires %s or %s history store", target.Name, HistoryStoreFile, HistoryStoreConfigMap)
+		}
+	}
+
 	// When one of telegram notifications are enabled - required bot token
-	if cfg.Telegram.NotificationsEnabled() {
+	if cfg.NotificationsEnabled() {
 		if cfg.Telegram.BotToken == "" {
 			return errors.New("Telegram bot token is required, when one of notifications enable is true")
 		}
 	}
+	if cfg.Telegram.Commands.Enabled {
+		if cfg.Telegram.BotToken == "" {
+			return errors.New("Telegram bot token is required, when bot commands are enabled")
+		}
+		if err := cfg.Telegram.Commands.validate(); err != nil {
+			return err
+		}
+	}
 
 	// When save logs is true, file storage environment are required
 	if cfg.FileStorageRequired() {
@@ -121,20 +746,409 @@ func (cfg *Config) validate() error {
 	}
 
 	// When save logs is enabled or telegram info notifications are enabled - cron.Info is required
-	if cfg.CronInfoRequired() {
-		if cfg.Cron.Info == "" {
-			return errors.New("If save logs is enabled or telegram info notifications are enabled: cron info is required")
+	for _, target := range cfg.Targets {
+		if err := target.validateInfo(cfg.SaveLogs); err != nil {
+			return fmt.Errorf("Target %s: %s", target.Name, err.Error())
 		}
-		if cfg.Exec.Info == "" {
-			return errors.New("If save logs is enabled or telegram info notifications are enabled: exec info is required")
+	}
+
+	if err := cfg.Discovery.validate(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Check target, which is built at runtime, with fields of config, which targets depend on
+func (cfg *Config) ValidateTarget(target *TargetConfig) error {
+	if err := validateTargetName(target.Name, nil); err != nil {
+		return err
+	}
+	if err := target.validate(); err != nil {
+		return err
+	}
+	if err := target.validateInfo(cfg.SaveLogs); err != nil {
+		return err
+	}
+
+	// Telegram bot is created on start, when token is passed
+	if target.notificationsEnabled() && cfg.Telegram.BotToken == "" {
+		return errors.New("Telegram bot token is required, when one of notifications enable is true")
+	}
+
+	return nil
+}
+
+// Private method for check fields of InfoJob, when it is required
+func (tcfg *TargetConfig) validateInfo(saveLogs bool) error {
+	if !tcfg.CronInfoRequired(saveLogs) {
+		return nil
+	}
+
+	if tcfg.Cron.Info == "" {
+		return errors.New("If save logs, telegram info notifications or SLA are enabled: cron info is required")
+	}
+	if tcfg.Exec.Info == "" {
+		return errors.New("If save logs, telegram info notifications or SLA are enabled: exec info is required")
+	}
+
+	return nil
+}
+
+// Private method for check fields required by auth mode
+func (kcfg *KubernetesConfig) validate() error {
+	switch kcfg.AuthMode {
+	case AuthModeToken:
+		if kcfg.Host == "" {
+			return errors.New("Kubernetes host is required in token auth mode")
+		}
+		if kcfg.BearerToken == "" {
+			return errors.New("Kubernetes bearer token is required in token auth mode")
+		}
+	case AuthModeInCluster, AuthModeKubeconfig:
+	default:
+		return fmt.Errorf("Kubernetes auth mode %q is unknown, allowed: %s, %s, %s",
+			kcfg.AuthMode, AuthModeToken, AuthModeInCluster, AuthModeKubeconfig)
+	}
+
+	if kcfg.EventsObject != EventsObjectPod && kcfg.EventsObject != EventsObjectOwner {
+		return fmt.Errorf("Kubernetes events object %q is unknown, allowed: %s, %s",
+			kcfg.EventsObject, EventsObjectPod, EventsObjectOwner)
+	}
+
+	return nil
+}
+
+// Private method for check lease fields, when leader election is enabled
+func (lecfg *LeaderElectionConfig) validate() error {
+	if !lecfg.Enabled {
+		return nil
+	}
+
+	if lecfg.LeaseName == "" {
+		return errors.New("Leader election lease name is required")
+	}
+	if lecfg.Namespace == "" {
+		return errors.New("Leader election namespace is required")
+	}
+	// Same rules as in client-go leaderelection, retry period is jittered by factor 1.2
+	if lecfg.RetryPeriod <= 0 {
+		return errors.New("Leader election retry period must be positive")
+	}
+	if lecfg.LeaseDuration <= lecfg.RenewDeadline {
+		return errors.New("Leader election lease duration must be greater than renew deadline")
+	}
+	if time.Duration(lecfg.RenewDeadline) <= time.Duration(1.2*float64(lecfg.RetryPeriod)) {
+		return errors.New("Leader election renew deadline must be greater than 1.2 * retry period")
+	}
+
+	return nil
+}
+
+// Private method for check chats and receiving mode, when bot commands are enabled
+func (tccfg *TelegramCommandsConfig) validate() error {
+	if len(tccfg.ChatIds) == 0 {
+		return errors.New("Telegram commands chats are required, when bot commands are enabled")
+	}
+
+	switch tccfg.Mode {
+	case TelegramCommandsModePolling:
+	case TelegramCommandsModeWebhook:
+		if tccfg.WebhookURL == "" || tccfg.WebhookAddress == "" {
+			return errors.New("Telegram commands webhook URL and address are required in webhook mode")
+		}
+		// Telegram sends updates only to HTTPS URLs
+		webhookURL, err := url.Parse(tccfg.WebhookURL)
+		if err != nil || webhookURL.Scheme != "https" || webhookURL.Host == "" {
+			return fmt.Errorf("Telegram commands webhook URL %q must be absolute HTTPS URL", tccfg.WebhookURL)
+		}
+		// Path of URL is pattern of webhook handler, empty pattern is not allowed
+		if webhookURL.Path == "" {
+			return fmt.Errorf("Telegram commands webhook URL %q must have path, e.g. /telegram", tccfg.WebhookURL)
+		}
+		// Any request to webhook is handled as update, so it is authenticated by secret token
+		if !webhookSecretRegexp.MatchString(tccfg.WebhookSecret) {
+			return errors.New("Telegram commands webhook secret is required in webhook mode, 32-256 symbols A-Z, a-z, 0-9, _ and -")
+		}
+	default:
+		return fmt.Errorf("Telegram commands mode %q is unknown, allowed: %s, %s",
+			tccfg.Mode, TelegramCommandsModePolling, TelegramCommandsModeWebhook)
+	}
+
+	return nil
+}
+
+// Private method for check listener, TLS and auth fields, when API is enabled
+func (acfg *APIConfig) validate() error {
+	if acfg.Address == "" {
+		return errors.New("API address is required, when API is enabled")
+	}
+	if (acfg.TLSCertFile == "") != (acfg.TLSKeyFile == "") {
+		return errors.New("API TLS certificate and key files must be set together")
+	}
+	if acfg.ClientCAFile != "" && acfg.TLSCertFile == "" {
+		return errors.New("API TLS certificate is required for client certificates")
+	}
+	if acfg.AuthEnabled && acfg.TokensDir == "" && acfg.ClientCAFile == "" {
+		return errors.New("API tokens dir or client CA file is required, when API auth is enabled")
+	}
+	for name, role := range acfg.Roles {
+		switch role {
+		case APIRoleViewer, APIRoleOperator, APIRoleAdmin:
+		default:
+			return fmt.Errorf("API role %q of %s is unknown, allowed: %s, %s, %s",
+				role, name, APIRoleViewer, APIRoleOperator, APIRoleAdmin)
+		}
+	}
+
+	return nil
+}
+
+// Private method for check fields of history store
+func (hcfg *HistoryConfig) validate() error {
+	switch hcfg.Store {
+	case HistoryStoreMemory:
+	case HistoryStoreFile:
+		if hcfg.Path == "" {
+			return errors.New("History path is required in file store")
+		}
+	case HistoryStoreConfigMap:
+		if hcfg.ConfigMapName == "" || hcfg.Namespace == "" {
+			return errors.New("History configmap name and namespace are required in configmap store")
+		}
+	default:
+		return fmt.Errorf("History store %q is unknown, allowed: %s, %s, %s",
+			hcfg.Store, HistoryStoreMemory, HistoryStoreFile, HistoryStoreConfigMap)
+	}
+	if hcfg.MaxRuns < 1 {
+		return errors.New("History max runs must be positive")
+	}
+	if hcfg.MaxAge < 0 {
+		return errors.New("History max age must not be negative")
+	}
+
+	return nil
+}
+
+// Private method for check discovery fields, when discovery is enabled
+func (dcfg *DiscoveryConfig) validate() error {
+	if !dcfg.Enabled {
+		return nil
+	}
+
+	if dcfg.Interval <= 0 {
+		return errors.New("Discovery interval must be positive")
+	}
+	if dcfg.AnnotationPrefix == "" {
+		return errors.New("Discovery annotation prefix is required")
+	}
+
+	return nil
+}
+
+// Private method for check required target fields
+func (tcfg *TargetConfig) validate() error {
+	if tcfg.Pod.Namespace == "" {
+		return errors.New("Kubernetes namespace is required")
+	}
+	if tcfg.Pod.LabelSelector == "" && tcfg.Pod.FieldSelector == "" {
+		return errors.New("Kubernetes label selector is required")
+	}
+	if tcfg.Pod.ContainerName == "" {
+		return errors.New("Kubernetes pod container name is required")
+	}
+	switch tcfg.Pod.RolePolicy {
+	case kube.RolePolicyAny:
+	case kube.RolePolicyPreferReplica, kube.RolePolicyRequireLeader:
+		if tcfg.Pod.RoleLabel == "" {
+			return fmt.Errorf("Kubernetes role label is required for role policy %s", tcfg.Pod.RolePolicy)
+		}
+	default:
+		return fmt.Errorf("Kubernetes role policy %q is unknown, allowed: %s, %s, %s", tcfg.Pod.RolePolicy,
+			kube.RolePolicyAny, kube.RolePolicyPreferReplica, kube.RolePolicyRequireLeader)
+	}
+	if tcfg.Exec.Backup == "" {
+		return errors.New("Exec backup is required")
+	}
+	switch tcfg.Executor.Mode {
+	case ExecutorModeExec:
+	case ExecutorModeJob:
+		if tcfg.Executor.JobTemplate == "" {
+			return errors.New("Executor job template is required in job mode")
+		}
+	default:
+		return fmt.Errorf("Executor mode %q is unknown, allowed: %s, %s",
+			tcfg.Executor.Mode, ExecutorModeExec, ExecutorModeJob)
+	}
+	if tcfg.Cron.Backup == "" {
+		return errors.New("Cron backup is required")
+	}
+	if tcfg.Exec.BackupTimeout <= 0 || tcfg.Exec.InfoTimeout <= 0 || tcfg.Exec.WalVerifyTimeout <= 0 {
+		return errors.New("Exec timeouts must be positive")
+	}
+	if err := tcfg.Retry.validate(); err != nil {
+		return err
+	}
+	switch tcfg.Overlap.Policy {
+	case OverlapPolicySkip, OverlapPolicyQueue, OverlapPolicyReplace:
+	default:
+		return fmt.Errorf("Overlap policy %q is unknown, allowed: %s, %s, %s",
+			tcfg.Overlap.Policy, OverlapPolicySkip, OverlapPolicyQueue, OverlapPolicyReplace)
+	}
+	if err := tcfg.CatchUp.validate(); err != nil {
+		return err
+	}
+	if tcfg.Cron.Retention != "" {
+		if err := tcfg.Retention.validate(); err != nil {
+			return err
+		}
+	}
+	if tcfg.SLA.MaxFullBackupAge < 0 || tcfg.SLA.MaxBackupAge < 0 {
+		return errors.New("SLA max backup ages must not be negative")
+	}
+	if tcfg.Cron.WalVerify != "" && tcfg.Exec.WalVerify == "" {
+		return errors.New("Exec wal verify is required, when cron wal verify is set")
+	}
+	if tcfg.Cron.Verify != "" {
+		if err := tcfg.Verify.validate(); err != nil {
+			return err
+		}
+		// Latest full backup is selected by backups info
+		if tcfg.Exec.Info == "" {
+			return errors.New("Exec info is required, when cron verify is set")
 		}
 	}
 
 	return nil
 }
 
-func (cfg *Config) CronInfoRequired() bool {
-	return cfg.SaveLogs || cfg.Telegram.Notification.Info.Enabled
+// Private method for check catch-up policies of jobs
+func (cucfg *CatchUpConfig) validate() error {
+	for _, policy := range []string{cucfg.Backup, cucfg.Info, cucfg.Retention, cucfg.Verify, cucfg.WalVerify} {
+		if policy != CatchUpPolicySkip && policy != CatchUpPolicyOnce {
+			return fmt.Errorf("Catch-up policy %q is unknown, allowed: %s, %s", policy, CatchUpPolicySkip, CatchUpPolicyOnce)
+		}
+	}
+	if cucfg.Window <= 0 {
+		return errors.New("Catch-up window must be positive")
+	}
+
+	return nil
+}
+
+// Check catch-up policy of one of jobs is once
+func (cucfg *CatchUpConfig) Enabled() bool {
+	for _, policy := range []string{cucfg.Backup, cucfg.Info, cucfg.Retention, cucfg.Verify, cucfg.WalVerify} {
+		if policy == CatchUpPolicyOnce {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get catch-up policy of job by its kind, same as kinds of runs in job package
+func (cucfg *CatchUpConfig) Policy(job string) string {
+	switch job {
+	case "backup":
+		return cucfg.Backup
+	case "info":
+		return cucfg.Info
+	case "retention":
+		return cucfg.Retention
+	case "verify":
+		return cucfg.Verify
+	case "wal_verify":
+		return cucfg.WalVerify
+	}
+
+	return CatchUpPolicySkip
+}
+
+// Private method for check restore verification
+func (vcfg *VerifyConfig) validate() error {
+	if vcfg.JobTemplate == "" {
+		return errors.New("Verify job template is required, when cron verify is set")
+	}
+	if !strings.Contains(vcfg.Restore, BackupNamePlaceholder) {
+		return fmt.Errorf("Verify exec restore must contain %s", BackupNamePlaceholder)
+	}
+	if vcfg.Check == "" {
+		return errors.New("Verify exec check is required")
+	}
+	if vcfg.Timeout <= 0 {
+		return errors.New("Verify timeout must be positive")
+	}
+
+	return nil
+}
+
+// Private method for check retention policy and its commands
+func (rtcfg *RetentionConfig) validate() error {
+	if rtcfg.KeepDaily < 0 || rtcfg.KeepWeekly < 0 || rtcfg.KeepMonthly < 0 {
+		return errors.New("Retention keep counts must not be negative")
+	}
+	// Without kept levels all backups are deleted
+	if rtcfg.KeepDaily+rtcfg.KeepWeekly+rtcfg.KeepMonthly == 0 {
+		return errors.New("Retention must keep backups of one of levels: daily, weekly or monthly")
+	}
+	if rtcfg.List == "" {
+		return errors.New("Retention exec list is required")
+	}
+	if !strings.Contains(rtcfg.Delete, BackupNamePlaceholder) {
+		return fmt.Errorf("Retention exec delete must contain %s", BackupNamePlaceholder)
+	}
+	if rtcfg.MarkPermanent {
+		if !strings.Contains(rtcfg.Mark, BackupNamePlaceholder) || !strings.Contains(rtcfg.Unmark, BackupNamePlaceholder) {
+			return fmt.Errorf("Retention exec mark and unmark must contain %s, when mark permanent is enabled", BackupNamePlaceholder)
+		}
+	}
+	if rtcfg.Timeout <= 0 {
+		return errors.New("Retention exec timeout must be positive")
+	}
+
+	return nil
+}
+
+// Private method for check retry policy
+func (rcfg *RetryConfig) validate() error {
+	if rcfg.MaxAttempts < 1 {
+		return errors.New("Retry max attempts must be positive")
+	}
+	if rcfg.InitialBackoff <= 0 || rcfg.MaxBackoff < rcfg.InitialBackoff {
+		return errors.New("Retry initial backoff must be positive and not greater than max backoff")
+	}
+	for _, reason := range rcfg.RetryOn {
+		if !containsString(retryFailureReasons, reason) {
+			return fmt.Errorf("Retry failure reason %q is unknown, allowed: %s", reason, strings.Join(retryFailureReasons, ", "))
+		}
+	}
+
+	return nil
+}
+
+// Get kube.PodSelector of target
+func (tcfg *TargetConfig) PodSelector() *kube.PodSelector {
+	return &kube.PodSelector{
+		Namespace:     tcfg.Pod.Namespace,
+		LabelSelector: tcfg.Pod.LabelSelector,
+		FieldSelector: tcfg.Pod.FieldSelector,
+		ContainerName: tcfg.Pod.ContainerName,
+		RoleLabel:     tcfg.Pod.RoleLabel,
+		RolePolicy:    tcfg.Pod.RolePolicy,
+		LeaderValues:  tcfg.Pod.LeaderValues,
+		ReplicaValues: tcfg.Pod.ReplicaValues,
+	}
+}
+
+// Func for check InfoJob is required for target
+func (tcfg *TargetConfig) CronInfoRequired(saveLogs bool) bool {
+	return saveLogs || tcfg.Notification.Info.Enabled || tcfg.SLA.Enabled()
+}
+
+// Func for check one of SLA of backups is set
+func (scfg *SLAConfig) Enabled() bool {
+	return scfg.MaxFullBackupAge > 0 || scfg.MaxBackupAge > 0
 }
 
 func (cfg *Config) FileStorageRequired() bool {
@@ -159,7 +1173,58 @@ func (fscfg *FileStorageConfig) allRequired() error {
 	return nil
 }
 
-// Func for check telegram notifications enabled
-func (tgcfg *TelegramConfig) NotificationsEnabled() bool {
-	return tgcfg.Notification.Info.Enabled || tgcfg.Notification.Backup.Enabled
+// Private method for check one of telegram notifications of target is enabled
+func (tcfg *TargetConfig) notificationsEnabled() bool {
+	return tcfg.Notification.Backup.Enabled || tcfg.Notification.Info.Enabled ||
+		len(tcfg.Notification.Backup.FailureChatIds) > 0 || tcfg.Notification.Retention.Enabled ||
+		tcfg.Notification.Verify.Enabled || tcfg.Notification.SLA.Enabled
+}
+
+// Check resources of namespace are scheduled by controller
+func (ccfg *ControllerConfig) NamespaceAllowed(namespace string) bool {
+	if len(ccfg.AllowedNamespaces) < 1 {
+		return true
+	}
+
+	for _, allowed := range ccfg.AllowedNamespaces {
+		if allowed == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Func for check telegram notifications enabled for one of targets or for discovered targets
+// With controller notifications are enabled by resources, so bot is required, when token is passed
+func (cfg *Config) NotificationsEnabled() bool {
+	if cfg.Controller.Enabled && cfg.Telegram.BotToken != "" {
+		return true
+	}
+
+	targets := cfg.Targets
+	if cfg.Discovery.Enabled {
+		targets = append(targets[:len(targets):len(targets)], *cfg.Discovery.Template)
+	}
+
+	for _, target := range targets {
+		if target.notificationsEnabled() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get chats for notifications about failed backups
+// Failure chats are used even when start and end notifications are disabled
+func (nbcfg *TelegramNotificationBackupConfig) FailureChats() []int64 {
+	if len(nbcfg.FailureChatIds) > 0 {
+		return nbcfg.FailureChatIds
+	}
+	if nbcfg.Enabled {
+		return nbcfg.ChatIds
+	}
+
+	return nil
 }
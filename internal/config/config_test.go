@@ -2,8 +2,13 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
 )
 
 func TestInit(t *testing.T) {
@@ -29,36 +34,43 @@ func TestInit(t *testing.T) {
 			name:    "test config default values",
 			envFunc: requiredEnv,
 			want: &Config{
-				Timezone: "UTC",
-				SaveLogs: false,
-				Kubernetes: KubernetesConfig{
-					ApiVersion:    "v1",
-					Host:          "localhost",
-					Insecure:      true,
-					BearerToken:   "token",
-					Namespace:     "ns",
-					LabelSelector: "labelSelector",
-					ContainerName: "podContainerName",
+				Timezone:            "UTC",
+				ShutdownGracePeriod: Duration(30 * time.Second),
+				LeaderElection: LeaderElectionConfig{
+					LeaseName:     "walg-k8s-cron-backup",
+					LeaseDuration: Duration(15 * time.Second),
+					RenewDeadline: Duration(10 * time.Second),
+					RetryPeriod:   Duration(2 * time.Second),
 				},
-				Exec: ExecConfig{
-					Backup: "execBackup",
-					Info:   "echo 1",
+				Discovery: DiscoveryConfig{
+					Interval:         Duration(time.Minute),
+					AnnotationPrefix: "walg-backup",
 				},
-				Cron: CronConfig{
-					Backup: "cronBackup",
-					Info:   "",
+				History: HistoryConfig{
+					Store:         "memory",
+					Path:          "/var/lib/walg-k8s-cron-backup/history.json",
+					ConfigMapName: "walg-k8s-cron-backup-history",
+					MaxRuns:       100,
+				},
+				API: APIConfig{
+					Address:     ":8080",
+					AuthEnabled: true,
+				},
+				SaveLogs: false,
+				Kubernetes: KubernetesConfig{
+					ApiVersion:   "v1",
+					AuthMode:     "token",
+					EventsObject: "owner",
+					Host:         "localhost",
+					Insecure:     true,
+					BearerToken:  "token",
 				},
 				Telegram: TelegramConfig{
-					BotToken: "",
-					Notification: TelegramNotificationConfig{
-						Backup: TelegramNotificationBackupConfig{
-							Enabled: false,
-							ChatIds: nil,
-						},
-						Info: TelegramNotificationInfoConfig{
-							Enabled: false,
-							ChatIds: nil,
-						},
+					ApiEndpoint: "https://api.telegram.org/bot%s/%s",
+					BotToken:    "",
+					Commands: TelegramCommandsConfig{
+						Mode:           "polling",
+						WebhookAddress: ":8443",
 					},
 				},
 				FileStorage: FileStorageConfig{
@@ -68,6 +80,78 @@ func TestInit(t *testing.T) {
 					SecretKey: "",
 					Secure:    true,
 				},
+				Targets: []TargetConfig{
+					{
+						Name: "ns",
+						Pod: PodConfig{
+							Namespace:     "ns",
+							LabelSelector: "labelSelector",
+							ContainerName: "podContainerName",
+							RolePolicy:    "any",
+							LeaderValues:  []string{"master", "primary"},
+							ReplicaValues: []string{"replica"},
+						},
+						Exec: ExecConfig{
+							Backup:           "execBackup",
+							Info:             "echo 1",
+							WalVerify:        "wal-g wal-verify integrity timeline --json",
+							BackupTimeout:    Duration(24 * time.Hour),
+							InfoTimeout:      Duration(10 * time.Minute),
+							WalVerifyTimeout: Duration(30 * time.Minute),
+						},
+						Executor: ExecutorConfig{
+							Mode: "exec",
+						},
+						Retry: RetryConfig{
+							MaxAttempts:    1,
+							InitialBackoff: Duration(time.Minute),
+							MaxBackoff:     Duration(30 * time.Minute),
+							RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+						},
+						Overlap: OverlapConfig{
+							Policy: "skip",
+						},
+						CatchUp: CatchUpConfig{
+							Backup:    "skip",
+							Info:      "skip",
+							Retention: "skip",
+							Verify:    "skip",
+							WalVerify: "skip",
+							Window:    Duration(24 * time.Hour),
+						},
+						Retention: RetentionConfig{
+							List:    "wal-g backup-list --json --detail",
+							Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+							Mark:    "wal-g backup-mark {backup}",
+							Unmark:  "wal-g backup-mark -i {backup}",
+							Timeout: Duration(time.Hour),
+						},
+						Verify: VerifyConfig{
+							Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+								` && touch "$PGDATA/recovery.signal"` +
+								` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+								` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+								` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+							Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+							SQL:     "SELECT 1",
+							Timeout: Duration(6 * time.Hour),
+						},
+						Cron: CronConfig{
+							Backup: "cronBackup",
+							Info:   "",
+						},
+						Notification: TelegramNotificationConfig{
+							Backup: TelegramNotificationBackupConfig{
+								Enabled: false,
+								ChatIds: nil,
+							},
+							Info: TelegramNotificationInfoConfig{
+								Enabled: false,
+								ChatIds: nil,
+							},
+						},
+					},
+				},
 			},
 		},
 
@@ -95,36 +179,43 @@ func TestInit(t *testing.T) {
 				os.Setenv("TG_BOT_TOKEN", "token")
 			},
 			want: &Config{
-				Timezone: "UTC",
-				SaveLogs: false,
-				Kubernetes: KubernetesConfig{
-					ApiVersion:    "v1",
-					Host:          "localhost",
-					Insecure:      true,
-					BearerToken:   "token",
-					Namespace:     "ns",
-					LabelSelector: "labelSelector",
-					ContainerName: "podContainerName",
+				Timezone:            "UTC",
+				ShutdownGracePeriod: Duration(30 * time.Second),
+				LeaderElection: LeaderElectionConfig{
+					LeaseName:     "walg-k8s-cron-backup",
+					LeaseDuration: Duration(15 * time.Second),
+					RenewDeadline: Duration(10 * time.Second),
+					RetryPeriod:   Duration(2 * time.Second),
 				},
-				Exec: ExecConfig{
-					Backup: "execBackup",
-					Info:   "echo 1",
+				Discovery: DiscoveryConfig{
+					Interval:         Duration(time.Minute),
+					AnnotationPrefix: "walg-backup",
 				},
-				Cron: CronConfig{
-					Backup: "cronBackup",
-					Info:   "",
+				History: HistoryConfig{
+					Store:         "memory",
+					Path:          "/var/lib/walg-k8s-cron-backup/history.json",
+					ConfigMapName: "walg-k8s-cron-backup-history",
+					MaxRuns:       100,
+				},
+				API: APIConfig{
+					Address:     ":8080",
+					AuthEnabled: true,
+				},
+				SaveLogs: false,
+				Kubernetes: KubernetesConfig{
+					ApiVersion:   "v1",
+					AuthMode:     "token",
+					EventsObject: "owner",
+					Host:         "localhost",
+					Insecure:     true,
+					BearerToken:  "token",
 				},
 				Telegram: TelegramConfig{
-					BotToken: "token",
-					Notification: TelegramNotificationConfig{
-						Backup: TelegramNotificationBackupConfig{
-							Enabled: true,
-							ChatIds: nil,
-						},
-						Info: TelegramNotificationInfoConfig{
-							Enabled: false,
-							ChatIds: nil,
-						},
+					ApiEndpoint: "https://api.telegram.org/bot%s/%s",
+					BotToken:    "token",
+					Commands: TelegramCommandsConfig{
+						Mode:           "polling",
+						WebhookAddress: ":8443",
 					},
 				},
 				FileStorage: FileStorageConfig{
@@ -134,7 +225,107 @@ func TestInit(t *testing.T) {
 					SecretKey: "",
 					Secure:    true,
 				},
+				Targets: []TargetConfig{
+					{
+						Name: "ns",
+						Pod: PodConfig{
+							Namespace:     "ns",
+							LabelSelector: "labelSelector",
+							ContainerName: "podContainerName",
+							RolePolicy:    "any",
+							LeaderValues:  []string{"master", "primary"},
+							ReplicaValues: []string{"replica"},
+						},
+						Exec: ExecConfig{
+							Backup:           "execBackup",
+							Info:             "echo 1",
+							WalVerify:        "wal-g wal-verify integrity timeline --json",
+							BackupTimeout:    Duration(24 * time.Hour),
+							InfoTimeout:      Duration(10 * time.Minute),
+							WalVerifyTimeout: Duration(30 * time.Minute),
+						},
+						Executor: ExecutorConfig{
+							Mode: "exec",
+						},
+						Retry: RetryConfig{
+							MaxAttempts:    1,
+							InitialBackoff: Duration(time.Minute),
+							MaxBackoff:     Duration(30 * time.Minute),
+							RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+						},
+						Overlap: OverlapConfig{
+							Policy: "skip",
+						},
+						CatchUp: CatchUpConfig{
+							Backup:    "skip",
+							Info:      "skip",
+							Retention: "skip",
+							Verify:    "skip",
+							WalVerify: "skip",
+							Window:    Duration(24 * time.Hour),
+						},
+						Retention: RetentionConfig{
+							List:    "wal-g backup-list --json --detail",
+							Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+							Mark:    "wal-g backup-mark {backup}",
+							Unmark:  "wal-g backup-mark -i {backup}",
+							Timeout: Duration(time.Hour),
+						},
+						Verify: VerifyConfig{
+							Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+								` && touch "$PGDATA/recovery.signal"` +
+								` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+								` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+								` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+							Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+							SQL:     "SELECT 1",
+							Timeout: Duration(6 * time.Hour),
+						},
+						Cron: CronConfig{
+							Backup: "cronBackup",
+							Info:   "",
+						},
+						Notification: TelegramNotificationConfig{
+							Backup: TelegramNotificationBackupConfig{
+								Enabled: true,
+								ChatIds: nil,
+							},
+							Info: TelegramNotificationInfoConfig{
+								Enabled: false,
+								ChatIds: nil,
+							},
+						},
+					},
+				},
+			},
+		},
+
+		// Tests validate retention
+		{
+			name: "tests validate if CRON_RETENTION passed, but no retention level is kept",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("CRON_RETENTION", "0 0 3 * * *")
+			},
+			wantErr: true,
+		},
+
+		{
+			name: "tests validate if CRON_VERIFY passed, but VERIFY_JOB_TEMPLATE not passed",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("CRON_VERIFY", "0 0 5 * * 0")
+			},
+			wantErr: true,
+		},
+
+		{
+			name: "tests validate if SLA_MAX_FULL_BACKUP_AGE passed, but CRON_INFO not passed",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("SLA_MAX_FULL_BACKUP_AGE", "26h")
 			},
+			wantErr: true,
 		},
 
 		// Tests validate if save logs are enable
@@ -173,36 +364,43 @@ func TestInit(t *testing.T) {
 				os.Setenv("CRON_INFO", "cronInfo")
 			},
 			want: &Config{
-				Timezone: "UTC",
-				SaveLogs: true,
-				Kubernetes: KubernetesConfig{
-					ApiVersion:    "v1",
-					Host:          "localhost",
-					Insecure:      true,
-					BearerToken:   "token",
-					Namespace:     "ns",
-					LabelSelector: "labelSelector",
-					ContainerName: "podContainerName",
+				Timezone:            "UTC",
+				ShutdownGracePeriod: Duration(30 * time.Second),
+				LeaderElection: LeaderElectionConfig{
+					LeaseName:     "walg-k8s-cron-backup",
+					LeaseDuration: Duration(15 * time.Second),
+					RenewDeadline: Duration(10 * time.Second),
+					RetryPeriod:   Duration(2 * time.Second),
 				},
-				Exec: ExecConfig{
-					Backup: "execBackup",
-					Info:   "echo 1",
+				Discovery: DiscoveryConfig{
+					Interval:         Duration(time.Minute),
+					AnnotationPrefix: "walg-backup",
 				},
-				Cron: CronConfig{
-					Backup: "cronBackup",
-					Info:   "cronInfo",
+				History: HistoryConfig{
+					Store:         "memory",
+					Path:          "/var/lib/walg-k8s-cron-backup/history.json",
+					ConfigMapName: "walg-k8s-cron-backup-history",
+					MaxRuns:       100,
+				},
+				API: APIConfig{
+					Address:     ":8080",
+					AuthEnabled: true,
+				},
+				SaveLogs: true,
+				Kubernetes: KubernetesConfig{
+					ApiVersion:   "v1",
+					AuthMode:     "token",
+					EventsObject: "owner",
+					Host:         "localhost",
+					Insecure:     true,
+					BearerToken:  "token",
 				},
 				Telegram: TelegramConfig{
-					BotToken: "",
-					Notification: TelegramNotificationConfig{
-						Backup: TelegramNotificationBackupConfig{
-							Enabled: false,
-							ChatIds: nil,
-						},
-						Info: TelegramNotificationInfoConfig{
-							Enabled: false,
-							ChatIds: nil,
-						},
+					ApiEndpoint: "https://api.telegram.org/bot%s/%s",
+					BotToken:    "",
+					Commands: TelegramCommandsConfig{
+						Mode:           "polling",
+						WebhookAddress: ":8443",
 					},
 				},
 				FileStorage: FileStorageConfig{
@@ -212,17 +410,915 @@ func TestInit(t *testing.T) {
 					SecretKey: "secretKey",
 					Secure:    false,
 				},
+				Targets: []TargetConfig{
+					{
+						Name: "ns",
+						Pod: PodConfig{
+							Namespace:     "ns",
+							LabelSelector: "labelSelector",
+							ContainerName: "podContainerName",
+							RolePolicy:    "any",
+							LeaderValues:  []string{"master", "primary"},
+							ReplicaValues: []string{"replica"},
+						},
+						Exec: ExecConfig{
+							Backup:           "execBackup",
+							Info:             "echo 1",
+							WalVerify:        "wal-g wal-verify integrity timeline --json",
+							BackupTimeout:    Duration(24 * time.Hour),
+							InfoTimeout:      Duration(10 * time.Minute),
+							WalVerifyTimeout: Duration(30 * time.Minute),
+						},
+						Executor: ExecutorConfig{
+							Mode: "exec",
+						},
+						Retry: RetryConfig{
+							MaxAttempts:    1,
+							InitialBackoff: Duration(time.Minute),
+							MaxBackoff:     Duration(30 * time.Minute),
+							RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+						},
+						Overlap: OverlapConfig{
+							Policy: "skip",
+						},
+						CatchUp: CatchUpConfig{
+							Backup:    "skip",
+							Info:      "skip",
+							Retention: "skip",
+							Verify:    "skip",
+							WalVerify: "skip",
+							Window:    Duration(24 * time.Hour),
+						},
+						Retention: RetentionConfig{
+							List:    "wal-g backup-list --json --detail",
+							Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+							Mark:    "wal-g backup-mark {backup}",
+							Unmark:  "wal-g backup-mark -i {backup}",
+							Timeout: Duration(time.Hour),
+						},
+						Verify: VerifyConfig{
+							Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+								` && touch "$PGDATA/recovery.signal"` +
+								` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+								` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+								` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+							Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+							SQL:     "SELECT 1",
+							Timeout: Duration(6 * time.Hour),
+						},
+						Cron: CronConfig{
+							Backup: "cronBackup",
+							Info:   "cronInfo",
+						},
+						Notification: TelegramNotificationConfig{
+							Backup: TelegramNotificationBackupConfig{
+								Enabled: false,
+								ChatIds: nil,
+							},
+							Info: TelegramNotificationInfoConfig{
+								Enabled: false,
+								ChatIds: nil,
+							},
+						},
+					},
+				},
+			},
+		},
+
+		// Tests multiple targets with prefixed variables
+		{
+			name: "test config with multiple targets, unprefixed variables are used as fallback",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("APP_TARGETS", "main,analytics")
+				os.Setenv("MAIN_K8S_NAMESPACE", "mainNs")
+				os.Setenv("ANALYTICS_K8S_NAMESPACE", "analyticsNs")
+				os.Setenv("ANALYTICS_CRON_BACKUP", "analyticsCronBackup")
+				os.Setenv("ANALYTICS_TG_BACKUP_NOTIFICATION_ENABLED", "true")
+				os.Setenv("ANALYTICS_TG_BACKUP_NOTIFICATION_CHATS", "1,2")
+				os.Setenv("ANALYTICS_TG_BACKUP_FAILURE_NOTIFICATION_CHATS", "3")
+				os.Setenv("TG_BOT_TOKEN", "token")
+			},
+			want: &Config{
+				Timezone:            "UTC",
+				ShutdownGracePeriod: Duration(30 * time.Second),
+				LeaderElection: LeaderElectionConfig{
+					LeaseName:     "walg-k8s-cron-backup",
+					LeaseDuration: Duration(15 * time.Second),
+					RenewDeadline: Duration(10 * time.Second),
+					RetryPeriod:   Duration(2 * time.Second),
+				},
+				Discovery: DiscoveryConfig{
+					Interval:         Duration(time.Minute),
+					AnnotationPrefix: "walg-backup",
+				},
+				History: HistoryConfig{
+					Store:         "memory",
+					Path:          "/var/lib/walg-k8s-cron-backup/history.json",
+					ConfigMapName: "walg-k8s-cron-backup-history",
+					MaxRuns:       100,
+				},
+				API: APIConfig{
+					Address:     ":8080",
+					AuthEnabled: true,
+				},
+				SaveLogs:    false,
+				TargetNames: []string{"main", "analytics"},
+				Kubernetes: KubernetesConfig{
+					ApiVersion:   "v1",
+					AuthMode:     "token",
+					EventsObject: "owner",
+					Host:         "localhost",
+					Insecure:     true,
+					BearerToken:  "token",
+				},
+				Telegram: TelegramConfig{
+					ApiEndpoint: "https://api.telegram.org/bot%s/%s",
+					BotToken:    "token",
+					Commands: TelegramCommandsConfig{
+						Mode:           "polling",
+						WebhookAddress: ":8443",
+					},
+				},
+				FileStorage: FileStorageConfig{
+					Secure: true,
+				},
+				Targets: []TargetConfig{
+					{
+						Name: "main",
+						Pod: PodConfig{
+							Namespace:     "mainNs",
+							LabelSelector: "labelSelector",
+							ContainerName: "podContainerName",
+							RolePolicy:    "any",
+							LeaderValues:  []string{"master", "primary"},
+							ReplicaValues: []string{"replica"},
+						},
+						Exec: ExecConfig{
+							Backup:           "execBackup",
+							Info:             "echo 1",
+							WalVerify:        "wal-g wal-verify integrity timeline --json",
+							BackupTimeout:    Duration(24 * time.Hour),
+							InfoTimeout:      Duration(10 * time.Minute),
+							WalVerifyTimeout: Duration(30 * time.Minute),
+						},
+						Executor: ExecutorConfig{
+							Mode: "exec",
+						},
+						Retry: RetryConfig{
+							MaxAttempts:    1,
+							InitialBackoff: Duration(time.Minute),
+							MaxBackoff:     Duration(30 * time.Minute),
+							RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+						},
+						Overlap: OverlapConfig{
+							Policy: "skip",
+						},
+						CatchUp: CatchUpConfig{
+							Backup:    "skip",
+							Info:      "skip",
+							Retention: "skip",
+							Verify:    "skip",
+							WalVerify: "skip",
+							Window:    Duration(24 * time.Hour),
+						},
+						Retention: RetentionConfig{
+							List:    "wal-g backup-list --json --detail",
+							Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+							Mark:    "wal-g backup-mark {backup}",
+							Unmark:  "wal-g backup-mark -i {backup}",
+							Timeout: Duration(time.Hour),
+						},
+						Verify: VerifyConfig{
+							Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+								` && touch "$PGDATA/recovery.signal"` +
+								` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+								` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+								` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+							Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+							SQL:     "SELECT 1",
+							Timeout: Duration(6 * time.Hour),
+						},
+						Cron: CronConfig{
+							Backup: "cronBackup",
+						},
+					},
+					{
+						Name: "analytics",
+						Pod: PodConfig{
+							Namespace:     "analyticsNs",
+							LabelSelector: "labelSelector",
+							ContainerName: "podContainerName",
+							RolePolicy:    "any",
+							LeaderValues:  []string{"master", "primary"},
+							ReplicaValues: []string{"replica"},
+						},
+						Exec: ExecConfig{
+							Backup:           "execBackup",
+							Info:             "echo 1",
+							WalVerify:        "wal-g wal-verify integrity timeline --json",
+							BackupTimeout:    Duration(24 * time.Hour),
+							InfoTimeout:      Duration(10 * time.Minute),
+							WalVerifyTimeout: Duration(30 * time.Minute),
+						},
+						Executor: ExecutorConfig{
+							Mode: "exec",
+						},
+						Retry: RetryConfig{
+							MaxAttempts:    1,
+							InitialBackoff: Duration(time.Minute),
+							MaxBackoff:     Duration(30 * time.Minute),
+							RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+						},
+						Overlap: OverlapConfig{
+							Policy: "skip",
+						},
+						CatchUp: CatchUpConfig{
+							Backup:    "skip",
+							Info:      "skip",
+							Retention: "skip",
+							Verify:    "skip",
+							WalVerify: "skip",
+							Window:    Duration(24 * time.Hour),
+						},
+						Retention: RetentionConfig{
+							List:    "wal-g backup-list --json --detail",
+							Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+							Mark:    "wal-g backup-mark {backup}",
+							Unmark:  "wal-g backup-mark -i {backup}",
+							Timeout: Duration(time.Hour),
+						},
+						Verify: VerifyConfig{
+							Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+								` && touch "$PGDATA/recovery.signal"` +
+								` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+								` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+								` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+							Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+							SQL:     "SELECT 1",
+							Timeout: Duration(6 * time.Hour),
+						},
+						Cron: CronConfig{
+							Backup: "analyticsCronBackup",
+						},
+						Notification: TelegramNotificationConfig{
+							Backup: TelegramNotificationBackupConfig{
+								Enabled:        true,
+								ChatIds:        []int64{1, 2},
+								FailureChatIds: []int64{3},
+							},
+						},
+					},
+				},
+			},
+		},
+		// Tests kubernetes auth modes
+		{
+			name: "test config in incluster auth mode without host and token",
+			envFunc: func() {
+				requiredEnv()
+				os.Unsetenv("K8S_HOST")
+				os.Unsetenv("K8S_AUTH_TOKEN")
+				os.Setenv("K8S_AUTH_MODE", "incluster")
+			},
+			want: &Config{
+				Timezone:            "UTC",
+				ShutdownGracePeriod: Duration(30 * time.Second),
+				LeaderElection: LeaderElectionConfig{
+					LeaseName:     "walg-k8s-cron-backup",
+					LeaseDuration: Duration(15 * time.Second),
+					RenewDeadline: Duration(10 * time.Second),
+					RetryPeriod:   Duration(2 * time.Second),
+				},
+				Discovery: DiscoveryConfig{
+					Interval:         Duration(time.Minute),
+					AnnotationPrefix: "walg-backup",
+				},
+				History: HistoryConfig{
+					Store:         "memory",
+					Path:          "/var/lib/walg-k8s-cron-backup/history.json",
+					ConfigMapName: "walg-k8s-cron-backup-history",
+					MaxRuns:       100,
+				},
+				API: APIConfig{
+					Address:     ":8080",
+					AuthEnabled: true,
+				},
+				Kubernetes: KubernetesConfig{
+					ApiVersion:   "v1",
+					AuthMode:     "incluster",
+					EventsObject: "owner",
+					Insecure:     true,
+				},
+				Telegram: TelegramConfig{
+					ApiEndpoint: "https://api.telegram.org/bot%s/%s",
+					Commands: TelegramCommandsConfig{
+						Mode:           "polling",
+						WebhookAddress: ":8443",
+					},
+				},
+				FileStorage: FileStorageConfig{
+					Secure: true,
+				},
+				Targets: []TargetConfig{
+					{
+						Name: "ns",
+						Pod: PodConfig{
+							Namespace:     "ns",
+							LabelSelector: "labelSelector",
+							ContainerName: "podContainerName",
+							RolePolicy:    "any",
+							LeaderValues:  []string{"master", "primary"},
+							ReplicaValues: []string{"replica"},
+						},
+						Exec: ExecConfig{
+							Backup:           "execBackup",
+							Info:             "echo 1",
+							WalVerify:        "wal-g wal-verify integrity timeline --json",
+							BackupTimeout:    Duration(24 * time.Hour),
+							InfoTimeout:      Duration(10 * time.Minute),
+							WalVerifyTimeout: Duration(30 * time.Minute),
+						},
+						Executor: ExecutorConfig{
+							Mode: "exec",
+						},
+						Retry: RetryConfig{
+							MaxAttempts:    1,
+							InitialBackoff: Duration(time.Minute),
+							MaxBackoff:     Duration(30 * time.Minute),
+							RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+						},
+						Overlap: OverlapConfig{
+							Policy: "skip",
+						},
+						CatchUp: CatchUpConfig{
+							Backup:    "skip",
+							Info:      "skip",
+							Retention: "skip",
+							Verify:    "skip",
+							WalVerify: "skip",
+							Window:    Duration(24 * time.Hour),
+						},
+						Retention: RetentionConfig{
+							List:    "wal-g backup-list --json --detail",
+							Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+							Mark:    "wal-g backup-mark {backup}",
+							Unmark:  "wal-g backup-mark -i {backup}",
+							Timeout: Duration(time.Hour),
+						},
+						Verify: VerifyConfig{
+							Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+								` && touch "$PGDATA/recovery.signal"` +
+								` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+								` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+								` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+							Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+							SQL:     "SELECT 1",
+							Timeout: Duration(6 * time.Hour),
+						},
+						Cron: CronConfig{
+							Backup: "cronBackup",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "test config in token auth mode without token",
+			envFunc: func() {
+				requiredEnv()
+				os.Unsetenv("K8S_AUTH_TOKEN")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with unknown auth mode",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("K8S_AUTH_MODE", "password")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with leader election without namespace",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("K8S_LEADER_ELECTION_ENABLED", "true")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with telegram commands without chats",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("TG_BOT_TOKEN", "token")
+				os.Setenv("TG_COMMANDS_ENABLED", "true")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with telegram commands webhook without url",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("TG_BOT_TOKEN", "token")
+				os.Setenv("TG_COMMANDS_ENABLED", "true")
+				os.Setenv("TG_COMMANDS_CHATS", "-1232345")
+				os.Setenv("TG_COMMANDS_MODE", "webhook")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with telegram commands webhook url without path",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("TG_BOT_TOKEN", "token")
+				os.Setenv("TG_COMMANDS_ENABLED", "true")
+				os.Setenv("TG_COMMANDS_CHATS", "-1232345")
+				os.Setenv("TG_COMMANDS_MODE", "webhook")
+				os.Setenv("TG_COMMANDS_WEBHOOK_URL", "https://backup.domain.com")
+				os.Setenv("TG_COMMANDS_WEBHOOK_SECRET", "Pa7Vx2Lq9Nc4Rt8Wm3Ys6Bh1Jk5Df0Gz")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with telegram commands webhook with short secret",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("TG_BOT_TOKEN", "token")
+				os.Setenv("TG_COMMANDS_ENABLED", "true")
+				os.Setenv("TG_COMMANDS_CHATS", "-1232345")
+				os.Setenv("TG_COMMANDS_MODE", "webhook")
+				os.Setenv("TG_COMMANDS_WEBHOOK_URL", "https://backup.domain.com/telegram")
+				os.Setenv("TG_COMMANDS_WEBHOOK_SECRET", "secret")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with catch-up and memory history store",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("CATCHUP_BACKUP", "once")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with api auth without tokens and client certificates",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("API_ENABLED", "true")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with unknown api role",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("API_ENABLED", "true")
+				os.Setenv("API_AUTH_TOKENS_DIR", "/etc/walg-k8s-cron-backup/tokens")
+				os.Setenv("API_AUTH_ROLES", "ci:owner")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with invalid target name",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("APP_TARGETS", "main-db")
+			},
+			wantErr: true,
+		},
+		{
+			name: "test config with duplicated target name",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("APP_TARGETS", "main,main")
 			},
+			wantErr: true,
+		},
+		{
+			name: "test config with invalid name of single target from namespace",
+			envFunc: func() {
+				requiredEnv()
+				os.Setenv("K8S_NAMESPACE", "main-db")
+			},
+			wantErr: true,
 		},
+	}
 
-		//
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Clearenv()
+
+			got, err := Init(tt.envFunc, "")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Init() \nerror = %v\nwantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Init() \ngot = %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitConfigFile(t *testing.T) {
+	yamlConfig := `
+timezone: Europe/Paris
+kubernetes:
+  host: kube.local
+  bearer_token: fileToken
+  insecure: false
+telegram:
+  bot_token: fileBotToken
+targets:
+  - name: main
+    pod:
+      namespace: mainNs
+      label_selector: app=db
+      container_name: postgres
+    exec:
+      backup: wal-g backup-push /data
+    cron:
+      backup: 0 0 21 * * *
+    notification:
+      backup:
+        enabled: true
+        chats: [1, 2]
+`
+
+	tests := []struct {
+		name    string
+		content string
+		want    *Config
+		envFunc func()
+		wantErr bool
+	}{
+		{
+			name:    "test yaml config file, environment variables override file values",
+			content: yamlConfig,
+			envFunc: func() {
+				os.Setenv("K8S_AUTH_TOKEN", "envToken")
+				os.Setenv("MAIN_CRON_BACKUP", "0 0 22 * * *")
+			},
+			want: &Config{
+				Timezone:            "Europe/Paris",
+				ShutdownGracePeriod: Duration(30 * time.Second),
+				LeaderElection: LeaderElectionConfig{
+					LeaseName:     "walg-k8s-cron-backup",
+					LeaseDuration: Duration(15 * time.Second),
+					RenewDeadline: Duration(10 * time.Second),
+					RetryPeriod:   Duration(2 * time.Second),
+				},
+				Discovery: DiscoveryConfig{
+					Interval:         Duration(time.Minute),
+					AnnotationPrefix: "walg-backup",
+				},
+				History: HistoryConfig{
+					Store:         "memory",
+					Path:          "/var/lib/walg-k8s-cron-backup/history.json",
+					ConfigMapName: "walg-k8s-cron-backup-history",
+					MaxRuns:       100,
+				},
+				API: APIConfig{
+					Address:     ":8080",
+					AuthEnabled: true,
+				},
+				Kubernetes: KubernetesConfig{
+					ApiVersion:   "v1",
+					AuthMode:     "token",
+					EventsObject: "owner",
+					Host:         "kube.local",
+					Insecure:     false,
+					BearerToken:  "envToken",
+				},
+				Telegram: TelegramConfig{
+					ApiEndpoint: "https://api.telegram.org/bot%s/%s",
+					BotToken:    "fileBotToken",
+					Commands: TelegramCommandsConfig{
+						Mode:           "polling",
+						WebhookAddress: ":8443",
+					},
+				},
+				FileStorage: FileStorageConfig{
+					Secure: true,
+				},
+				Targets: []TargetConfig{
+					{
+						Name: "main",
+						Pod: PodConfig{
+							Namespace:     "mainNs",
+							LabelSelector: "app=db",
+							ContainerName: "postgres",
+							RolePolicy:    "any",
+							LeaderValues:  []string{"master", "primary"},
+							ReplicaValues: []string{"replica"},
+						},
+						Exec: ExecConfig{
+							Backup:           "wal-g backup-push /data",
+							Info:             "echo 1",
+							WalVerify:        "wal-g wal-verify integrity timeline --json",
+							BackupTimeout:    Duration(24 * time.Hour),
+							InfoTimeout:      Duration(10 * time.Minute),
+							WalVerifyTimeout: Duration(30 * time.Minute),
+						},
+						Executor: ExecutorConfig{
+							Mode: "exec",
+						},
+						Retry: RetryConfig{
+							MaxAttempts:    1,
+							InitialBackoff: Duration(time.Minute),
+							MaxBackoff:     Duration(30 * time.Minute),
+							RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+						},
+						Overlap: OverlapConfig{
+							Policy: "skip",
+						},
+						CatchUp: CatchUpConfig{
+							Backup:    "skip",
+							Info:      "skip",
+							Retention: "skip",
+							Verify:    "skip",
+							WalVerify: "skip",
+							Window:    Duration(24 * time.Hour),
+						},
+						Retention: RetentionConfig{
+							List:    "wal-g backup-list --json --detail",
+							Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+							Mark:    "wal-g backup-mark {backup}",
+							Unmark:  "wal-g backup-mark -i {backup}",
+							Timeout: Duration(time.Hour),
+						},
+						Verify: VerifyConfig{
+							Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+								` && touch "$PGDATA/recovery.signal"` +
+								` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+								` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+								` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+							Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+							SQL:     "SELECT 1",
+							Timeout: Duration(6 * time.Hour),
+						},
+						Cron: CronConfig{
+							Backup: "0 0 22 * * *",
+						},
+						Notification: TelegramNotificationConfig{
+							Backup: TelegramNotificationBackupConfig{
+								Enabled: true,
+								ChatIds: []int64{1, 2},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "test yaml config file, variables without prefix do not override file targets",
+			content: yamlConfig,
+			envFunc: func() {
+				os.Setenv("K8S_AUTH_TOKEN", "envToken")
+				os.Setenv("K8S_NAMESPACE", "legacyNs")
+				os.Setenv("EXEC_BACKUP", "legacyBackup")
+				os.Setenv("CRON_BACKUP", "0 0 23 * * *")
+				os.Setenv("MAIN_CRON_BACKUP", "0 0 22 * * *")
+			},
+			want: &Config{
+				Timezone:            "Europe/Paris",
+				ShutdownGracePeriod: Duration(30 * time.Second),
+				LeaderElection: LeaderElectionConfig{
+					LeaseName:     "walg-k8s-cron-backup",
+					LeaseDuration: Duration(15 * time.Second),
+					RenewDeadline: Duration(10 * time.Second),
+					RetryPeriod:   Duration(2 * time.Second),
+				},
+				Discovery: DiscoveryConfig{
+					Interval:         Duration(time.Minute),
+					AnnotationPrefix: "walg-backup",
+				},
+				History: HistoryConfig{
+					Store:         "memory",
+					Path:          "/var/lib/walg-k8s-cron-backup/history.json",
+					ConfigMapName: "walg-k8s-cron-backup-history",
+					MaxRuns:       100,
+				},
+				API: APIConfig{
+					Address:     ":8080",
+					AuthEnabled: true,
+				},
+				Kubernetes: KubernetesConfig{
+					ApiVersion:   "v1",
+					AuthMode:     "token",
+					EventsObject: "owner",
+					Host:         "kube.local",
+					Insecure:     false,
+					BearerToken:  "envToken",
+				},
+				Telegram: TelegramConfig{
+					ApiEndpoint: "https://api.telegram.org/bot%s/%s",
+					BotToken:    "fileBotToken",
+					Commands: TelegramCommandsConfig{
+						Mode:           "polling",
+						WebhookAddress: ":8443",
+					},
+				},
+				FileStorage: FileStorageConfig{
+					Secure: true,
+				},
+				Targets: []TargetConfig{
+					{
+						Name: "main",
+						Pod: PodConfig{
+							Namespace:     "mainNs",
+							LabelSelector: "app=db",
+							ContainerName: "postgres",
+							RolePolicy:    "any",
+							LeaderValues:  []string{"master", "primary"},
+							ReplicaValues: []string{"replica"},
+						},
+						Exec: ExecConfig{
+							Backup:           "wal-g backup-push /data",
+							Info:             "echo 1",
+							WalVerify:        "wal-g wal-verify integrity timeline --json",
+							BackupTimeout:    Duration(24 * time.Hour),
+							InfoTimeout:      Duration(10 * time.Minute),
+							WalVerifyTimeout: Duration(30 * time.Minute),
+						},
+						Executor: ExecutorConfig{
+							Mode: "exec",
+						},
+						Retry: RetryConfig{
+							MaxAttempts:    1,
+							InitialBackoff: Duration(time.Minute),
+							MaxBackoff:     Duration(30 * time.Minute),
+							RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+						},
+						Overlap: OverlapConfig{
+							Policy: "skip",
+						},
+						CatchUp: CatchUpConfig{
+							Backup:    "skip",
+							Info:      "skip",
+							Retention: "skip",
+							Verify:    "skip",
+							WalVerify: "skip",
+							Window:    Duration(24 * time.Hour),
+						},
+						Retention: RetentionConfig{
+							List:    "wal-g backup-list --json --detail",
+							Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+							Mark:    "wal-g backup-mark {backup}",
+							Unmark:  "wal-g backup-mark -i {backup}",
+							Timeout: Duration(time.Hour),
+						},
+						Verify: VerifyConfig{
+							Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+								` && touch "$PGDATA/recovery.signal"` +
+								` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+								` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+								` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+							Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+							SQL:     "SELECT 1",
+							Timeout: Duration(6 * time.Hour),
+						},
+						Cron: CronConfig{
+							Backup: "0 0 22 * * *",
+						},
+						Notification: TelegramNotificationConfig{
+							Backup: TelegramNotificationBackupConfig{
+								Enabled: true,
+								ChatIds: []int64{1, 2},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "test json config file",
+			content: `{"kubernetes": {"host": "kube.local", "bearer_token": "token"}, "targets": [{"name": "main", "pod": {"namespace": "ns", "label_selector": "app=db", "container_name": "postgres"}, "exec": {"backup": "backup"}, "cron": {"backup": "0 0 21 * * *"}}]}`,
+			envFunc: func() {},
+			want: &Config{
+				Timezone:            "UTC",
+				ShutdownGracePeriod: Duration(30 * time.Second),
+				LeaderElection: LeaderElectionConfig{
+					LeaseName:     "walg-k8s-cron-backup",
+					LeaseDuration: Duration(15 * time.Second),
+					RenewDeadline: Duration(10 * time.Second),
+					RetryPeriod:   Duration(2 * time.Second),
+				},
+				Discovery: DiscoveryConfig{
+					Interval:         Duration(time.Minute),
+					AnnotationPrefix: "walg-backup",
+				},
+				History: HistoryConfig{
+					Store:         "memory",
+					Path:          "/var/lib/walg-k8s-cron-backup/history.json",
+					ConfigMapName: "walg-k8s-cron-backup-history",
+					MaxRuns:       100,
+				},
+				API: APIConfig{
+					Address:     ":8080",
+					AuthEnabled: true,
+				},
+				Kubernetes: KubernetesConfig{
+					ApiVersion:   "v1",
+					AuthMode:     "token",
+					EventsObject: "owner",
+					Host:         "kube.local",
+					Insecure:     true,
+					BearerToken:  "token",
+				},
+				Telegram: TelegramConfig{
+					ApiEndpoint: "https://api.telegram.org/bot%s/%s",
+					Commands: TelegramCommandsConfig{
+						Mode:           "polling",
+						WebhookAddress: ":8443",
+					},
+				},
+				FileStorage: FileStorageConfig{
+					Secure: true,
+				},
+				Targets: []TargetConfig{
+					{
+						Name: "main",
+						Pod: PodConfig{
+							Namespace:     "ns",
+							LabelSelector: "app=db",
+							ContainerName: "postgres",
+							RolePolicy:    "any",
+							LeaderValues:  []string{"master", "primary"},
+							ReplicaValues: []string{"replica"},
+						},
+						Exec: ExecConfig{
+							Backup:           "backup",
+							Info:             "echo 1",
+							WalVerify:        "wal-g wal-verify integrity timeline --json",
+							BackupTimeout:    Duration(24 * time.Hour),
+							InfoTimeout:      Duration(10 * time.Minute),
+							WalVerifyTimeout: Duration(30 * time.Minute),
+						},
+						Executor: ExecutorConfig{
+							Mode: "exec",
+						},
+						Retry: RetryConfig{
+							MaxAttempts:    1,
+							InitialBackoff: Duration(time.Minute),
+							MaxBackoff:     Duration(30 * time.Minute),
+							RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+						},
+						Overlap: OverlapConfig{
+							Policy: "skip",
+						},
+						CatchUp: CatchUpConfig{
+							Backup:    "skip",
+							Info:      "skip",
+							Retention: "skip",
+							Verify:    "skip",
+							WalVerify: "skip",
+							Window:    Duration(24 * time.Hour),
+						},
+						Retention: RetentionConfig{
+							List:    "wal-g backup-list --json --detail",
+							Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+							Mark:    "wal-g backup-mark {backup}",
+							Unmark:  "wal-g backup-mark -i {backup}",
+							Timeout: Duration(time.Hour),
+						},
+						Verify: VerifyConfig{
+							Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+								` && touch "$PGDATA/recovery.signal"` +
+								` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+								` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+								` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+							Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+							SQL:     "SELECT 1",
+							Timeout: Duration(6 * time.Hour),
+						},
+						Cron: CronConfig{
+							Backup: "0 0 21 * * *",
+						},
+					},
+				},
+			},
+		},
+		{
+			name:    "test config file with unknown field",
+			content: yamlConfig + "    unknown: value\n",
+			envFunc: func() {},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			os.Clearenv()
 
-			got, err := Init(tt.envFunc)
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Init(tt.envFunc, path)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Init() \nerror = %v\nwantErr %v", err, tt.wantErr)
 
@@ -234,3 +1330,270 @@ func TestInit(t *testing.T) {
 		})
 	}
 }
+
+func TestDiscoveredTarget(t *testing.T) {
+	template := NewTargetConfig("")
+	template.Exec.Backup = "wal-g backup-push /data"
+	cfg := &Config{
+		Discovery: DiscoveryConfig{
+			AnnotationPrefix: "walg-backup",
+			Template:         &template,
+		},
+	}
+
+	tests := []struct {
+		name    string
+		obj     kube.AnnotatedObject
+		want    TargetConfig
+		wantErr bool
+	}{
+		{
+			name: "test statefulset with schedule only, template and first container are used",
+			obj: kube.AnnotatedObject{
+				Kind:             "StatefulSet",
+				Namespace:        "db-prod",
+				Name:             "main",
+				LabelSelector:    "app=main",
+				DefaultContainer: "postgres",
+				Annotations: map[string]string{
+					"walg-backup/schedule": "0 0 1 * * *",
+				},
+			},
+			want: TargetConfig{
+				Name: "sts_db_prod_main_2fd8f100",
+				Pod: PodConfig{
+					Namespace:     "db-prod",
+					LabelSelector: "app=main",
+					ContainerName: "postgres",
+					RolePolicy:    "any",
+					LeaderValues:  []string{"master", "primary"},
+					ReplicaValues: []string{"replica"},
+				},
+				Exec: ExecConfig{
+					Backup:           "wal-g backup-push /data",
+					Info:             "echo 1",
+					WalVerify:        "wal-g wal-verify integrity timeline --json",
+					BackupTimeout:    Duration(24 * time.Hour),
+					InfoTimeout:      Duration(10 * time.Minute),
+					WalVerifyTimeout: Duration(30 * time.Minute),
+				},
+				Executor: ExecutorConfig{
+					Mode: "exec",
+				},
+				Retry: RetryConfig{
+					MaxAttempts:    1,
+					InitialBackoff: Duration(time.Minute),
+					MaxBackoff:     Duration(30 * time.Minute),
+					RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+				},
+				Overlap: OverlapConfig{
+					Policy: "skip",
+				},
+				CatchUp: CatchUpConfig{
+					Backup:    "skip",
+					Info:      "skip",
+					Retention: "skip",
+					Verify:    "skip",
+					WalVerify: "skip",
+					Window:    Duration(24 * time.Hour),
+				},
+				Retention: RetentionConfig{
+					List:    "wal-g backup-list --json --detail",
+					Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+					Mark:    "wal-g backup-mark {backup}",
+					Unmark:  "wal-g backup-mark -i {backup}",
+					Timeout: Duration(time.Hour),
+				},
+				Verify: VerifyConfig{
+					Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+						` && touch "$PGDATA/recovery.signal"` +
+						` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+						` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+						` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+					Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+					SQL:     "SELECT 1",
+					Timeout: Duration(6 * time.Hour),
+				},
+				Cron: CronConfig{
+					Backup: "0 0 1 * * *",
+				},
+			},
+		},
+		{
+			name: "test pod with annotations over template",
+			obj: kube.AnnotatedObject{
+				Kind:             "Pod",
+				Namespace:        "db",
+				Name:             "analytics-0",
+				FieldSelector:    "metadata.name=analytics-0",
+				DefaultContainer: "sidecar",
+				Annotations: map[string]string{
+					"walg-backup/schedule":    "0 0 2 * * *",
+					"walg-backup/name":        "analytics",
+					"walg-backup/container":   "postgres",
+					"walg-backup/exec":        "backup",
+					"walg-backup/role-label":  "spilo-role",
+					"walg-backup/role-policy": "prefer-replica",
+				},
+			},
+			want: TargetConfig{
+				Name: "analytics",
+				Pod: PodConfig{
+					Namespace:     "db",
+					FieldSelector: "metadata.name=analytics-0",
+					ContainerName: "postgres",
+					RoleLabel:     "spilo-role",
+					RolePolicy:    "prefer-replica",
+					LeaderValues:  []string{"master", "primary"},
+					ReplicaValues: []string{"replica"},
+				},
+				Exec: ExecConfig{
+					Backup:           "backup",
+					Info:             "echo 1",
+					WalVerify:        "wal-g wal-verify integrity timeline --json",
+					BackupTimeout:    Duration(24 * time.Hour),
+					InfoTimeout:      Duration(10 * time.Minute),
+					WalVerifyTimeout: Duration(30 * time.Minute),
+				},
+				Executor: ExecutorConfig{
+					Mode: "exec",
+				},
+				Retry: RetryConfig{
+					MaxAttempts:    1,
+					InitialBackoff: Duration(time.Minute),
+					MaxBackoff:     Duration(30 * time.Minute),
+					RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+				},
+				Overlap: OverlapConfig{
+					Policy: "skip",
+				},
+				CatchUp: CatchUpConfig{
+					Backup:    "skip",
+					Info:      "skip",
+					Retention: "skip",
+					Verify:    "skip",
+					WalVerify: "skip",
+					Window:    Duration(24 * time.Hour),
+				},
+				Retention: RetentionConfig{
+					List:    "wal-g backup-list --json --detail",
+					Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+					Mark:    "wal-g backup-mark {backup}",
+					Unmark:  "wal-g backup-mark -i {backup}",
+					Timeout: Duration(time.Hour),
+				},
+				Verify: VerifyConfig{
+					Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+						` && touch "$PGDATA/recovery.signal"` +
+						` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+						` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+						` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+					Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+					SQL:     "SELECT 1",
+					Timeout: Duration(6 * time.Hour),
+				},
+				Cron: CronConfig{
+					Backup: "0 0 2 * * *",
+				},
+			},
+		},
+		{
+			name: "test annotated name, which is invalid target name",
+			obj: kube.AnnotatedObject{
+				Kind:             "StatefulSet",
+				Namespace:        "1db",
+				Name:             "main",
+				LabelSelector:    "app=main",
+				DefaultContainer: "postgres",
+				Annotations: map[string]string{
+					"walg-backup/schedule": "0 0 1 * * *",
+					"walg-backup/name":     "1db_main",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "test invalid role policy",
+			obj: kube.AnnotatedObject{
+				Kind:             "StatefulSet",
+				Namespace:        "db",
+				Name:             "main",
+				LabelSelector:    "app=main",
+				DefaultContainer: "postgres",
+				Annotations: map[string]string{
+					"walg-backup/schedule":    "0 0 1 * * *",
+					"walg-backup/role-policy": "leader",
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cfg.DiscoveredTarget(tt.obj)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DiscoveredTarget() \nerror = %v\nwantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiscoveredTarget() \ngot = %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetName(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace string
+		object    string
+		want      string
+	}{
+		{
+			name:      "test namespace and name with symbols",
+			namespace: "db-prod",
+			object:    "main",
+			want:      "bs_db_prod_main_b36864d3",
+		},
+		{
+			name:      "test namespace starting with digit",
+			namespace: "1db",
+			object:    "main",
+			want:      "bs_1db_main_808c3d10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TargetName(TargetNamePrefixBackupSchedule, tt.namespace, tt.object)
+			if got != tt.want {
+				t.Errorf("TargetName() = %q, want %q", got, tt.want)
+			}
+			if !targetNameRegexp.MatchString(got) {
+				t.Errorf("TargetName() = %q, want valid target name", got)
+			}
+		})
+	}
+
+	// Same names after replace of symbols are different by hash
+	if TargetName(TargetNamePrefixBackupSchedule, "a-b", "c") == TargetName(TargetNamePrefixBackupSchedule, "a", "b-c") {
+		t.Errorf("TargetName() of a-b/c and a/b-c are same")
+	}
+}
+
+func TestDefaultVerifyRestore(t *testing.T) {
+	restore := NewTargetConfig("main").Verify.Restore
+
+	// Restored server must not be promoted, replay whole archive or push WAL to production storage
+	for _, setting := range []string{
+		"recovery_target = 'immediate'",
+		"recovery_target_action = 'pause'",
+		"archive_mode = off",
+	} {
+		if !strings.Contains(restore, setting) {
+			t.Errorf("default restore %q does not contain %q", restore, setting)
+		}
+	}
+}
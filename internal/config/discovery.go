@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
+)
+
+// Annotations of discovered objects, full key is <prefix>/<annotation>
+const (
+	AnnotationSchedule     = "schedule"      // Cron of backup, object is discovered when it is present
+	AnnotationName         = "name"          // Target name, default <sts|pod>_<namespace>_<object name>_<hash>
+	AnnotationContainer    = "container"     // Default first container of pod
+	AnnotationExec         = "exec"          // Backup command
+	AnnotationInfoSchedule = "info-schedule" // Cron of backups info
+	AnnotationInfoExec     = "info-exec"     // Backups info command
+	AnnotationRoleLabel    = "role-label"
+	AnnotationRolePolicy   = "role-policy"
+)
+
+// Symbols of Kubernetes names, which are not allowed in target name
+var targetNameInvalidRegexp = regexp.MustCompile("[^A-Za-z0-9_]")
+
+// Prefixes of target names of Kubernetes objects by kinds
+const (
+	TargetNamePrefixStatefulSet    = "sts"
+	TargetNamePrefixPod            = "pod"
+	TargetNamePrefixBackupSchedule = "bs"
+)
+
+// Make target name of Kubernetes object: <prefix>_<namespace>_<name>_<hash>, symbols - and . are replaced with _
+// Prefix starts name with letter, also for namespace, which starts with digit. Hash of prefix, namespace and name
+// keeps names of objects different, for example a-b/c and a/b-c
+func TargetName(prefix string, namespace string, name string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(prefix + "/" + namespace + "/" + name))
+
+	return targetNameInvalidRegexp.ReplaceAllString(fmt.Sprintf("%s_%s_%s_%08x", prefix, namespace, name, hash.Sum32()), "_")
+}
+
+// Get full key of annotation
+func (dcfg *DiscoveryConfig) Annotation(name string) string {
+	return dcfg.AnnotationPrefix + "/" + name
+}
+
+// Build target of discovered object, annotations are applied over discovery template
+func (cfg *Config) DiscoveredTarget(obj kube.AnnotatedObject) (TargetConfig, error) {
+	target := *cfg.Discovery.Template
+
+	annotation := func(name string) (string, bool) {
+		value, ok := obj.Annotations[cfg.Discovery.Annotation(name)]
+
+		return value, ok
+	}
+
+	prefix := TargetNamePrefixPod
+	if obj.Kind == "StatefulSet" {
+		prefix = TargetNamePrefixStatefulSet
+	}
+	target.Name = TargetName(prefix, obj.Namespace, obj.Name)
+	if name, ok := annotation(AnnotationName); ok {
+		target.Name = name
+	}
+
+	target.Pod.Namespace = obj.Namespace
+	target.Pod.LabelSelector = obj.LabelSelector
+	target.Pod.FieldSelector = obj.FieldSelector
+	target.Pod.ContainerName = obj.DefaultContainer
+	if container, ok := annotation(AnnotationContainer); ok {
+		target.Pod.ContainerName = container
+	}
+	if roleLabel, ok := annotation(AnnotationRoleLabel); ok {
+		target.Pod.RoleLabel = roleLabel
+	}
+	if rolePolicy, ok := annotation(AnnotationRolePolicy); ok {
+		target.Pod.RolePolicy = rolePolicy
+	}
+
+	target.Cron.Backup, _ = annotation(AnnotationSchedule)
+	if exec, ok := annotation(AnnotationExec); ok {
+		target.Exec.Backup = exec
+	}
+	if infoSchedule, ok := annotation(AnnotationInfoSchedule); ok {
+		target.Cron.Info = infoSchedule
+	}
+	if infoExec, ok := annotation(AnnotationInfoExec); ok {
+		target.Exec.Info = infoExec
+	}
+
+	if !targetNameRegexp.MatchString(target.Name) {
+		return target, fmt.Errorf("%s %s/%s: target name %q is invalid, set annotation %s",
+			obj.Kind, obj.Namespace, obj.Name, target.Name, cfg.Discovery.Annotation(AnnotationName))
+	}
+	if err := cfg.ValidateTarget(&target); err != nil {
+		return target, fmt.Errorf("%s %s/%s: %s", obj.Kind, obj.Namespace, obj.Name, err.Error())
+	}
+
+	return target, nil
+}
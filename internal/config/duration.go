@@ -0,0 +1,41 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration - time.Duration, which is parsed from string like "1h30m"
+// in environment variables and in config file
+type Duration time.Duration
+
+// Implements envconfig.Decoder interface
+func (d *Duration) Decode(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+
+	return nil
+}
+
+// Implements json.Unmarshaler interface
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	return d.Decode(value)
+}
+
+// Implements json.Marshaler interface
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration().String())
+}
+
+// Get value as time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
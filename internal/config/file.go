@@ -0,0 +1,44 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Private method for read YAML or JSON config file over default values
+// JSON is subset of YAML, so one parser is used for both formats
+func (cfg *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Unknown fields are errors, for catch typos in config file
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return fmt.Errorf("Config file %s: %s", path, err.Error())
+	}
+
+	return nil
+}
+
+// Implements json.Unmarshaler for fill default values of target before parse
+func (tcfg *TargetConfig) UnmarshalJSON(data []byte) error {
+	// Type without methods, for not call UnmarshalJSON recursively
+	type plainTargetConfig TargetConfig
+
+	target := plainTargetConfig(NewTargetConfig(""))
+
+	// Decoder is strict same as config file parser
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&target); err != nil {
+		return err
+	}
+	*tcfg = TargetConfig(target)
+
+	return nil
+}
@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Timeout of status update after run of job
+const statusTimeout = 30 * time.Second
+
+// Controller - watches BackupSchedule resources, syncs their targets to registry
+// and writes results of runs to status of resources
+type Controller struct {
+	cfg      *config.Config
+	client   dynamic.Interface
+	registry *job.Registry
+
+	informer cache.SharedIndexInformer
+	// Signal for reconcile, buffered for merge of events
+	changed chan struct{}
+
+	// Last valid targets of resources, they are used only by reconcile
+	valid map[types.NamespacedName]config.TargetConfig
+
+	mu sync.Mutex
+	// Resources of scheduled targets by target names
+	schedules map[string]types.NamespacedName
+}
+
+// Create new Controller struct object [Constructor]
+func NewController(cfg *config.Config, client dynamic.Interface, registry *job.Registry) *Controller {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, cfg.Controller.Namespace, nil)
+
+	c := &Controller{
+		cfg:       cfg,
+		client:    client,
+		registry:  registry,
+		informer:  factory.ForResource(BackupScheduleResource).Informer(),
+		changed:   make(chan struct{}, 1),
+		valid:     make(map[types.NamespacedName]config.TargetConfig),
+		schedules: make(map[string]types.NamespacedName),
+	}
+
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { c.enqueue() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// Status updates do not change generation, they are skipped
+			if oldObj.(metav1.Object).GetGeneration() != newObj.(metav1.Object).GetGeneration() {
+				c.enqueue()
+			}
+		},
+		DeleteFunc: func(interface{}) { c.enqueue() },
+	})
+
+	return c
+}
+
+// Watch resources and reconcile them until ctx is cancelled
+// All resources are reconciled together, because registry syncs whole source
+func (c *Controller) Run(ctx context.Context) {
+	go c.informer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return
+	}
+	klog.Infof("[Controller] Watch %s", BackupScheduleResource.String())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.changed:
+			c.reconcile(ctx)
+		}
+	}
+}
+
+// Implements job.RunObserver, result of run is written to status of resource of target
+func (c *Controller) ObserveRun(run *job.Run) {
+	c.mu.Lock()
+	key, ok := c.schedules[run.Target]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	runStatus := &RunStatus{
+		Id:         run.Id.String(),
+		StartTime:  metav1.NewTime(run.StartedAt),
+		FinishTime: metav1.NewTime(run.FinishedAt),
+		Result:     run.Status,
+		Reason:     run.Reason,
+		Message:    run.Message,
+		ExitCode:   run.ExitCode,
+		Attempts:   run.Attempts,
+	}
+
+	err := c.updateStatus(ctx, key, func(status *BackupScheduleStatus) {
+		switch run.Job {
+		case job.JobBackup:
+			status.LastBackup = runStatus
+		case job.JobInfo:
+			status.LastInfo = runStatus
+			if run.BackupName != "" {
+				status.LatestBackup = run.BackupName
+			}
+		case job.JobRetention:
+			status.LastRetention = runStatus
+		case job.JobVerify:
+			status.LastVerify = runStatus
+		case job.JobWalVerify:
+			status.LastWalVerify = runStatus
+		}
+	})
+	if err != nil {
+		klog.Errorf("[Controller] %s: Update status: %s", key, err.Error())
+	}
+}
+
+// Private method for request reconcile, events are merged while reconcile is pending
+func (c *Controller) enqueue() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Private method for sync targets of all resources to registry and write errors of specs to status
+func (c *Controller) reconcile(ctx context.Context) {
+	var schedules []*BackupSchedule
+	for _, obj := range c.informer.GetStore().List() {
+		bs, err := fromUnstructured(obj.(*unstructured.Unstructured))
+		if err != nil {
+			klog.Errorf("[Controller] %s", err.Error())
+
+			continue
+		}
+		schedules = append(schedules, bs)
+	}
+
+	targets, scheduled, specErrs := c.buildTargets(schedules)
+
+	for _, bs := range schedules {
+		key := types.NamespacedName{Namespace: bs.Namespace, Name: bs.Name}
+		targetName := config.TargetName(config.TargetNamePrefixBackupSchedule, bs.Namespace, bs.Name)
+		if target, ok := c.valid[key]; ok {
+			targetName = target.Name
+		}
+
+		// Status is written only when it is changed, cached status is checked first
+		specErr := specErrs[key]
+		if bs.Status.ObservedGeneration == bs.Generation && bs.Status.Target == targetName && bs.Status.Error == specErr {
+			continue
+		}
+		err := c.updateStatus(ctx, key, func(status *BackupScheduleStatus) {
+			status.ObservedGeneration = bs.Generation
+			status.Target = targetName
+			status.Error = specErr
+		})
+		if err != nil {
+			klog.Errorf("[Controller] %s: Update status: %s", key, err.Error())
+		}
+	}
+
+	c.mu.Lock()
+	c.schedules = scheduled
+	c.mu.Unlock()
+
+	if err := c.registry.Sync(job.SourceController, targets); err != nil {
+		klog.Errorf("[Controller] %s", err.Error())
+	}
+}
+
+// Private method for build targets of resources and remember valid ones, targets of deleted resources are forgotten
+// Resource with invalid spec keeps its last valid target, so wrong edit does not unschedule backups.
+// Older resource keeps target name, when names are same, error is returned for newer one
+func (c *Controller) buildTargets(schedules []*BackupSchedule) ([]config.TargetConfig, map[string]types.NamespacedName, map[types.NamespacedName]string) {
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].CreationTimestamp.Equal(&schedules[j].CreationTimestamp) {
+			return schedules[i].CreationTimestamp.Before(&schedules[j].CreationTimestamp)
+		}
+
+		return schedules[i].Namespace+"/"+schedules[i].Name < schedules[j].Namespace+"/"+schedules[j].Name
+	})
+
+	var targets []config.TargetConfig
+	scheduled := make(map[string]types.NamespacedName)
+	specErrs := make(map[types.NamespacedName]string)
+	valid := make(map[types.NamespacedName]config.TargetConfig)
+
+	for _, bs := range schedules {
+		key := types.NamespacedName{Namespace: bs.Namespace, Name: bs.Name}
+
+		target, err := targetFromSchedule(c.cfg, bs)
+		if err != nil {
+			last, ok := c.valid[key]
+			specErrs[key] = err.Error()
+			if ok {
+				specErrs[key] += ", last valid spec is scheduled"
+				target = last
+			}
+			klog.Errorf("[Controller] %s: %s", key, specErrs[key])
+			if !ok {
+				continue
+			}
+		}
+		valid[key] = target
+
+		if bs.Spec.Suspend {
+			continue
+		}
+
+		// Target name is used by other resource or by target of other source
+		if other, ok := scheduled[target.Name]; ok {
+			specErrs[key] = fmt.Sprintf("Target name %s is already used by BackupSchedule %s", target.Name, other)
+			klog.Errorf("[Controller] %s: %s", key, specErrs[key])
+
+			continue
+		}
+		if source := c.registry.Source(target.Name); source != "" && source != job.SourceController {
+			specErrs[key] = fmt.Sprintf("Target name %s is already used by target of %s", target.Name, source)
+			klog.Errorf("[Controller] %s: %s", key, specErrs[key])
+
+			continue
+		}
+
+		targets = append(targets, target)
+		scheduled[target.Name] = key
+	}
+	c.valid = valid
+
+	return targets, scheduled, specErrs
+}
+
+// Private method for change status of resource, status is read from api server, not from cache,
+// update is retried on conflict and skipped, when status is not changed
+func (c *Controller) updateStatus(ctx context.Context, key types.NamespacedName, mutate func(status *BackupScheduleStatus)) error {
+	resource := c.client.Resource(BackupScheduleResource).Namespace(key.Namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := resource.Get(ctx, key.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		bs, err := fromUnstructured(obj)
+		if err != nil {
+			return err
+		}
+
+		status := bs.Status
+		mutate(&bs.Status)
+		if reflect.DeepEqual(status, bs.Status) {
+			return nil
+		}
+
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(bs)
+		if err != nil {
+			return err
+		}
+
+		_, err = resource.UpdateStatus(ctx, &unstructured.Unstructured{Object: content}, metav1.UpdateOptions{})
+
+		return err
+	})
+}
+
+// Private func for convert object of dynamic client to BackupSchedule
+func fromUnstructured(obj *unstructured.Unstructured) (*BackupSchedule, error) {
+	bs := &BackupSchedule{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, bs); err != nil {
+		return nil, fmt.Errorf("BackupSchedule %s/%s: %s", obj.GetNamespace(), obj.GetName(), err.Error())
+	}
+
+	return bs, nil
+}
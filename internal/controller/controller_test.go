@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+	"k8s.io/apimachinery/pkg/types"
+
+	cr "github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestControllerBuildTargets(t *testing.T) {
+	cfg := &config.Config{}
+	c := &Controller{
+		cfg:      cfg,
+		registry: job.NewRegistry(context.Background(), cr.New(), cfg, &job.Dependencies{}),
+		valid:    make(map[types.NamespacedName]config.TargetConfig),
+	}
+
+	key := types.NamespacedName{Namespace: "db", Name: "main"}
+	newSchedule := func(schedule string) *BackupSchedule {
+		return &BackupSchedule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Spec: BackupScheduleSpec{
+				Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"cluster-name": "main"}},
+				Container: "postgres",
+				Backup:    CommandSpec{Schedule: schedule, Command: "wal-g backup-push /data"},
+			},
+		}
+	}
+
+	targets, scheduled, specErrs := c.buildTargets([]*BackupSchedule{newSchedule("0 0 1 * * *")})
+	if len(targets) != 1 || scheduled[targets[0].Name] != key || specErrs[key] != "" {
+		t.Fatalf("buildTargets() of valid spec = %+v, %v, %v, want scheduled target", targets, scheduled, specErrs)
+	}
+
+	// Invalid spec keeps last valid target and reports error
+	targets, scheduled, specErrs = c.buildTargets([]*BackupSchedule{newSchedule("")})
+	if len(targets) != 1 || targets[0].Cron.Backup != "0 0 1 * * *" || scheduled[targets[0].Name] != key {
+		t.Fatalf("buildTargets() of invalid spec = %+v, %v, want last valid target", targets, scheduled)
+	}
+	if !strings.Contains(specErrs[key], "last valid spec is scheduled") {
+		t.Errorf("error of invalid spec = %q, want last valid spec is scheduled", specErrs[key])
+	}
+
+	// Target of deleted resource is forgotten, invalid spec without valid target is not scheduled
+	if targets, _, _ = c.buildTargets(nil); len(targets) != 0 {
+		t.Fatalf("buildTargets() without resources = %+v, want empty", targets)
+	}
+	targets, _, specErrs = c.buildTargets([]*BackupSchedule{newSchedule("")})
+	if len(targets) != 0 || specErrs[key] == "" {
+		t.Fatalf("buildTargets() of invalid spec after delete = %+v, %v, want error without targets", targets, specErrs)
+	}
+}
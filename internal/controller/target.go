@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Private func for build target of BackupSchedule over default target values
+func targetFromSchedule(cfg *config.Config, bs *BackupSchedule) (config.TargetConfig, error) {
+	target := config.NewTargetConfig(config.TargetName(config.TargetNamePrefixBackupSchedule, bs.Namespace, bs.Name))
+	spec := &bs.Spec
+
+	// Commands of resource are run only in pods of its namespace, so namespace is trust boundary of resource
+	if !cfg.Controller.NamespaceAllowed(bs.Namespace) {
+		return target, fmt.Errorf("Namespace %s is not allowed by K8S_CONTROLLER_ALLOWED_NAMESPACES", bs.Namespace)
+	}
+
+	if spec.Selector == nil {
+		return target, errors.New("Selector is required")
+	}
+	selector, err := metav1.LabelSelectorAsSelector(spec.Selector)
+	if err != nil {
+		return target, err
+	}
+
+	// Pods are selected only in namespace of resource, spec has no namespace of pods
+	target.Pod.Namespace = bs.Namespace
+	target.Pod.LabelSelector = selector.String()
+	target.Pod.ContainerName = spec.Container
+	if spec.Role != nil {
+		target.Pod.RoleLabel = spec.Role.Label
+		if spec.Role.Policy != "" {
+			target.Pod.RolePolicy = spec.Role.Policy
+		}
+		if len(spec.Role.LeaderValues) > 0 {
+			target.Pod.LeaderValues = spec.Role.LeaderValues
+		}
+		if len(spec.Role.ReplicaValues) > 0 {
+			target.Pod.ReplicaValues = spec.Role.ReplicaValues
+		}
+	}
+
+	target.Cron.Backup = spec.Backup.Schedule
+	target.Exec.Backup = spec.Backup.Command
+	if spec.Backup.Timeout != nil {
+		target.Exec.BackupTimeout = config.Duration(spec.Backup.Timeout.Duration)
+	}
+	if spec.Info != nil {
+		target.Cron.Info = spec.Info.Schedule
+		if spec.Info.Command != "" {
+			target.Exec.Info = spec.Info.Command
+		}
+		if spec.Info.Timeout != nil {
+			target.Exec.InfoTimeout = config.Duration(spec.Info.Timeout.Duration)
+		}
+	}
+
+	if spec.Executor != nil {
+		if spec.Executor.Mode != "" {
+			target.Executor.Mode = spec.Executor.Mode
+		}
+		target.Executor.JobTemplate = spec.Executor.JobTemplate
+		target.Executor.JobContainer = spec.Executor.JobContainer
+	}
+
+	if spec.Retry != nil {
+		if spec.Retry.MaxAttempts > 0 {
+			target.Retry.MaxAttempts = spec.Retry.MaxAttempts
+		}
+		if spec.Retry.InitialBackoff != nil {
+			target.Retry.InitialBackoff = config.Duration(spec.Retry.InitialBackoff.Duration)
+		}
+		if spec.Retry.MaxBackoff != nil {
+			target.Retry.MaxBackoff = config.Duration(spec.Retry.MaxBackoff.Duration)
+		}
+		if spec.Retry.RetryOn != nil {
+			target.Retry.RetryOn = spec.Retry.RetryOn
+		}
+	}
+
+	if spec.Overlap != nil {
+		if spec.Overlap.Policy != "" {
+			target.Overlap.Policy = spec.Overlap.Policy
+		}
+		target.Overlap.NotifySkipped = spec.Overlap.NotifySkipped
+	}
+
+	if spec.CatchUp != nil {
+		setString(&target.CatchUp.Backup, spec.CatchUp.Backup)
+		setString(&target.CatchUp.Info, spec.CatchUp.Info)
+		setString(&target.CatchUp.Retention, spec.CatchUp.Retention)
+		setString(&target.CatchUp.Verify, spec.CatchUp.Verify)
+		setString(&target.CatchUp.WalVerify, spec.CatchUp.WalVerify)
+		if spec.CatchUp.Window != nil {
+			target.CatchUp.Window = config.Duration(spec.CatchUp.Window.Duration)
+		}
+	}
+
+	if spec.Retention != nil {
+		target.Cron.Retention = spec.Retention.Schedule
+		target.Retention.KeepDaily = spec.Retention.KeepDaily
+		target.Retention.KeepWeekly = spec.Retention.KeepWeekly
+		target.Retention.KeepMonthly = spec.Retention.KeepMonthly
+		target.Retention.DryRun = spec.Retention.DryRun
+		target.Retention.MarkPermanent = spec.Retention.MarkPermanent
+		if spec.Retention.Timeout != nil {
+			target.Retention.Timeout = config.Duration(spec.Retention.Timeout.Duration)
+		}
+	}
+
+	if spec.Verify != nil {
+		target.Cron.Verify = spec.Verify.Schedule
+		target.Verify.JobTemplate = spec.Verify.JobTemplate
+		target.Verify.JobContainer = spec.Verify.JobContainer
+		if spec.Verify.SQL != "" {
+			target.Verify.SQL = spec.Verify.SQL
+		}
+		if spec.Verify.Timeout != nil {
+			target.Verify.Timeout = config.Duration(spec.Verify.Timeout.Duration)
+		}
+	}
+
+	if spec.WalVerify != nil {
+		target.Cron.WalVerify = spec.WalVerify.Schedule
+		if spec.WalVerify.Command != "" {
+			target.Exec.WalVerify = spec.WalVerify.Command
+		}
+		if spec.WalVerify.Timeout != nil {
+			target.Exec.WalVerifyTimeout = config.Duration(spec.WalVerify.Timeout.Duration)
+		}
+	}
+
+	if spec.SLA != nil {
+		if spec.SLA.MaxFullBackupAge != nil {
+			target.SLA.MaxFullBackupAge = config.Duration(spec.SLA.MaxFullBackupAge.Duration)
+		}
+		if spec.SLA.MaxBackupAge != nil {
+			target.SLA.MaxBackupAge = config.Duration(spec.SLA.MaxBackupAge.Duration)
+		}
+	}
+
+	if spec.Notification != nil {
+		if spec.Notification.Backup != nil {
+			target.Notification.Backup.Enabled = spec.Notification.Backup.Enabled
+			target.Notification.Backup.ChatIds = spec.Notification.Backup.Chats
+			target.Notification.Backup.FailureChatIds = spec.Notification.Backup.FailureChats
+		}
+		if spec.Notification.Info != nil {
+			target.Notification.Info.Enabled = spec.Notification.Info.Enabled
+			target.Notification.Info.ChatIds = spec.Notification.Info.Chats
+		}
+		if spec.Notification.Retention != nil {
+			target.Notification.Retention.Enabled = spec.Notification.Retention.Enabled
+			target.Notification.Retention.ChatIds = spec.Notification.Retention.Chats
+		}
+		if spec.Notification.Verify != nil {
+			target.Notification.Verify.Enabled = spec.Notification.Verify.Enabled
+			target.Notification.Verify.ChatIds = spec.Notification.Verify.Chats
+		}
+		if spec.Notification.SLA != nil {
+			target.Notification.SLA.Enabled = spec.Notification.SLA.Enabled
+			target.Notification.SLA.ChatIds = spec.Notification.SLA.Chats
+		}
+	}
+
+	if err := cfg.ValidateTarget(&target); err != nil {
+		return target, err
+	}
+
+	return target, nil
+}
+
+// Help func for set value, which is not empty in spec, empty value keeps default
+func setString(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTargetFromSchedule(t *testing.T) {
+	cfg := &config.Config{}
+
+	newSchedule := func(spec BackupScheduleSpec) *BackupSchedule {
+		return &BackupSchedule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "main-cluster"},
+			Spec:       spec,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		bs      *BackupSchedule
+		want    config.TargetConfig
+		wantErr bool
+	}{
+		{
+			name: "test spec with role and backup timeout",
+			bs: newSchedule(BackupScheduleSpec{
+				Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"cluster-name": "main"}},
+				Container: "postgres",
+				Role:      &RoleSpec{Label: "spilo-role", Policy: "prefer-replica"},
+				Backup: CommandSpec{
+					Schedule: "0 0 1 * * *",
+					Command:  "wal-g backup-push /data",
+					Timeout:  &metav1.Duration{Duration: 12 * time.Hour},
+				},
+			}),
+			want: config.TargetConfig{
+				Name: "bs_db_main_cluster_ebcb311c",
+				Pod: config.PodConfig{
+					Namespace:     "db",
+					LabelSelector: "cluster-name=main",
+					ContainerName: "postgres",
+					RoleLabel:     "spilo-role",
+					RolePolicy:    "prefer-replica",
+					LeaderValues:  []string{"master", "primary"},
+					ReplicaValues: []string{"replica"},
+				},
+				Exec: config.ExecConfig{
+					Backup:           "wal-g backup-push /data",
+					Info:             "echo 1",
+					WalVerify:        "wal-g wal-verify integrity timeline --json",
+					BackupTimeout:    config.Duration(12 * time.Hour),
+					InfoTimeout:      config.Duration(10 * time.Minute),
+					WalVerifyTimeout: config.Duration(30 * time.Minute),
+				},
+				Executor: config.ExecutorConfig{
+					Mode: "exec",
+				},
+				Retry: config.RetryConfig{
+					MaxAttempts:    1,
+					InitialBackoff: config.Duration(time.Minute),
+					MaxBackoff:     config.Duration(30 * time.Minute),
+					RetryOn:        []string{"pod_not_found", "pod_not_ready", "container_not_found", "stream"},
+				},
+				Overlap: config.OverlapConfig{
+					Policy: "skip",
+				},
+				CatchUp: config.CatchUpConfig{
+					Backup:    "skip",
+					Info:      "skip",
+					Retention: "skip",
+					Verify:    "skip",
+					WalVerify: "skip",
+					Window:    config.Duration(24 * time.Hour),
+				},
+				Retention: config.RetentionConfig{
+					List:    "wal-g backup-list --json --detail",
+					Delete:  "wal-g delete target FIND_FULL {backup} --confirm",
+					Mark:    "wal-g backup-mark {backup}",
+					Unmark:  "wal-g backup-mark -i {backup}",
+					Timeout: config.Duration(time.Hour),
+				},
+				Verify: config.VerifyConfig{
+					Restore: `wal-g backup-fetch "$PGDATA" {backup}` +
+						` && touch "$PGDATA/recovery.signal"` +
+						` && { echo "restore_command = 'wal-g wal-fetch %f %p'"; echo "recovery_target = 'immediate'";` +
+						` echo "recovery_target_action = 'pause'"; echo "archive_mode = off"; } >> "$PGDATA/postgresql.auto.conf"` +
+						` && pg_ctl -D "$PGDATA" -w -t 3600 start`,
+					Check:   "psql -v ON_ERROR_STOP=1 -At -c {sql}",
+					SQL:     "SELECT 1",
+					Timeout: config.Duration(6 * time.Hour),
+				},
+				Cron: config.CronConfig{
+					Backup: "0 0 1 * * *",
+				},
+			},
+		},
+		{
+			name: "test spec without selector",
+			bs: newSchedule(BackupScheduleSpec{
+				Container: "postgres",
+				Backup:    CommandSpec{Schedule: "0 0 1 * * *", Command: "backup"},
+			}),
+			wantErr: true,
+		},
+		{
+			name: "test spec with notifications without bot token",
+			bs: newSchedule(BackupScheduleSpec{
+				Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"cluster-name": "main"}},
+				Container: "postgres",
+				Backup:    CommandSpec{Schedule: "0 0 1 * * *", Command: "backup"},
+				Notification: &NotificationSpec{Backup: &BackupNotificationSpec{
+					NotificationRouteSpec: NotificationRouteSpec{Enabled: true, Chats: []int64{1}},
+				}},
+			}),
+			wantErr: true,
+		},
+		{
+			name: "test spec with failure notifications without bot token",
+			bs: newSchedule(BackupScheduleSpec{
+				Selector:     &metav1.LabelSelector{MatchLabels: map[string]string{"cluster-name": "main"}},
+				Container:    "postgres",
+				Backup:       CommandSpec{Schedule: "0 0 1 * * *", Command: "backup"},
+				Notification: &NotificationSpec{Backup: &BackupNotificationSpec{FailureChats: []int64{1}}},
+			}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := targetFromSchedule(cfg, tt.bs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("targetFromSchedule() \nerror = %v\nwantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targetFromSchedule() \ngot = %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetFromScheduleAllowedNamespaces(t *testing.T) {
+	spec := BackupScheduleSpec{
+		Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"cluster-name": "main"}},
+		Container: "postgres",
+		Backup:    CommandSpec{Schedule: "0 0 1 * * *", Command: "wal-g backup-push /data"},
+	}
+
+	tests := []struct {
+		name      string
+		allowed   []string
+		namespace string
+		wantErr   bool
+	}{
+		{
+			name:      "test all namespaces are allowed by default",
+			namespace: "db",
+		},
+		{
+			name:      "test resource in allowed namespace",
+			allowed:   []string{"db", "analytics"},
+			namespace: "analytics",
+		},
+		{
+			name:      "test resource in not allowed namespace",
+			allowed:   []string{"db"},
+			namespace: "team",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Controller: config.ControllerConfig{Enabled: true, AllowedNamespaces: tt.allowed}}
+			bs := &BackupSchedule{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace, Name: "main"},
+				Spec:       spec,
+			}
+
+			target, err := targetFromSchedule(cfg, bs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("targetFromSchedule() \nerror = %v\nwantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if !tt.wantErr && target.Pod.Namespace != tt.namespace {
+				t.Errorf("Pod.Namespace = %s, want namespace of resource %s", target.Pod.Namespace, tt.namespace)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Resource of BackupSchedule, manifest of CustomResourceDefinition is deploy/crd-backupschedule.yaml
+var BackupScheduleResource = schema.GroupVersionResource{
+	Group:    "walg.suchimauz.io",
+	Version:  "v1alpha1",
+	Resource: "backupschedules",
+}
+
+// BackupSchedule - declarative target: pods, commands, crons and notifications
+type BackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BackupScheduleSpec   `json:"spec"`
+	Status BackupScheduleStatus `json:"status,omitempty"`
+}
+
+type BackupScheduleSpec struct {
+	// Pods of database in namespace of resource
+	Selector  *metav1.LabelSelector `json:"selector"`
+	Container string                `json:"container"`
+	Role      *RoleSpec             `json:"role,omitempty"`
+	Backup    CommandSpec           `json:"backup"`
+	// Backups info, required when save logs or info notifications are enabled
+	Info      *CommandSpec   `json:"info,omitempty"`
+	Executor  *ExecutorSpec  `json:"executor,omitempty"`
+	Retry     *RetrySpec     `json:"retry,omitempty"`
+	Overlap   *OverlapSpec   `json:"overlap,omitempty"`
+	CatchUp   *CatchUpSpec   `json:"catchUp,omitempty"`
+	Retention *RetentionSpec `json:"retention,omitempty"`
+	Verify    *VerifySpec    `json:"verify,omitempty"`
+	// Check of WAL archive, reported to chats of info notifications
+	WalVerify *CommandSpec `json:"walVerify,omitempty"`
+	// Freshness of backups, it is checked by info job
+	SLA          *SLASpec          `json:"sla,omitempty"`
+	Notification *NotificationSpec `json:"notification,omitempty"`
+	// Jobs of suspended schedule are removed from cron
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+type RoleSpec struct {
+	Label         string   `json:"label"`
+	Policy        string   `json:"policy,omitempty"`
+	LeaderValues  []string `json:"leaderValues,omitempty"`
+	ReplicaValues []string `json:"replicaValues,omitempty"`
+}
+
+type CommandSpec struct {
+	Schedule string           `json:"schedule"`
+	Command  string           `json:"command,omitempty"`
+	Timeout  *metav1.Duration `json:"timeout,omitempty"`
+}
+
+type ExecutorSpec struct {
+	Mode string `json:"mode,omitempty"`
+	// Path to batch/v1 Job manifest in container of service
+	JobTemplate  string `json:"jobTemplate,omitempty"`
+	JobContainer string `json:"jobContainer,omitempty"`
+}
+
+type RetrySpec struct {
+	MaxAttempts    int              `json:"maxAttempts,omitempty"`
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+	MaxBackoff     *metav1.Duration `json:"maxBackoff,omitempty"`
+	RetryOn        []string         `json:"retryOn,omitempty"`
+}
+
+type OverlapSpec struct {
+	Policy        string `json:"policy,omitempty"`
+	NotifySkipped bool   `json:"notifySkipped,omitempty"`
+}
+
+// CatchUpSpec - policies of jobs for runs, which were missed, while service was down
+type CatchUpSpec struct {
+	Backup    string           `json:"backup,omitempty"`
+	Info      string           `json:"info,omitempty"`
+	Retention string           `json:"retention,omitempty"`
+	Verify    string           `json:"verify,omitempty"`
+	WalVerify string           `json:"walVerify,omitempty"`
+	Window    *metav1.Duration `json:"window,omitempty"`
+}
+
+// RetentionSpec - GFS retention of full backups, commands are defaults of variables
+type RetentionSpec struct {
+	Schedule      string           `json:"schedule"`
+	KeepDaily     int              `json:"keepDaily,omitempty"`
+	KeepWeekly    int              `json:"keepWeekly,omitempty"`
+	KeepMonthly   int              `json:"keepMonthly,omitempty"`
+	DryRun        bool             `json:"dryRun,omitempty"`
+	MarkPermanent bool             `json:"markPermanent,omitempty"`
+	Timeout       *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// VerifySpec - restore of latest full backup in Job from template, commands are defaults of variables
+type VerifySpec struct {
+	Schedule string `json:"schedule"`
+	// Path to batch/v1 Job manifest in container of service
+	JobTemplate  string           `json:"jobTemplate"`
+	JobContainer string           `json:"jobContainer,omitempty"`
+	SQL          string           `json:"sql,omitempty"`
+	Timeout      *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// SLASpec - max ages of newest backups, empty age disables check
+type SLASpec struct {
+	MaxFullBackupAge *metav1.Duration `json:"maxFullBackupAge,omitempty"`
+	MaxBackupAge     *metav1.Duration `json:"maxBackupAge,omitempty"`
+}
+
+type NotificationSpec struct {
+	Backup    *BackupNotificationSpec `json:"backup,omitempty"`
+	Info      *NotificationRouteSpec  `json:"info,omitempty"`
+	Retention *NotificationRouteSpec  `json:"retention,omitempty"`
+	Verify    *NotificationRouteSpec  `json:"verify,omitempty"`
+	SLA       *NotificationRouteSpec  `json:"sla,omitempty"`
+}
+
+type NotificationRouteSpec struct {
+	Enabled bool    `json:"enabled"`
+	Chats   []int64 `json:"chats,omitempty"`
+}
+
+type BackupNotificationSpec struct {
+	NotificationRouteSpec `json:",inline"`
+	// Chats for failed backups with sound, chats of route are used, when it is empty
+	FailureChats []int64 `json:"failureChats,omitempty"`
+}
+
+type BackupScheduleStatus struct {
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Name of target in logs and notifications
+	Target string `json:"target,omitempty"`
+	// Error of spec, jobs of resource are not scheduled, when it is not empty
+	Error         string     `json:"error,omitempty"`
+	LastBackup    *RunStatus `json:"lastBackup,omitempty"`
+	LastInfo      *RunStatus `json:"lastInfo,omitempty"`
+	LastRetention *RunStatus `json:"lastRetention,omitempty"`
+	LastVerify    *RunStatus `json:"lastVerify,omitempty"`
+	LastWalVerify *RunStatus `json:"lastWalVerify,omitempty"`
+	LatestBackup  string     `json:"latestBackup,omitempty"`
+}
+
+// RunStatus - result of last run of job
+type RunStatus struct {
+	Id         string      `json:"id"`
+	StartTime  metav1.Time `json:"startTime"`
+	FinishTime metav1.Time `json:"finishTime"`
+	// succeeded or failed
+	Result   string `json:"result"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+	ExitCode int    `json:"exitCode"`
+	Attempts int    `json:"attempts,omitempty"`
+}
@@ -0,0 +1,247 @@
+package history
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// Timeout of save of history after run of job
+const saveTimeout = 30 * time.Second
+
+// Max bytes of tail of command output in saved run, full tail is sent in notifications
+const outputMaxBytes = 512
+
+// Store - storage of history, runs are saved by read-modify-write,
+// so replicas, which become leader one after another, do not overwrite runs of each other
+type Store interface {
+	// Load saved runs
+	Load(ctx context.Context) ([]*job.Run, error)
+	// Replace saved runs by result of mutate, mutate may be called again on conflict
+	Update(ctx context.Context, mutate func(runs []*job.Run) []*job.Run) error
+}
+
+// History - finished runs of jobs of all targets, it implements job.RunObserver
+// Runs are kept in memory and saved to store after each run, oldest runs are removed by retention limits
+type History struct {
+	store   Store
+	maxRuns int
+	maxAge  time.Duration
+
+	mu sync.Mutex
+	// Sorted by start time, oldest first
+	runs []*job.Run
+}
+
+// Constructor
+func NewHistory(store Store, cfg *config.HistoryConfig) *History {
+	return &History{
+		store:   store,
+		maxRuns: cfg.MaxRuns,
+		maxAge:  cfg.MaxAge.Duration(),
+	}
+}
+
+// Load saved runs to memory, it is called on start before jobs are scheduled
+func (h *History) Load(ctx context.Context) error {
+	runs, err := h.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.runs = h.retain(mergeRuns(h.runs, runs), time.Now())
+
+	return nil
+}
+
+// Required method for job.RunObserver interface, run is saved to store with timeout
+// On error of store run is kept in memory and saved with next run
+func (h *History) ObserveRun(run *job.Run) {
+	// Run is copied, so history does not share it with job
+	record := *run
+	record.Output = trimOutput(record.Output)
+
+	h.mu.Lock()
+	h.runs = h.retain(mergeRuns(h.runs, []*job.Run{&record}), time.Now())
+	runs := h.runs
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	// Store is not called under lock, so slow store does not block readers of history
+	var saved []*job.Run
+	err := h.store.Update(ctx, func(stored []*job.Run) []*job.Run {
+		saved = h.retain(mergeRuns(stored, runs), time.Now())
+
+		return saved
+	})
+	if err != nil {
+		klog.Errorf("[History] %s: Save run %s: %s", run.Target, run.Id, err.Error())
+
+		return
+	}
+
+	// Runs, which were saved by other replicas, are loaded to memory too
+	h.mu.Lock()
+	h.runs = h.retain(mergeRuns(saved, h.runs), time.Now())
+	h.mu.Unlock()
+}
+
+// List runs of target and job, newest first, empty target or job matches all
+// Limit 0 means all runs
+func (h *History) List(target string, jobKind string, limit int) []*job.Run {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var runs []*job.Run
+	for i := len(h.runs) - 1; i >= 0; i-- {
+		run := h.runs[i]
+		if (target != "" && run.Target != target) || (jobKind != "" && run.Job != jobKind) {
+			continue
+		}
+
+		record := *run
+		runs = append(runs, &record)
+		if limit > 0 && len(runs) == limit {
+			break
+		}
+	}
+
+	return runs
+}
+
+// Get run by id, nil when it is not found
+// Run, which is missing in memory, is searched in store, because it may be saved by other replica
+func (h *History) Get(ctx context.Context, id uuid.UUID) (*job.Run, error) {
+	if run := h.find(id); run != nil {
+		return run, nil
+	}
+
+	runs, err := h.store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if run.Id == id {
+			return run, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Private method for find copy of run in memory by id
+func (h *History) find(id uuid.UUID) *job.Run {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := len(h.runs) - 1; i >= 0; i-- {
+		if h.runs[i].Id == id {
+			record := *h.runs[i]
+
+			return &record
+		}
+	}
+
+	return nil
+}
+
+// Required method for job.RunHistory interface
+func (h *History) LastSucceeded(target string, jobKind string) *job.Run {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := len(h.runs) - 1; i >= 0; i-- {
+		run := h.runs[i]
+		if run.Target == target && run.Job == jobKind && run.Status == job.RunSucceeded {
+			record := *run
+
+			return &record
+		}
+	}
+
+	return nil
+}
+
+// Private method for apply retention limits to sorted runs: max age and max runs of each job of target
+func (h *History) retain(runs []*job.Run, now time.Time) []*job.Run {
+	type jobKey struct{ target, job string }
+	counts := make(map[jobKey]int)
+
+	// Newest runs are counted first
+	kept := make([]bool, len(runs))
+	for i := len(runs) - 1; i >= 0; i-- {
+		run := runs[i]
+		if h.maxAge > 0 && now.Sub(run.StartedAt) > h.maxAge {
+			continue
+		}
+
+		key := jobKey{run.Target, run.Job}
+		if counts[key] >= h.maxRuns {
+			continue
+		}
+		counts[key]++
+		kept[i] = true
+	}
+
+	var retained []*job.Run
+	for i, run := range runs {
+		if kept[i] {
+			retained = append(retained, run)
+		}
+	}
+
+	return retained
+}
+
+// Help func for merge runs by ids, runs of second list replace same runs of first list
+// Result is sorted by start time, oldest first
+func mergeRuns(runs []*job.Run, added []*job.Run) []*job.Run {
+	byId := make(map[string]*job.Run, len(runs)+len(added))
+	for _, run := range runs {
+		byId[run.Id.String()] = run
+	}
+	for _, run := range added {
+		byId[run.Id.String()] = run
+	}
+
+	merged := make([]*job.Run, 0, len(byId))
+	for _, run := range byId {
+		merged = append(merged, run)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].StartedAt.Equal(merged[j].StartedAt) {
+			return merged[i].Id.String() < merged[j].Id.String()
+		}
+
+		return merged[i].StartedAt.Before(merged[j].StartedAt)
+	})
+
+	return merged
+}
+
+// Help func for keep end of command output, cut is made on start of UTF-8 symbol
+func trimOutput(output string) string {
+	if len(output) <= outputMaxBytes {
+		return output
+	}
+
+	start := len(output) - outputMaxBytes
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+
+	return output[start:]
+}
@@ -0,0 +1,201 @@
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHistoryObserveRun(t *testing.T) {
+	now := time.Now()
+	run := func(target string, jobKind string, age time.Duration) *job.Run {
+		return &job.Run{
+			Id:        uuid.New(),
+			Target:    target,
+			Job:       jobKind,
+			StartedAt: now.Add(-age),
+			Status:    job.RunSucceeded,
+		}
+	}
+	ids := func(runs []*job.Run) []uuid.UUID {
+		var ids []uuid.UUID
+		for _, run := range runs {
+			ids = append(ids, run.Id)
+		}
+
+		return ids
+	}
+
+	oldBackup := run("main", job.JobBackup, 72*time.Hour)
+	backup1 := run("main", job.JobBackup, 3*time.Hour)
+	backup2 := run("main", job.JobBackup, 2*time.Hour)
+	backup3 := run("main", job.JobBackup, time.Hour)
+	info := run("main", job.JobInfo, 30*time.Minute)
+	otherBackup := run("analytics", job.JobBackup, 10*time.Minute)
+
+	tests := []struct {
+		name     string
+		cfg      *config.HistoryConfig
+		runs     []*job.Run
+		target   string
+		jobKind  string
+		limit    int
+		wantRuns []*job.Run
+	}{
+		{
+			name:     "test runs are listed newest first",
+			cfg:      &config.HistoryConfig{MaxRuns: 10},
+			runs:     []*job.Run{backup1, info, backup2, otherBackup},
+			wantRuns: []*job.Run{otherBackup, info, backup2, backup1},
+		},
+		{
+			name:     "test max runs are kept for each job of target",
+			cfg:      &config.HistoryConfig{MaxRuns: 2},
+			runs:     []*job.Run{backup1, backup2, backup3, info, otherBackup},
+			target:   "main",
+			wantRuns: []*job.Run{info, backup3, backup2},
+		},
+		{
+			name:     "test runs older than max age are removed",
+			cfg:      &config.HistoryConfig{MaxRuns: 10, MaxAge: config.Duration(24 * time.Hour)},
+			runs:     []*job.Run{oldBackup, backup1},
+			wantRuns: []*job.Run{backup1},
+		},
+		{
+			name:     "test filter by job and limit",
+			cfg:      &config.HistoryConfig{MaxRuns: 10},
+			runs:     []*job.Run{backup1, backup2, info, backup3},
+			jobKind:  job.JobBackup,
+			limit:    2,
+			wantRuns: []*job.Run{backup3, backup2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := NewHistory(&MemoryStore{}, tt.cfg)
+			for _, run := range tt.runs {
+				history.ObserveRun(run)
+			}
+
+			got := history.List(tt.target, tt.jobKind, tt.limit)
+			if !reflect.DeepEqual(ids(got), ids(tt.wantRuns)) {
+				t.Errorf("List() \ngot = %v\nwant %v", ids(got), ids(tt.wantRuns))
+			}
+		})
+	}
+}
+
+func TestHistoryStores(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func() Store
+	}{
+		{
+			name: "test file store",
+			store: func() Store {
+				return NewFileStore(filepath.Join(t.TempDir(), "history.json"))
+			},
+		},
+		{
+			name: "test configmap store",
+			store: func() Store {
+				return NewConfigMapStore(fake.NewSimpleClientset(), "backup", "history")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store()
+			cfg := &config.HistoryConfig{MaxRuns: 10}
+
+			// Store is empty before first run
+			runs, err := store.Load(context.Background())
+			if err != nil || len(runs) != 0 {
+				t.Fatalf("Load() runs = %v, error = %v, want empty", runs, err)
+			}
+
+			// Runs of two replicas, which were leaders one after another
+			first := &job.Run{Id: uuid.New(), Target: "main", Job: job.JobBackup, StartedAt: time.Now().Add(-time.Hour).UTC(),
+				Status: job.RunFailed, Reason: "exit_code", ExitCode: 1, Output: "ERROR: connection refused"}
+			second := &job.Run{Id: uuid.New(), Target: "main", Job: job.JobBackup, StartedAt: time.Now().UTC(),
+				Status: job.RunSucceeded}
+
+			NewHistory(store, cfg).ObserveRun(first)
+			NewHistory(store, cfg).ObserveRun(second)
+
+			// History of new replica is loaded from store
+			history := NewHistory(store, cfg)
+			if err := history.Load(context.Background()); err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			got := history.List("", "", 0)
+			want := []*job.Run{second, first}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("List() \ngot = %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestHistoryLastSucceeded(t *testing.T) {
+	now := time.Now()
+	succeeded := &job.Run{Id: uuid.New(), Target: "main", Job: job.JobBackup, StartedAt: now.Add(-2 * time.Hour), Status: job.RunSucceeded}
+	failed := &job.Run{Id: uuid.New(), Target: "main", Job: job.JobBackup, StartedAt: now.Add(-time.Hour), Status: job.RunFailed}
+	info := &job.Run{Id: uuid.New(), Target: "main", Job: job.JobInfo, StartedAt: now, Status: job.RunSucceeded}
+
+	history := NewHistory(&MemoryStore{}, &config.HistoryConfig{MaxRuns: 10})
+	for _, run := range []*job.Run{succeeded, failed, info} {
+		history.ObserveRun(run)
+	}
+
+	if got := history.LastSucceeded("main", job.JobBackup); got == nil || got.Id != succeeded.Id {
+		t.Errorf("LastSucceeded() = %v, want %v", got, succeeded.Id)
+	}
+	if got := history.LastSucceeded("analytics", job.JobBackup); got != nil {
+		t.Errorf("LastSucceeded() = %v, want nil", got)
+	}
+}
+
+func TestMarshalRuns(t *testing.T) {
+	now := time.Now()
+
+	var runs []*job.Run
+	for i := 0; i < 100; i++ {
+		runs = append(runs, &job.Run{
+			Id:        uuid.New(),
+			Target:    "main",
+			Job:       job.JobBackup,
+			StartedAt: now.Add(time.Duration(i) * time.Minute),
+			Output:    strings.Repeat("x", outputMaxBytes),
+		})
+	}
+
+	maxBytes := 20 * 1024
+	content, err := marshalRuns(runs, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) > maxBytes {
+		t.Errorf("len(content) = %d, want at most %d", len(content), maxBytes)
+	}
+
+	saved, err := parseRuns(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Oldest runs are dropped, newest run is kept
+	if len(saved) == 0 || len(saved) == len(runs) || saved[len(saved)-1].Id != runs[len(runs)-1].Id {
+		t.Errorf("saved %d runs, want newest of %d runs", len(saved), len(runs))
+	}
+}
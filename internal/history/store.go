@@ -0,0 +1,243 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/job"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Key of history in data of ConfigMap
+const configMapKey = "history.json"
+
+// Max size of saved runs in ConfigMap, ConfigMap is limited by 1 MiB with metadata
+const configMapMaxBytes = 900 * 1024
+
+// Create store by config of history
+func NewStore(cfg *config.HistoryConfig, client kubernetes.Interface) (Store, error) {
+	switch cfg.Store {
+	case config.HistoryStoreMemory:
+		return &MemoryStore{}, nil
+	case config.HistoryStoreFile:
+		return NewFileStore(cfg.Path), nil
+	case config.HistoryStoreConfigMap:
+		return NewConfigMapStore(client, cfg.Namespace, cfg.ConfigMapName), nil
+	}
+
+	return nil, fmt.Errorf("History store %q is unknown", cfg.Store)
+}
+
+// MemoryStore - runs are not saved, history is lost on restart
+type MemoryStore struct{}
+
+// Required method for Store interface
+func (ms *MemoryStore) Load(ctx context.Context) ([]*job.Run, error) {
+	return nil, nil
+}
+
+// Required method for Store interface
+func (ms *MemoryStore) Update(ctx context.Context, mutate func(runs []*job.Run) []*job.Run) error {
+	mutate(nil)
+
+	return nil
+}
+
+// FileStore - runs are saved to JSON file, file is replaced atomically by rename
+type FileStore struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// Constructor
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Required method for Store interface, missing file is empty history
+func (fs *FileStore) Load(ctx context.Context) ([]*job.Run, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.read()
+}
+
+// Required method for Store interface
+func (fs *FileStore) Update(ctx context.Context, mutate func(runs []*job.Run) []*job.Run) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	runs, err := fs.read()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(mutate(runs))
+	if err != nil {
+		return err
+	}
+
+	// Temporary file in same directory, so rename does not cross file systems
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fs.path)
+}
+
+// Private method for read runs from file
+func (fs *FileStore) read() ([]*job.Run, error) {
+	content, err := os.ReadFile(fs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRuns(content)
+}
+
+// ConfigMapStore - runs are saved to ConfigMap, for deployments without persistent volume
+// Size of ConfigMap is limited by 1 MiB, so oldest runs are not saved, when history is larger
+type ConfigMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// Constructor
+func NewConfigMapStore(client kubernetes.Interface, namespace string, name string) *ConfigMapStore {
+	return &ConfigMapStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Required method for Store interface, missing ConfigMap is empty history
+func (cs *ConfigMapStore) Load(ctx context.Context) ([]*job.Run, error) {
+	cm, err := cs.client.CoreV1().ConfigMaps(cs.namespace).Get(ctx, cs.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseConfigMap(cm)
+}
+
+// Required method for Store interface, ConfigMap is created, when it is missing
+// Update is retried on conflict, when ConfigMap is changed by other replica
+func (cs *ConfigMapStore) Update(ctx context.Context, mutate func(runs []*job.Run) []*job.Run) error {
+	configMaps := cs.client.CoreV1().ConfigMaps(cs.namespace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, cs.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			content, err := marshalRuns(mutate(nil), configMapMaxBytes)
+			if err != nil {
+				return err
+			}
+
+			cm = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: cs.name, Namespace: cs.namespace},
+				Data:       map[string]string{configMapKey: string(content)},
+			}
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			// ConfigMap is created by other replica, it is updated on retry
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(v1.Resource("configmaps"), cs.name, err)
+			}
+
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		runs, err := parseConfigMap(cm)
+		if err != nil {
+			return err
+		}
+
+		content, err := marshalRuns(mutate(runs), configMapMaxBytes)
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[configMapKey] = string(content)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+
+		return err
+	})
+}
+
+// Help func for marshal runs sorted oldest first, oldest runs are dropped, until JSON fits in max bytes
+func marshalRuns(runs []*job.Run, maxBytes int) ([]byte, error) {
+	for {
+		content, err := json.Marshal(runs)
+		if err != nil || len(content) <= maxBytes || len(runs) == 0 {
+			return content, err
+		}
+
+		// Runs have similar size, so share of excess is dropped at once
+		drop := len(runs)*(len(content)-maxBytes)/len(content) + 1
+		if drop > len(runs) {
+			drop = len(runs)
+		}
+		runs = runs[drop:]
+	}
+}
+
+// Help func for parse runs from data of ConfigMap
+func parseConfigMap(cm *v1.ConfigMap) ([]*job.Run, error) {
+	content, ok := cm.Data[configMapKey]
+	if !ok {
+		return nil, nil
+	}
+
+	runs, err := parseRuns([]byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("ConfigMap %s/%s: %s", cm.Namespace, cm.Name, err.Error())
+	}
+
+	return runs, nil
+}
+
+// Help func for parse JSON of saved runs
+func parseRuns(content []byte) ([]*job.Run, error) {
+	var runs []*job.Run
+	if err := json.Unmarshal(content, &runs); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
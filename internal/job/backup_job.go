@@ -1,9 +1,13 @@
 package job
 
 import (
+	"context"
 	"fmt"
+	"html"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
@@ -12,103 +16,307 @@ import (
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	v1 "k8s.io/api/core/v1"
 )
 
 // BackupJob - struct for manage job, which send commands for make backup
 type BackupJob struct {
-	KubeJob        *kube.KubeJob
+	Target         string
+	Executor       kube.Executor
 	Notification   *config.TelegramNotificationBackupConfig
 	Exec           string
+	Timeout        time.Duration
+	Retry          *RetryPolicy
+	Overlap        *config.OverlapConfig
+	Guard          *RunGuard
 	TelegramBotApi *tgbotapi.BotAPI
+	// Nil when events are disabled
+	Events     *kube.EventRecorder
+	Observers  []RunObserver
+	Scheduling func() bool
+	// Context of new runs, cancelled on loss of leadership, nil means ctx
+	RunContext func() context.Context
+
+	// Parent context of all runs, cancelled on shutdown
+	ctx context.Context
 }
 
 // Constructor
-func NewBackupJob(telegramCfg *config.TelegramConfig, kj *kube.KubeJob, botapi *tgbotapi.BotAPI, exec string) *BackupJob {
+func NewBackupJob(ctx context.Context, target *config.TargetConfig, executor kube.Executor, guard *RunGuard, deps *Dependencies) *BackupJob {
 	return &BackupJob{
-		KubeJob:        kj,
-		Notification:   &telegramCfg.Notification.Backup,
-		Exec:           exec,
-		TelegramBotApi: botapi,
+		Target:         target.Name,
+		Executor:       executor,
+		Notification:   &target.Notification.Backup,
+		Exec:           target.Exec.Backup,
+		Timeout:        target.Exec.BackupTimeout.Duration(),
+		Retry:          NewRetryPolicy(&target.Retry),
+		Overlap:        &target.Overlap,
+		Guard:          guard,
+		TelegramBotApi: deps.TelegramBotApi,
+		Events:         deps.Events,
+		Observers:      deps.Observers,
+		Scheduling:     deps.Scheduling,
+		RunContext:     deps.RunContext,
+		ctx:            ctx,
 	}
 }
 
 // Main required method, which implements cron.Job interface
+// Run is skipped, queued or replaces previous run by overlap policy, when previous run is still running
 func (bj *BackupJob) Run() {
-	klog.Info("[BackupJob] Start processing Job!")
+	bj.runTriggered(uuid.New(), TriggerSchedule)
+}
 
-	// Make start message for send notification
-	guid, startMsg := bj.startBackupMessage()
+// Private method for get kind of job in runs
+func (bj *BackupJob) kind() string {
+	return JobBackup
+}
+
+// Private method for check previous run of job is still running
+func (bj *BackupJob) running() bool {
+	return bj.Guard.Running()
+}
+
+// Private method for run job by trigger in guard by overlap policy, see runGuarded
+// Error is returned, when run is skipped or queued run is cancelled
+func (bj *BackupJob) runTriggered(id uuid.UUID, trigger string) error {
+	return runGuarded(bj.ctx, "[BackupJob]", bj.Target, bj.Guard, bj.Overlap, bj.Scheduling, bj.RunContext, bj.notifySkipped, func(ctx context.Context) {
+		bj.run(ctx, id, trigger)
+	})
+}
+
+// Private method for run backup in guard, ctx is cancelled on shutdown or by replacing run
+func (bj *BackupJob) run(ctx context.Context, id uuid.UUID, trigger string) {
+	klog.Infof("[BackupJob] %s: Start processing Job!", bj.Target)
+
+	// Id is generated before run, so it may be returned to client of API
+	guid := id
+	run := newRun(guid, bj.Target, JobBackup, trigger)
+
+	// Start notification is sent once, when pod is selected first time
+	started := false
+	for {
+		run.Attempts++
+
+		placement, result, err := bj.attempt(ctx, run, !started)
+		if placement != nil {
+			started = true
+		}
+		if err == nil {
+			bj.succeed(run, placement, result)
+
+			return
+		}
+
+		// Run is failed, when failure is not retryable or attempts are over
+		delay, retry := bj.Retry.Next(run.Attempts, failureReason(result, err))
+		if !retry {
+			bj.fail(run, placement, result, err)
+
+			return
+		}
+
+		failure := failureMessage(result, err)
+		klog.Warnf("[BackupJob] %s: Attempt %d/%d is failed: %s, retry in %s",
+			bj.Target, run.Attempts, bj.Retry.MaxAttempts, failure, delay)
+		bj.Events.Record(placement, v1.EventTypeWarning, "BackupRetry",
+			fmt.Sprintf("Backup %s: attempt %d/%d is failed: %s", guid, run.Attempts, bj.Retry.MaxAttempts, failure))
+
+		if !waitRetry(ctx, delay) {
+			bj.fail(run, placement, nil, fmt.Errorf("%w: retry is cancelled", ctx.Err()))
+
+			return
+		}
+	}
+}
+
+// Private method for run one attempt: select pod or Job name and execute command with timeout
+// Placement is nil, when pod is not selected
+func (bj *BackupJob) attempt(ctx context.Context, run *Run, notifyStart bool) (*kube.Placement, *kube.ExecResult, error) {
+	// Command is cancelled after timeout, on shutdown or by replacing run
+	ctx, cancel := context.WithTimeout(ctx, bj.Timeout)
+	defer cancel()
+
+	// Pod and output of previous attempt are not related to this attempt
+	run.Pod, run.Output = "", ""
+
+	// Select pod or Job name for command before start notification
+	placement, err := bj.Executor.Prepare(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if placement.Note != "" {
+		klog.Warnf("[BackupJob] %s: %s", bj.Target, placement.Note)
+	}
+
+	run.Pod = placement.Pod
+	if placement.Job != "" {
+		run.Pod = placement.Job
+	}
+
+	bj.Events.Record(placement, v1.EventTypeNormal, "BackupStarted",
+		fmt.Sprintf("Backup %s is started, attempt %d: %s", run.Id, run.Attempts, bj.Exec))
+
+	if bj.Notification.Enabled && notifyStart {
+		// Make start message for send notification
+		startMsg := bj.startBackupMessage(run, placement)
 
-	if bj.Notification.Enabled {
 		// Send notification about start backup db
-		klog.Infof("[BackupJob] %s: Send start backup telegram notifications", guid)
+		klog.Infof("[BackupJob] %s: Send start backup telegram notifications", run.Id)
 
-		bj.sendNotifications(startMsg)
+		sendTelegram(bj.TelegramBotApi, "[BackupJob]", bj.Notification.ChatIds, startMsg, true)
 	}
 
 	// Execute on container EXEC_BACKUP cmd and return backups info
-	// Write logs to os stdout and stderr
-	if err := bj.KubeJob.Exec(bj.Exec, nil, os.Stdout, os.Stderr); err != nil {
-		klog.Errorf("[BackupJob] %s", err.Error())
-		klog.Error("[BackupJob] Exit Job!")
+	// Write logs to os stdout and stderr, tails of them are kept for failure notification
+	stdoutTail, stderrTail := newTailWriter(), newTailWriter()
+	result, err := bj.Executor.ExecIn(ctx, placement, bj.Exec, nil,
+		io.MultiWriter(os.Stdout, stdoutTail), io.MultiWriter(os.Stderr, stderrTail))
 
-		return
+	// Job pod has one log stream, so stdout is used, when stderr is empty
+	run.Output = stderrTail.String()
+	if run.Output == "" {
+		run.Output = stdoutTail.String()
+	}
+	if result != nil && result.Pod != "" {
+		run.Pod = result.Pod
 	}
 
+	return placement, result, err
+}
+
+// Private method for log, record event, report and notify succeeded backup
+func (bj *BackupJob) succeed(run *Run, placement *kube.Placement, result *kube.ExecResult) {
+	klog.Infof("[BackupJob] %s: %s", bj.Target, result.String())
+
+	run.succeed(result, result.String())
+	observeRun(bj.Observers, run)
+
+	bj.Events.Record(placement, v1.EventTypeNormal, "BackupSucceeded",
+		fmt.Sprintf("Backup %s is finished in %s", run.Id, result.Duration().Round(time.Second)))
+
 	if bj.Notification.Enabled {
 		// Make end message
-		endMsg := bj.endBackupMessage(guid)
+		endMsg := bj.endBackupMessage(run)
 
-		klog.Infof("[BackupJob] %s: Send end backup telegram notifications", guid)
+		klog.Infof("[BackupJob] %s: Send end backup telegram notifications", run.Id)
 
 		// Send notification about end backup db
-		bj.sendNotifications(endMsg)
+		sendTelegram(bj.TelegramBotApi, "[BackupJob]", bj.Notification.ChatIds, endMsg, true)
 	}
 
-	klog.Infof("[BackupJob] End processing Job!")
+	klog.Infof("[BackupJob] %s: End processing Job!", bj.Target)
 }
 
-// Private method for send telegram notifications
-func (bj *BackupJob) sendNotifications(msg string) {
-	// Iterate with config users chat-ids, who get backup notifications
-	for _, chatId := range bj.Notification.ChatIds {
-		tgmsg := tgbotapi.NewMessage(chatId, msg)
-		tgmsg.ParseMode = "HTMl"
-		tgmsg.DisableNotification = true
-
-		go func(gij *BackupJob, gtgmsg tgbotapi.MessageConfig) {
-			_, err := gij.TelegramBotApi.Send(gtgmsg)
-			if err != nil {
-				klog.Errorf("[BackupJob] Can't send tg notification: %s", err.Error())
-			}
-		}(bj, tgmsg)
+// Private method for log, record event, report and notify failed backup
+// Placement and result are nil, when command was not started
+func (bj *BackupJob) fail(run *Run, placement *kube.Placement, result *kube.ExecResult, err error) {
+	run.fail(result, err)
+
+	klog.Errorf("[BackupJob] %s: %s", bj.Target, run.Message)
+
+	recordFailureEvent(bj.Events, placement, bj.Target, "Backup", run.Reason,
+		fmt.Sprintf("Backup %s: %s", run.Id, run.Message))
+
+	observeRun(bj.Observers, run)
+
+	if chatIds := bj.Notification.FailureChats(); len(chatIds) > 0 {
+		klog.Infof("[BackupJob] %s: Send failed backup telegram notifications", run.Id)
+
+		// Send notification about failed backup db with sound
+		sendTelegram(bj.TelegramBotApi, "[BackupJob]", chatIds, bj.failedBackupMessage(run), false)
 	}
+
+	klog.Errorf("[BackupJob] %s: Exit Job!", bj.Target)
 }
 
-// Private method for generate start backup message
-func (bj *BackupJob) startBackupMessage() (uuid.UUID, string) {
-	// Generate new uuid for set id for this backup context
-	id := uuid.New()
+// Private method for notify skipped run
+func (bj *BackupJob) notifySkipped() {
+	if bj.Notification.Enabled && bj.Overlap.NotifySkipped {
+		klog.Infof("[BackupJob] %s: Send skipped backup telegram notifications", bj.Target)
+
+		sendTelegram(bj.TelegramBotApi, "[BackupJob]", bj.Notification.ChatIds, bj.skippedBackupMessage(), true)
+	}
+}
 
+// Private method for generate start backup message
+func (bj *BackupJob) startBackupMessage(run *Run, placement *kube.Placement) string {
 	// Get now date with Russian format
 	date := utils.NowDateTz().Format("02.01.2006 15:04")
 
-	msg := fmt.Sprintf("<b>%s</b>: start backup", strings.ToUpper(bj.KubeJob.PodSelector.Namespace))
-	msg += fmt.Sprintf("\n\nUuid: <b>%s</b>", id.String())
-	msg += fmt.Sprintf("\nCommand: <code>%s</code>", bj.Exec)
+	msg := fmt.Sprintf("<b>%s</b>: start backup", strings.ToUpper(bj.Target))
+	msg += fmt.Sprintf("\n\nUuid: <b>%s</b>", run.Id.String())
+	msg += triggerMessage(run.Trigger)
+	msg += fmt.Sprintf("\nCommand: <code>%s</code>", html.EscapeString(bj.Exec))
+	if placement.Job != "" {
+		msg += fmt.Sprintf("\nJob: <b>%s</b>", placement.Job)
+	} else {
+		msg += fmt.Sprintf("\nPod: <b>%s</b>", placement.Pod)
+	}
+	if placement.Role != "" {
+		msg += fmt.Sprintf("\nRole: <b>%s</b>", placement.Role)
+	}
+	if placement.Note != "" {
+		msg += fmt.Sprintf("\nFallback: %s", html.EscapeString(placement.Note))
+	}
+	if run.Attempts > 1 {
+		msg += fmt.Sprintf("\nAttempt: <b>%d/%d</b>", run.Attempts, bj.Retry.MaxAttempts)
+	}
 	msg += fmt.Sprintf("\nDate: <b>%s</b>\n", date)
 
-	return id, msg
+	return msg
 }
 
 // Private method for generate end backup message
-func (bj *BackupJob) endBackupMessage(id uuid.UUID) string {
+func (bj *BackupJob) endBackupMessage(run *Run) string {
 	// Get now date with Russian format
 	date := utils.NowDateTz().Format("02.01.2006 15:04")
 
-	msg := fmt.Sprintf("<b>%s</b>: end backup", strings.ToUpper(bj.KubeJob.PodSelector.Namespace))
-	msg += fmt.Sprintf("\n\nUuid: <b>%s</b>", id.String())
+	msg := fmt.Sprintf("<b>%s</b>: end backup", strings.ToUpper(bj.Target))
+	msg += fmt.Sprintf("\n\nUuid: <b>%s</b>", run.Id.String())
+	msg += triggerMessage(run.Trigger)
+	if run.Attempts > 1 {
+		msg += fmt.Sprintf("\nAttempts: <b>%d</b>", run.Attempts)
+	}
 	msg += fmt.Sprintf("\nDate: <b>%s</b>\n", date)
 
 	return msg
 }
+
+// Private method for generate skipped backup message
+func (bj *BackupJob) skippedBackupMessage() string {
+	// Get now date with Russian format
+	date := utils.NowDateTz().Format("02.01.2006 15:04")
+
+	msg := fmt.Sprintf("<b>%s</b>: backup skipped", strings.ToUpper(bj.Target))
+	msg += "\n\nReason: <b>previous backup is still running</b>"
+	msg += fmt.Sprintf("\nDate: <b>%s</b>\n", date)
+
+	return msg
+}
+
+// Private method for generate failed backup message
+func (bj *BackupJob) failedBackupMessage(run *Run) string {
+	// Get now date with Russian format
+	date := utils.NowDateTz().Format("02.01.2006 15:04")
+
+	msg := fmt.Sprintf("<b>%s</b>: backup failed", strings.ToUpper(bj.Target))
+	msg += fmt.Sprintf("\n\nUuid: <b>%s</b>", run.Id.String())
+	msg += triggerMessage(run.Trigger)
+	msg += fmt.Sprintf("\nReason: <b>%s</b>", run.Reason)
+	msg += fmt.Sprintf("\nError: <code>%s</code>", html.EscapeString(run.Message))
+	if run.ExitCode != kube.UnknownExitCode {
+		msg += fmt.Sprintf("\nExit code: <b>%d</b>", run.ExitCode)
+	}
+	msg += fmt.Sprintf("\nDuration: <b>%s</b>", run.FinishedAt.Sub(run.StartedAt).Round(time.Second))
+	if run.Pod != "" {
+		msg += fmt.Sprintf("\nPod: <b>%s</b>", run.Pod)
+	}
+	msg += fmt.Sprintf("\nAttempts: <b>%d/%d</b>", run.Attempts, bj.Retry.MaxAttempts)
+	msg += fmt.Sprintf("\nDate: <b>%s</b>\n", date)
+	if run.Output != "" {
+		msg = appendOutput(msg, run.Output)
+	}
+
+	return msg
+}
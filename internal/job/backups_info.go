@@ -0,0 +1,61 @@
+package job
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatestBackupsInfo - backups info of targets from last succeeded info runs of this replica
+type LatestBackupsInfo struct {
+	mu      sync.Mutex
+	targets map[string]*TargetBackupsInfo
+}
+
+// TargetBackupsInfo - backups info of target from info run
+type TargetBackupsInfo struct {
+	Target    string        `json:"target"`
+	Backups   []*BackupInfo `json:"backups"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// Constructor
+func NewLatestBackupsInfo() *LatestBackupsInfo {
+	return &LatestBackupsInfo{targets: make(map[string]*TargetBackupsInfo)}
+}
+
+// Update backups info of target, nil receiver does nothing, so info jobs do not check it
+func (lbi *LatestBackupsInfo) Update(target string, bi []*BackupInfo, updatedAt time.Time) {
+	if lbi == nil {
+		return
+	}
+
+	lbi.mu.Lock()
+	defer lbi.mu.Unlock()
+
+	lbi.targets[target] = &TargetBackupsInfo{Target: target, Backups: bi, UpdatedAt: updatedAt}
+}
+
+// Get backups info of target, nil when info run of target was not succeeded yet
+func (lbi *LatestBackupsInfo) Get(target string) *TargetBackupsInfo {
+	lbi.mu.Lock()
+	defer lbi.mu.Unlock()
+
+	return lbi.targets[target]
+}
+
+// List backups info of all targets, sorted by target
+func (lbi *LatestBackupsInfo) List() []*TargetBackupsInfo {
+	lbi.mu.Lock()
+	defer lbi.mu.Unlock()
+
+	list := make([]*TargetBackupsInfo, 0, len(lbi.targets))
+	for _, info := range lbi.targets {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Target < list[j].Target
+	})
+
+	return list
+}
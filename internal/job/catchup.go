@@ -0,0 +1,81 @@
+package job
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+
+	cr "github.com/robfig/cron/v3"
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// CatchUp runs once jobs of all targets, which missed their schedules, by catch-up policies of targets
+// It is called on start of scheduling, runs of other replicas must be loaded to history before it
+func (r *Registry) CatchUp() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Targets, which are added after it, are caught up on add
+	r.caughtUp = true
+
+	for _, registered := range r.targets {
+		r.catchUp(registered)
+	}
+}
+
+// Private method for run missed jobs of target in own goroutines
+func (r *Registry) catchUp(registered *registeredTarget) {
+	if r.deps.History == nil {
+		return
+	}
+
+	target := registered.target
+	now := time.Now()
+
+	for _, entryId := range registered.entryIds {
+		entry := r.cron.Entry(entryId)
+		job, ok := entry.Job.(targetJob)
+		if !ok || target.CatchUp.Policy(job.kind()) != config.CatchUpPolicyOnce {
+			continue
+		}
+
+		// Without succeeded runs, for example new target, missed schedule is unknown
+		last := r.deps.History.LastSucceeded(target.Name, job.kind())
+		if last == nil {
+			continue
+		}
+
+		missed, ok := missedRun(entry.Schedule, last.StartedAt, target.CatchUp.Window.Duration(), now)
+		if !ok {
+			continue
+		}
+
+		klog.Warnf("[Registry] %s: Run of %s job at %s is missed, last succeeded run at %s, catch up",
+			target.Name, job.kind(), missed.In(config.TimeZone).Format(time.RFC3339),
+			last.StartedAt.In(config.TimeZone).Format(time.RFC3339))
+
+		r.runs.Add(1)
+		go func(job targetJob) {
+			defer r.runs.Done()
+
+			job.runTriggered(uuid.New(), TriggerCatchUp)
+		}(job)
+	}
+}
+
+// Help func for find first fire time of schedule after last run, which is missed before now
+// Fire times, which are older than window, are not missed
+func missedRun(schedule cr.Schedule, last time.Time, window time.Duration, now time.Time) (time.Time, bool) {
+	from := last
+	if windowStart := now.Add(-window); windowStart.After(from) {
+		from = windowStart
+	}
+
+	next := schedule.Next(from)
+	if next.After(now) {
+		return time.Time{}, false
+	}
+
+	return next, true
+}
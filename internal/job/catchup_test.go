@@ -0,0 +1,73 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	cr "github.com/robfig/cron/v3"
+)
+
+func TestMissedRun(t *testing.T) {
+	parser := cr.NewParser(cr.Second | cr.Minute | cr.Hour | cr.Dom | cr.Month | cr.Dow)
+	// Daily at 21:00
+	schedule, err := parser.Parse("0 0 21 * * *")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	date := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatalf("time.Parse() error = %v", err)
+		}
+
+		return parsed
+	}
+
+	tests := []struct {
+		name       string
+		last       string
+		now        string
+		window     time.Duration
+		wantMissed string
+	}{
+		{
+			name:       "test run of last evening is missed",
+			last:       "2024-01-09 21:00",
+			now:        "2024-01-11 08:00",
+			window:     24 * time.Hour,
+			wantMissed: "2024-01-10 21:00",
+		},
+		{
+			name:   "test next run is not fired yet",
+			last:   "2024-01-10 21:00",
+			now:    "2024-01-11 08:00",
+			window: 24 * time.Hour,
+		},
+		{
+			name:   "test missed runs are older than window",
+			last:   "2024-01-01 21:00",
+			now:    "2024-01-11 08:00",
+			window: 6 * time.Hour,
+		},
+		{
+			name:       "test newest missed run in window",
+			last:       "2024-01-01 21:00",
+			now:        "2024-01-11 08:00",
+			window:     24 * time.Hour,
+			wantMissed: "2024-01-10 21:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, ok := missedRun(schedule, date(tt.last), tt.window, date(tt.now))
+			if ok != (tt.wantMissed != "") {
+				t.Fatalf("missedRun() ok = %v, want missed %q", ok, tt.wantMissed)
+			}
+			if ok && !missed.Equal(date(tt.wantMissed)) {
+				t.Errorf("missedRun() = %v, want %v", missed, tt.wantMissed)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package job
+
+import (
+	"context"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/metadata"
+
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Discover targets by annotations each interval and sync them to registry, until ctx is cancelled
+// When list of objects is failed, registry is not changed
+func RunDiscovery(ctx context.Context, cfg *config.Config, registry *Registry) {
+	annotation := cfg.Discovery.Annotation(config.AnnotationSchedule)
+
+	// Pods are listed by metadata only, full pods of all namespaces are not read each interval
+	meta, err := metadata.NewForConfig(registry.deps.KubeConfig)
+	if err != nil {
+		klog.Errorf("[Discovery] Create metadata client: %s", err.Error())
+
+		return
+	}
+
+	last := make(discoveredTargets)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		objects, err := kube.FindAnnotatedObjects(ctx, registry.deps.Client, meta, cfg.Discovery.Namespaces, annotation)
+		if err != nil {
+			klog.Errorf("[Discovery] %s", err.Error())
+
+			return
+		}
+
+		targets := last.build(cfg, objects, registry.deps.Events)
+		if err := registry.Sync(SourceDiscovery, targets); err != nil {
+			klog.Errorf("[Discovery] %s", err.Error())
+		}
+	}, cfg.Discovery.Interval.Duration())
+}
+
+// discoveredTargets - last valid targets of discovered objects by kinds, namespaces and names of objects
+type discoveredTargets map[string]config.TargetConfig
+
+// Private method for build targets of objects and remember valid ones, targets of missing objects are forgotten
+// Object with invalid annotations keeps its last valid target, so typo in annotation does not unschedule backups,
+// error is recorded by Warning event on object
+func (dt discoveredTargets) build(cfg *config.Config, objects []kube.AnnotatedObject, events *kube.EventRecorder) []config.TargetConfig {
+	var targets []config.TargetConfig
+	seen := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		key := obj.Kind + "/" + obj.Namespace + "/" + obj.Name
+		seen[key] = true
+
+		target, err := cfg.DiscoveredTarget(obj)
+		if err == nil {
+			dt[key] = target
+			targets = append(targets, target)
+
+			continue
+		}
+
+		last, ok := dt[key]
+		message := err.Error()
+		if ok {
+			message += ", last valid target " + last.Name + " is kept"
+			targets = append(targets, last)
+		}
+		klog.Errorf("[Discovery] %s", message)
+		events.Record(&kube.Placement{PodRef: obj.Reference()}, v1.EventTypeWarning, "InvalidAnnotations", message)
+	}
+
+	for key := range dt {
+		if !seen[key] {
+			delete(dt, key)
+		}
+	}
+
+	return targets
+}
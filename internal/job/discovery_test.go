@@ -0,0 +1,53 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
+)
+
+func TestDiscoveredTargetsBuild(t *testing.T) {
+	template := config.NewTargetConfig("")
+	template.Exec.Backup = "wal-g backup-push /data"
+	cfg := &config.Config{
+		Discovery: config.DiscoveryConfig{
+			AnnotationPrefix: "walg-backup",
+			Template:         &template,
+		},
+	}
+
+	newObject := func(annotations map[string]string) kube.AnnotatedObject {
+		return kube.AnnotatedObject{
+			Kind:             "StatefulSet",
+			Namespace:        "db",
+			Name:             "main",
+			LabelSelector:    "app=main",
+			DefaultContainer: "postgres",
+			Annotations:      annotations,
+		}
+	}
+	valid := newObject(map[string]string{"walg-backup/schedule": "0 0 1 * * *", "walg-backup/name": "main"})
+	invalid := newObject(map[string]string{"walg-backup/schedule": "0 0 1 * * *", "walg-backup/name": "main-db"})
+
+	last := make(discoveredTargets)
+
+	targets := last.build(cfg, []kube.AnnotatedObject{valid}, nil)
+	if len(targets) != 1 || targets[0].Name != "main" {
+		t.Fatalf("targets of valid object = %+v, want target main", targets)
+	}
+
+	// Invalid annotations keep last valid target
+	targets = last.build(cfg, []kube.AnnotatedObject{invalid}, nil)
+	if len(targets) != 1 || targets[0].Name != "main" {
+		t.Fatalf("targets of invalid object = %+v, want last valid target main", targets)
+	}
+
+	// Target of missing object is forgotten, invalid object without valid target is skipped
+	if targets = last.build(cfg, nil, nil); len(targets) != 0 {
+		t.Fatalf("targets without objects = %+v, want empty", targets)
+	}
+	if targets = last.build(cfg, []kube.AnnotatedObject{invalid}, nil); len(targets) != 0 {
+		t.Fatalf("targets of invalid object after remove = %+v, want empty", targets)
+	}
+}
@@ -0,0 +1,100 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Failure reasons of command execution
+const (
+	FailurePodNotFound       = "pod_not_found"
+	FailurePodNotReady       = "pod_not_ready"
+	FailureContainerNotFound = "container_not_found"
+	FailureExitCode          = "exit_code"
+	FailureStream            = "stream"
+	FailureTimeout           = "timeout"
+	FailureCancelled         = "cancelled"
+	FailureOutput            = "output"
+	FailureNoBackups         = "no_backups"
+	FailureWalVerify         = "wal_verify"
+)
+
+// Command is finished, but its output is invalid, for example info command wrote to stderr
+var errInvalidOutput = errors.New("invalid output of command")
+
+// Help func for classify error of kube.KubeJob.Exec
+func failureReason(result *kube.ExecResult, err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return FailureTimeout
+	case errors.Is(err, context.Canceled):
+		return FailureCancelled
+	case errors.Is(err, kube.ErrPodNotFound):
+		return FailurePodNotFound
+	case errors.Is(err, kube.ErrPodNotReady):
+		return FailurePodNotReady
+	case errors.Is(err, kube.ErrContainerNotFound):
+		return FailureContainerNotFound
+	case errors.Is(err, errInvalidOutput):
+		return FailureOutput
+	case errors.Is(err, errNoFullBackups):
+		return FailureNoBackups
+	case errors.Is(err, errWalVerify):
+		return FailureWalVerify
+	case result != nil && result.Exited():
+		return FailureExitCode
+	}
+
+	return FailureStream
+}
+
+// Help func for make human readable failure description with execution details
+func failureMessage(result *kube.ExecResult, err error) string {
+	// Command was not started, when pod is not selected
+	if result == nil {
+		result = &kube.ExecResult{ExitCode: kube.UnknownExitCode}
+	}
+	reason := failureReason(result, err)
+
+	// Context is done before command is started
+	if (reason == FailureTimeout || reason == FailureCancelled) && result.StartedAt.IsZero() {
+		return fmt.Sprintf("%s: %s", reason, err.Error())
+	}
+
+	switch reason {
+	case FailureTimeout:
+		return fmt.Sprintf("%s: command is not finished in %s, pod %s, container %s",
+			reason, result.Duration().Round(time.Second), result.Pod, result.Container)
+	case FailureCancelled:
+		return fmt.Sprintf("%s: command is cancelled on shutdown or by replacing run, pod %s, container %s",
+			reason, result.Pod, result.Container)
+	case FailurePodNotFound, FailurePodNotReady, FailureContainerNotFound, FailureOutput, FailureNoBackups, FailureWalVerify:
+		return fmt.Sprintf("%s: %s", reason, err.Error())
+	case FailureExitCode:
+		return fmt.Sprintf("%s: command exited with code %d in pod %s, container %s after %s",
+			reason, result.ExitCode, result.Pod, result.Container, result.Duration().Round(time.Second))
+	}
+
+	return fmt.Sprintf("%s: %s (%s)", reason, err.Error(), result.String())
+}
+
+// Help func for record warning event about failed run, timeout has own reason
+// Event reasons are <prefix>Failed and <prefix>Timeout, for example BackupTimeout
+// When pod is not selected, event is recorded on pod of service, so target is added to message
+func recordFailureEvent(events *kube.EventRecorder, placement *kube.Placement, target string, prefix string, reason string, failure string) {
+	eventReason := prefix + "Failed"
+	if reason == FailureTimeout {
+		eventReason = prefix + "Timeout"
+	}
+	if placement == nil || placement.PodRef == nil {
+		failure = fmt.Sprintf("Target %s: %s", target, failure)
+	}
+
+	events.Record(placement, v1.EventTypeWarning, eventReason, failure)
+}
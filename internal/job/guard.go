@@ -0,0 +1,153 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// Run is skipped by overlap policy skip
+var ErrRunning = errors.New("Previous run is still running")
+
+// Waiting run is dropped by newer run with overlap policy replace
+var ErrReplaced = errors.New("Waiting run is replaced by newer run")
+
+// RunGuard - slot for one running run of job, new run is skipped, queued or replaces running run by overlap policy
+// Guard is shared by all runs of job of target, also after replace of jobs, when target is changed
+type RunGuard struct {
+	// Holds value while run is running
+	slot chan struct{}
+
+	mu sync.Mutex
+	// Cancel of running run, nil when nothing is running
+	cancel context.CancelFunc
+	// Cancel of waiting run with policy replace, only latest run waits
+	waiting context.CancelFunc
+}
+
+// Constructor
+func NewRunGuard() *RunGuard {
+	return &RunGuard{
+		slot: make(chan struct{}, 1),
+	}
+}
+
+// Run fn in guard with context of run, which is cancelled with ctx or by replacing run
+// ErrRunning is returned, when run is skipped, ErrReplaced, when waiting run is replaced by newer run,
+// ctx error, when ctx is done while waiting previous run
+func (g *RunGuard) Do(ctx context.Context, policy string, fn func(ctx context.Context)) error {
+	waitCtx := ctx
+	switch policy {
+	case config.OverlapPolicySkip:
+		select {
+		case g.slot <- struct{}{}:
+		default:
+			return ErrRunning
+		}
+	case config.OverlapPolicyReplace:
+		var cancelWait context.CancelFunc
+		waitCtx, cancelWait = context.WithCancel(ctx)
+		defer cancelWait()
+
+		// Running run and older waiting run are cancelled, so only this run waits
+		g.mu.Lock()
+		if g.cancel != nil {
+			g.cancel()
+		}
+		if g.waiting != nil {
+			g.waiting()
+		}
+		g.waiting = cancelWait
+		g.mu.Unlock()
+
+		fallthrough
+	default:
+		// Queue: wait finish of previous run
+		select {
+		case g.slot <- struct{}{}:
+		case <-waitCtx.Done():
+			return waitError(ctx)
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	g.mu.Lock()
+	// Newer run may replace this run after slot is taken, but before cancel is set
+	if waitCtx.Err() != nil {
+		g.mu.Unlock()
+		cancel()
+		<-g.slot
+
+		return waitError(ctx)
+	}
+	g.cancel = cancel
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		g.cancel = nil
+		g.mu.Unlock()
+
+		cancel()
+		<-g.slot
+	}()
+
+	fn(runCtx)
+
+	return nil
+}
+
+// Check run of job is running now
+func (g *RunGuard) Running() bool {
+	return len(g.slot) > 0
+}
+
+// Help func for error of run, which is stopped while waiting
+func waitError(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return ErrReplaced
+}
+
+// Help func for run job of target in guard by overlap policy, tag is prefix of logs of job, for example [BackupJob]
+// Run is started with context of runContext, when it is set, so run is cancelled on loss of leadership
+// Queued run is dropped, when scheduling is stopped while it waits, skipped run is passed to onSkip, it may be nil
+// Error is returned, when run is skipped or queued run is cancelled
+func runGuarded(ctx context.Context, tag string, target string, guard *RunGuard, overlap *config.OverlapConfig,
+	scheduling func() bool, runContext func() context.Context, onSkip func(), fn func(ctx context.Context)) error {
+	if runContext != nil {
+		ctx = runContext()
+	}
+	if guard.Running() {
+		klog.Warnf("%s %s: Previous run is still running, overlap policy: %s", tag, target, overlap.Policy)
+	}
+
+	err := guard.Do(ctx, overlap.Policy, func(ctx context.Context) {
+		// Queued run may wait previous run longer than leadership or until shutdown
+		if scheduling != nil && !scheduling() {
+			klog.Warnf("%s %s: Scheduling is stopped, queued run is dropped", tag, target)
+
+			return
+		}
+
+		fn(ctx)
+	})
+	switch {
+	case errors.Is(err, ErrRunning):
+		klog.Warnf("%s %s: Run is skipped by overlap policy", tag, target)
+
+		if onSkip != nil {
+			onSkip()
+		}
+	case err != nil:
+		klog.Warnf("%s %s: Queued run is cancelled: %s", tag, target, err.Error())
+	}
+
+	return err
+}
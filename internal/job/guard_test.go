@@ -0,0 +1,228 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+)
+
+func TestRunGuardDo(t *testing.T) {
+	tests := []struct {
+		name string
+		// Policy of second run, while first run is running
+		policy       string
+		wantErr      error
+		wantRun      bool
+		wantCanceled bool
+	}{
+		{
+			name:    "test second run is skipped",
+			policy:  config.OverlapPolicySkip,
+			wantErr: ErrRunning,
+		},
+		{
+			name:    "test second run is queued",
+			policy:  config.OverlapPolicyQueue,
+			wantRun: true,
+		},
+		{
+			name:         "test second run replaces first run",
+			policy:       config.OverlapPolicyReplace,
+			wantRun:      true,
+			wantCanceled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := NewRunGuard()
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			canceled := make(chan bool, 1)
+			firstDone := make(chan struct{})
+
+			go func() {
+				defer close(firstDone)
+
+				guard.Do(context.Background(), config.OverlapPolicySkip, func(ctx context.Context) {
+					close(started)
+					select {
+					case <-ctx.Done():
+						canceled <- true
+					case <-release:
+						canceled <- false
+					}
+				})
+			}()
+			<-started
+
+			if !guard.Running() {
+				t.Fatalf("Running() = false, while first run is running")
+			}
+
+			// Queued run waits release of first run
+			if tt.policy == config.OverlapPolicyQueue {
+				time.AfterFunc(10*time.Millisecond, func() { close(release) })
+			}
+
+			ran := false
+			err := guard.Do(context.Background(), tt.policy, func(ctx context.Context) {
+				ran = true
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ran != tt.wantRun {
+				t.Errorf("Do() ran = %t, want %t", ran, tt.wantRun)
+			}
+
+			if tt.policy == config.OverlapPolicySkip {
+				close(release)
+			}
+			<-firstDone
+			if got := <-canceled; got != tt.wantCanceled {
+				t.Errorf("first run canceled = %t, want %t", got, tt.wantCanceled)
+			}
+			if guard.Running() {
+				t.Errorf("Running() = true, after all runs are finished")
+			}
+		})
+	}
+}
+
+func TestRunGuardDoCanceledWhileQueued(t *testing.T) {
+	guard := NewRunGuard()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	go guard.Do(context.Background(), config.OverlapPolicySkip, func(ctx context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := guard.Do(ctx, config.OverlapPolicyQueue, func(ctx context.Context) {
+		t.Errorf("queued run is started, while first run is running")
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRunGuardDoReplaceKeepsLatestWaiting(t *testing.T) {
+	guard := NewRunGuard()
+
+	// First run finishes only after release, as remote command, which is terminated slowly
+	started := make(chan struct{})
+	release := make(chan struct{})
+	canceled := make(chan bool, 1)
+	go guard.Do(context.Background(), config.OverlapPolicySkip, func(ctx context.Context) {
+		close(started)
+		<-release
+		canceled <- ctx.Err() != nil
+	})
+	<-started
+
+	secondErr := make(chan error, 1)
+	go func() {
+		secondErr <- guard.Do(context.Background(), config.OverlapPolicyReplace, func(ctx context.Context) {
+			t.Errorf("second run is started, but it is replaced by third run")
+		})
+	}()
+
+	// Second run is waiting, when third run replaces it
+	for waiting := false; !waiting; time.Sleep(time.Millisecond) {
+		guard.mu.Lock()
+		waiting = guard.waiting != nil
+		guard.mu.Unlock()
+	}
+
+	thirdErr := make(chan error, 1)
+	thirdRan := make(chan bool, 1)
+	go func() {
+		thirdErr <- guard.Do(context.Background(), config.OverlapPolicyReplace, func(ctx context.Context) {
+			thirdRan <- true
+		})
+	}()
+
+	if err := <-secondErr; !errors.Is(err, ErrReplaced) {
+		t.Errorf("second Do() error = %v, want %v", err, ErrReplaced)
+	}
+
+	close(release)
+	if got := <-canceled; !got {
+		t.Errorf("first run canceled = false, want true")
+	}
+	if err := <-thirdErr; err != nil {
+		t.Errorf("third Do() error = %v, want nil", err)
+	}
+	if len(thirdRan) != 1 {
+		t.Errorf("third run is not started")
+	}
+}
+
+func TestRunGuarded(t *testing.T) {
+	guard := NewRunGuard()
+	overlap := &config.OverlapConfig{Policy: config.OverlapPolicySkip}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	firstDone := make(chan struct{})
+	go func() {
+		defer close(firstDone)
+
+		runGuarded(context.Background(), "[TestJob]", "main", guard, overlap, nil, nil, nil, func(ctx context.Context) {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+
+	// Skipped run is passed to onSkip
+	skipped := false
+	err := runGuarded(context.Background(), "[TestJob]", "main", guard, overlap, nil, nil, func() { skipped = true }, func(ctx context.Context) {
+		t.Errorf("second run is started, while first run is running")
+	})
+	if !errors.Is(err, ErrRunning) {
+		t.Errorf("runGuarded() error = %v, want %v", err, ErrRunning)
+	}
+	if !skipped {
+		t.Errorf("onSkip is not called for skipped run")
+	}
+
+	close(release)
+	<-firstDone
+
+	// Run is dropped, when scheduling is stopped
+	err = runGuarded(context.Background(), "[TestJob]", "main", guard, overlap, func() bool { return false }, nil, nil, func(ctx context.Context) {
+		t.Errorf("run is started, while scheduling is stopped")
+	})
+	if err != nil {
+		t.Errorf("runGuarded() error = %v, want nil", err)
+	}
+
+	// Run is started with run context, so it is cancelled on loss of leadership
+	term, cancelTerm := context.WithCancel(context.Background())
+	runContext := func() context.Context { return term }
+	err = runGuarded(context.Background(), "[TestJob]", "main", guard, overlap, nil, runContext, nil, func(ctx context.Context) {
+		cancelTerm()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Errorf("run is not cancelled with run context")
+		}
+	})
+	if err != nil {
+		t.Errorf("runGuarded() error = %v, want nil", err)
+	}
+}
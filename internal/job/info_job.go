@@ -5,8 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"regexp"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
 	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
 	"github.com/suchimauz/walg-k8s-cron-backup/pkg/storage"
@@ -14,105 +18,379 @@ import (
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	v1 "k8s.io/api/core/v1"
 )
 
 // InfoJob - struct for manage job, which send notifications of backups and etc
 type InfoJob struct {
-	Storage        storage.Provider
-	KubeJob        *kube.KubeJob
-	Notification   *config.TelegramNotificationInfoConfig
-	Exec           string
-	TelegramBotApi *tgbotapi.BotAPI
+	Target       string
+	Storage      storage.Provider
+	KubeJob      *kube.KubeJob
+	Notification *config.TelegramNotificationInfoConfig
+	SLA          *config.SLAConfig
+	// Shared by replaced jobs of target, so unchanged violation is not alerted again
+	SLAState        *SLAState
+	SLANotification *config.TelegramNotificationSLAConfig
+	Exec            string
+	Timeout         time.Duration
+	Retry           *RetryPolicy
+	Overlap         *config.OverlapConfig
+	Guard           *RunGuard
+	TelegramBotApi  *tgbotapi.BotAPI
+	// Nil when events are disabled
+	Events     *kube.EventRecorder
+	Observers  []RunObserver
+	Scheduling func() bool
+	// Context of new runs, cancelled on loss of leadership, nil means ctx
+	RunContext func() context.Context
+	// Last received backups info of targets, SLA is checked by it, when info command fails
+	BackupsInfo *LatestBackupsInfo
+
+	// Parent context of all runs, cancelled on shutdown
+	ctx context.Context
 }
 
 // Constructor
-func NewInfoJob(telegramCfg *config.TelegramConfig, kj *kube.KubeJob, botapi *tgbotapi.BotAPI, storageProvider storage.Provider, exec string) *InfoJob {
+func NewInfoJob(ctx context.Context, target *config.TargetConfig, kj *kube.KubeJob, guard *RunGuard, slaState *SLAState, deps *Dependencies) *InfoJob {
 	return &InfoJob{
-		Storage:        storageProvider,
-		KubeJob:        kj,
-		Notification:   &telegramCfg.Notification.Info,
-		Exec:           exec,
-		TelegramBotApi: botapi,
+		Target:          target.Name,
+		Storage:         deps.Storage,
+		KubeJob:         kj,
+		Notification:    &target.Notification.Info,
+		SLA:             &target.SLA,
+		SLAState:        slaState,
+		SLANotification: &target.Notification.SLA,
+		Exec:            target.Exec.Info,
+		Timeout:         target.Exec.InfoTimeout.Duration(),
+		Retry:           NewRetryPolicy(&target.Retry),
+		Overlap:         &target.Overlap,
+		Guard:           guard,
+		TelegramBotApi:  deps.TelegramBotApi,
+		Events:          deps.Events,
+		Observers:       deps.Observers,
+		Scheduling:      deps.Scheduling,
+		RunContext:      deps.RunContext,
+		BackupsInfo:     deps.BackupsInfo,
+		ctx:             ctx,
 	}
 }
 
 // Main func for Run this job, implements for cron.Job interface
+// Run is skipped, queued or replaces previous run by overlap policy, when previous run is still running
 func (ij *InfoJob) Run() {
-	klog.Info("[NotifierJob] Start processing Job!")
+	ij.runTriggered(uuid.New(), TriggerSchedule)
+}
+
+// Private method for get kind of job in runs
+func (ij *InfoJob) kind() string {
+	return JobInfo
+}
+
+// Private method for check previous run of job is still running
+func (ij *InfoJob) running() bool {
+	return ij.Guard.Running()
+}
+
+// Private method for run job by trigger in guard by overlap policy, see runGuarded
+// Error is returned, when run is skipped or queued run is cancelled
+func (ij *InfoJob) runTriggered(id uuid.UUID, trigger string) error {
+	return runGuarded(ij.ctx, "[NotifierJob]", ij.Target, ij.Guard, ij.Overlap, ij.Scheduling, ij.RunContext, ij.notifySkipped, func(ctx context.Context) {
+		ij.run(ctx, id, trigger)
+	})
+}
+
+// Private method for run info command in guard, ctx is cancelled on shutdown or by replacing run
+func (ij *InfoJob) run(ctx context.Context, id uuid.UUID, trigger string) {
+	klog.Infof("[NotifierJob] %s: Start processing Job!", ij.Target)
+
+	run := newRun(id, ij.Target, JobInfo, trigger)
+
+	for {
+		run.Attempts++
+
+		placement, result, backupsInfo, err := ij.attempt(ctx, run)
+		if err == nil {
+			ij.succeed(run, placement, result, backupsInfo)
+
+			return
+		}
+
+		// Run is failed, when failure is not retryable or attempts are over
+		delay, retry := ij.Retry.Next(run.Attempts, failureReason(result, err))
+		if !retry {
+			ij.fail(run, placement, result, err)
+
+			return
+		}
 
+		klog.Warnf("[NotifierJob] %s: Attempt %d/%d is failed: %s, retry in %s",
+			ij.Target, run.Attempts, ij.Retry.MaxAttempts, failureMessage(result, err), delay)
+
+		if !waitRetry(ctx, delay) {
+			ij.fail(run, placement, nil, fmt.Errorf("%w: retry is cancelled", ctx.Err()))
+
+			return
+		}
+	}
+}
+
+// Private method for run one attempt: select pod, execute command with timeout and parse its output
+// Placement is nil, when pod is not selected
+func (ij *InfoJob) attempt(ctx context.Context, run *Run) (*kube.Placement, *kube.ExecResult, []*BackupInfo, error) {
 	var stdout, stderr bytes.Buffer
 
+	// Command is cancelled after timeout, on shutdown or by replacing run
+	ctx, cancel := context.WithTimeout(ctx, ij.Timeout)
+	defer cancel()
+
+	// Select pod by readiness and role policy
+	placement, err := ij.KubeJob.Prepare(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ij.Events.Record(placement, v1.EventTypeNormal, "InfoStarted",
+		fmt.Sprintf("Backups info is started, attempt %d: %s", run.Attempts, ij.Exec))
+
 	// Execute on container EXEC_BACKUP cmd and return backups info
-	if err := ij.KubeJob.Exec(ij.Exec, nil, &stdout, &stderr); err != nil {
-		klog.Errorf("[NotifierJob] %s", err.Error())
-		klog.Error("[NotifierJob] Exit Job!")
+	result, err := ij.KubeJob.ExecIn(ctx, placement, ij.Exec, nil, &stdout, &stderr)
+	if err != nil {
+		if stderr.Len() > 0 {
+			klog.Errorf("[NotifierJob] %s: stderr: %s", ij.Target, stderr.String())
+		}
 
-		return
+		return placement, result, nil, err
 	}
 	if stderr.Len() > 0 {
-		klog.Errorf("[NotifierJob] %s", stderr.String())
-		klog.Error("[NotifierJob] Exit Job!")
+		klog.Errorf("[NotifierJob] %s: stderr in pod %s: %s", ij.Target, result.Pod, stderr.String())
 
-		return
+		return placement, result, nil, fmt.Errorf("%w: command wrote to stderr", errInvalidOutput)
 	}
 
 	// Parse backups info json to array of objects
 	backupsInfo, err := parseBackupsInfoJson(stdout.String())
 	if err != nil {
-		klog.Errorf("[NotifierJob] parse json: %s", err.Error())
-		klog.Error("[NotifierJob] Exit Job!")
+		return placement, result, nil, fmt.Errorf("%w: parse json: %s", errInvalidOutput, err.Error())
+	}
 
-		return
+	return placement, result, backupsInfo, nil
+}
+
+// Private method for get backups info out of runs: without events, notifications and history
+// Backups info of target is updated, so next requests use it
+func (ij *InfoJob) fetchBackups(ctx context.Context) ([]*BackupInfo, error) {
+	var stdout, stderr bytes.Buffer
+
+	ctx, cancel := context.WithTimeout(ctx, ij.Timeout)
+	defer cancel()
+
+	placement, err := ij.KubeJob.Prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ij.KubeJob.ExecIn(ctx, placement, ij.Exec, nil, &stdout, &stderr); err != nil {
+		return nil, err
+	}
+	if stderr.Len() > 0 {
+		klog.Errorf("[NotifierJob] %s: stderr in pod %s: %s", ij.Target, placement.Pod, stderr.String())
+
+		return nil, fmt.Errorf("%w: command wrote to stderr", errInvalidOutput)
+	}
+
+	backupsInfo, err := parseBackupsInfoJson(stdout.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse json: %s", errInvalidOutput, err.Error())
+	}
+	ij.BackupsInfo.Update(ij.Target, backupsInfo, time.Now())
+
+	return backupsInfo, nil
+}
+
+// Private method for report succeeded info command, notify and save backups info
+func (ij *InfoJob) succeed(run *Run, placement *kube.Placement, result *kube.ExecResult, backupsInfo []*BackupInfo) {
+	ij.Events.Record(placement, v1.EventTypeNormal, "InfoSucceeded",
+		fmt.Sprintf("Backups info is finished in %s", result.Duration().Round(time.Second)))
+
+	run.BackupName = latestBackupName(backupsInfo)
+	run.succeed(result, fmt.Sprintf("%d backups", len(backupsInfo)))
+	observeRun(ij.Observers, run)
+
+	ij.BackupsInfo.Update(ij.Target, backupsInfo, run.FinishedAt)
+
+	// Freshness of backups is checked on each parsed backups info
+	if ij.SLA.Enabled() {
+		ij.checkSLA(placement, CheckSLA(ij.SLA, backupsInfo, time.Now()), nil, time.Time{})
 	}
 
 	// If TG_INFO_NOTIFICATION_ENABLED is true
 	if ij.Notification.Enabled {
-		klog.Info("[NotifierJob] Send telegram notifications!")
+		klog.Infof("[NotifierJob] %s: Send telegram notifications!", ij.Target)
 		// Send tg notifications
-		ij.sendNotifications(backupsInfo)
+		ij.sendNotifications(run, backupsInfo)
 	}
 
-	// Save backupsInfo log file to storage
-	err = ij.saveBackupsInfoFile(backupsInfo)
-	if err != nil {
-		klog.Errorf("[NotifierJob] Error on upload file: %s", err.Error())
+	// Save backupsInfo log file to storage, storage is nil when save logs is disabled
+	if ij.Storage != nil {
+		// Upload is cancelled after timeout or on shutdown
+		ctx, cancel := context.WithTimeout(ij.ctx, ij.Timeout)
+		defer cancel()
+
+		err := ij.saveBackupsInfoFile(ctx, backupsInfo)
+		if err != nil {
+			klog.Errorf("[NotifierJob] %s: Error on upload file: %s", ij.Target, err.Error())
+		}
 	}
 
-	klog.Info("[NotifierJob] End processing job!")
+	klog.Infof("[NotifierJob] %s: End processing job!", ij.Target)
+}
+
+// Private method for log, record event and report failed info command
+// Placement and result are nil, when command was not started
+func (ij *InfoJob) fail(run *Run, placement *kube.Placement, result *kube.ExecResult, err error) {
+	run.fail(result, err)
+
+	klog.Errorf("[NotifierJob] %s: %s", ij.Target, run.Message)
+
+	recordFailureEvent(ij.Events, placement, ij.Target, "Info", run.Reason, run.Message)
+
+	observeRun(ij.Observers, run)
+
+	// Backups become stale, while info command keeps failing, so SLA is checked by last received backups info
+	ij.checkStaleSLA(run, placement)
+
+	klog.Errorf("[NotifierJob] %s: Exit Job!", ij.Target)
+}
+
+// Private method for notify skipped run
+func (ij *InfoJob) notifySkipped() {
+	if ij.Notification.Enabled && ij.Overlap.NotifySkipped {
+		klog.Infof("[NotifierJob] %s: Send skipped info telegram notifications", ij.Target)
+
+		msg := fmt.Sprintf("<b>%s</b>: backups info skipped", strings.ToUpper(ij.Target))
+		msg += "\n\nReason: <b>previous run is still running</b>"
+		sendTelegram(ij.TelegramBotApi, "[NotifierJob]", ij.Notification.ChatIds, msg, true)
+	}
 }
 
 // Private method for send telegram notifications
-func (ij *InfoJob) sendNotifications(bi []*BackupInfo) {
-	var msg string
+func (ij *InfoJob) sendNotifications(run *Run, bi []*BackupInfo) {
+	if len(getOnlyFullBackups(bi)) < 1 {
+		klog.Warnf("[NotifierJob] %s: Backups not found!", ij.Target)
+		klog.Infof("[NotifierJob] %s: Send notifications of backups not found!", ij.Target)
+	}
+
+	msg := MakeTargetBackupsInfoMessage(ij.Target, bi)
+	msg += triggerMessage(run.Trigger)
+
+	sendTelegram(ij.TelegramBotApi, "[NotifierJob]", ij.Notification.ChatIds, msg, true)
+}
+
+// Private method for report checks of SLA, only changes of violations are logged, recorded and notified
+// Failed is failed info run, when checks are made by last received backups info of receivedAt,
+// receivedAt is zero, when backups info was not received since start
+func (ij *InfoJob) checkSLA(placement *kube.Placement, checks []*SLACheck, failed *Run, receivedAt time.Time) {
+	violated, recovered := ij.SLAState.Update(checks)
+
+	// Events out of pod of target, for example on failed info run, are recorded on pod of service
+	eventPrefix := ""
+	if placement == nil || placement.PodRef == nil {
+		eventPrefix = fmt.Sprintf("Target %s: ", ij.Target)
+	}
+
+	for _, check := range violated {
+		message := slaMessage(check)
+		klog.Errorf("[NotifierJob] %s: SLA is violated: %s", ij.Target, message)
+
+		ij.Events.Record(placement, v1.EventTypeWarning, "SLAViolated", eventPrefix+message)
+
+		if ij.SLANotification.Enabled {
+			// Violation is sent with sound
+			sendTelegram(ij.TelegramBotApi, "[NotifierJob]", ij.SLANotification.ChatIds, ij.slaNotificationMessage("backup SLA violated", check, failed, receivedAt), false)
+		}
+	}
+	for _, check := range recovered {
+		message := slaMessage(check)
+		klog.Infof("[NotifierJob] %s: SLA is recovered: %s", ij.Target, message)
+
+		ij.Events.Record(placement, v1.EventTypeNormal, "SLARecovered", eventPrefix+message)
+
+		if ij.SLANotification.Enabled {
+			sendTelegram(ij.TelegramBotApi, "[NotifierJob]", ij.SLANotification.ChatIds, ij.slaNotificationMessage("backup SLA recovered", check, failed, receivedAt), true)
+		}
+	}
+}
+
+// Private method for check SLA by last received backups info of target, when info run is failed
+// When backups info was not received since start, freshness of backups is unknown and SLA is violated
+func (ij *InfoJob) checkStaleSLA(run *Run, placement *kube.Placement) {
+	if !ij.SLA.Enabled() {
+		return
+	}
+
+	var info *TargetBackupsInfo
+	if ij.BackupsInfo != nil {
+		info = ij.BackupsInfo.Get(ij.Target)
+	}
+	if info == nil {
+		klog.Warnf("[NotifierJob] %s: Backups info is not received since start, freshness of backups is unknown", ij.Target)
+
+		ij.checkSLA(placement, UnknownSLA(ij.SLA), run, time.Time{})
 
+		return
+	}
+
+	klog.Warnf("[NotifierJob] %s: Check SLA by backups info of %s", ij.Target, info.UpdatedAt.In(config.TimeZone).Format("02.01.2006 15:04"))
+
+	ij.checkSLA(placement, CheckSLA(ij.SLA, info.Backups, time.Now()), run, info.UpdatedAt)
+}
+
+// Private method for generate message of violated or recovered SLA, see checkSLA
+func (ij *InfoJob) slaNotificationMessage(result string, check *SLACheck, failed *Run, receivedAt time.Time) string {
+	// Get now date with Russian format
+	date := utils.NowDateTz().Format("02.01.2006 15:04")
+
+	msg := fmt.Sprintf("<b>%s</b>: %s", strings.ToUpper(ij.Target), result)
+	msg += fmt.Sprintf("\n\nSLA: <b>%s</b>", slaKindName(check.Kind))
+	switch {
+	case check.Unknown:
+		msg += "\nBackup: <b>unknown</b>"
+	case check.Backup == nil:
+		msg += "\nBackup: <b>not found</b>"
+	default:
+		msg += fmt.Sprintf("\nBackup: <b>%s</b>", check.Backup.BackupName)
+		msg += fmt.Sprintf("\nBackup date: %s", check.Backup.Time.In(config.TimeZone).Format("02.01.2006 15:04"))
+		msg += fmt.Sprintf("\nAge: <b>%s</b>", check.Age.Round(time.Minute))
+	}
+	msg += fmt.Sprintf("\nMax age: <b>%s</b>", check.MaxAge)
+	// SLA is checked by last received backups info, because info run is failed
+	if failed != nil {
+		if receivedAt.IsZero() {
+			msg += "\nBackups info: <b>not received since start</b>"
+		} else {
+			msg += fmt.Sprintf("\nBackups info: received %s", receivedAt.In(config.TimeZone).Format("02.01.2006 15:04"))
+		}
+		msg += fmt.Sprintf("\nReason: <b>%s</b>", failed.Reason)
+		msg += fmt.Sprintf("\nError: <code>%s</code>", html.EscapeString(failed.Message))
+	}
+	msg += fmt.Sprintf("\nDate: <b>%s</b>\n", date)
+
+	return msg
+}
+
+// Help func for make message of full backups of target, message says that backups is not exists, when they are not found
+func MakeTargetBackupsInfoMessage(target string, bi []*BackupInfo) string {
 	// Get only full backups
 	fullBackupsInfo := getOnlyFullBackups(bi)
 
-	// If not full backups send message for users that backups is not exists
-	// Else send backups info
-	msg = MakeBackupsInfoMessage(fullBackupsInfo)
 	if len(fullBackupsInfo) < 1 {
-		klog.Warn("[NotifierJob] Backups not found!")
-		klog.Info("[NotifierJob] Send notifications of backups not found!")
-
-		msg = "<b>Список бэкапов:</b>"
+		msg := fmt.Sprintf("<b>%s</b>: <b>Список бэкапов:</b>", strings.ToUpper(target))
 		msg += "\n<code>-------------------</code>"
 		msg += "\nБэкапы отсутствуют"
-	}
 
-	// Iterate with config users chat-ids, who get notifications
-	for _, chatId := range ij.Notification.ChatIds {
-		tgmsg := tgbotapi.NewMessage(chatId, msg)
-		tgmsg.ParseMode = "HTMl"
-		tgmsg.DisableNotification = true
-
-		go func(gij *InfoJob, gtgmsg tgbotapi.MessageConfig) {
-			_, err := gij.TelegramBotApi.Send(gtgmsg)
-			if err != nil {
-				klog.Errorf("[NotifierJob] Can't send tg notification: %s", err.Error())
-			}
-		}(ij, tgmsg)
+		return msg
 	}
+
+	return fmt.Sprintf("<b>%s</b>: %s", strings.ToUpper(target), MakeBackupsInfoMessage(fullBackupsInfo))
 }
 
 // Help func for make message
@@ -133,7 +411,7 @@ func MakeBackupsInfoMessage(bi []*BackupInfo) string {
 }
 
 // Private function for save backups info to storage
-func (ij *InfoJob) saveBackupsInfoFile(bi []*BackupInfo) error {
+func (ij *InfoJob) saveBackupsInfoFile(ctx context.Context, bi []*BackupInfo) error {
 	fullBackupsInfo := getOnlyFullBackups(bi)
 
 	// If not full backups, return non error
@@ -147,20 +425,8 @@ func (ij *InfoJob) saveBackupsInfoFile(bi []*BackupInfo) error {
 		return err
 	}
 
-	// Get storage from InfoJob object
-	s3 := ij.Storage
-
-	// Init new empty UploadInput object
-	file := storage.UploadInput{
-		Name: fmt.Sprintf("walg_k8s_cron_backup/logs/backups_%s.json",
-			utils.NowDateTz().Format("2006_01_02T15_04_05")),
-		ContentType: "application/octet-stream",
-		Size:        int64(len(backupsInfoJson)),
-		File:        bytes.NewReader(backupsInfoJson),
-	}
-
 	// Upload file to storage
-	path, err := s3.Upload(context.TODO(), file)
+	path, err := saveLogFile(ctx, ij.Storage, ij.Target, "backups", backupsInfoJson)
 	if err != nil {
 		return err
 	}
@@ -170,6 +436,20 @@ func (ij *InfoJob) saveBackupsInfoFile(bi []*BackupInfo) error {
 	return nil
 }
 
+// Help func for upload JSON log of target to storage, name of file is <kind>_<date>.json
+func saveLogFile(ctx context.Context, s3 storage.Provider, target string, kind string, data []byte) (string, error) {
+	// Init new empty UploadInput object
+	file := storage.UploadInput{
+		Name: fmt.Sprintf("walg_k8s_cron_backup/logs/%s/%s_%s.json",
+			target, kind, utils.NowDateTz().Format("2006_01_02T15_04_05")),
+		ContentType: "application/octet-stream",
+		Size:        int64(len(data)),
+		File:        bytes.NewReader(data),
+	}
+
+	return s3.Upload(ctx, file)
+}
+
 // Get only full wal-g backups
 // base_00000005000034600000006B -> true
 // base_00000005000034600000006B_D_00000005000033A50000006C -> false
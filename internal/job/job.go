@@ -1,16 +1,70 @@
 package job
 
 import (
+	"context"
+
+	"github.com/google/uuid"
 	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
 	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
 	"github.com/suchimauz/walg-k8s-cron-backup/pkg/storage"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	cr "github.com/robfig/cron/v3"
 )
 
-// Help func for insert need jobs to cron scheduler
-func InsertJobs(cron *cr.Cron, cfg *config.Config, kj *kube.KubeJob, botapi *tgbotapi.BotAPI, storageProvider storage.Provider) ([]cr.EntryID, error) {
+// Dependencies - services, which are shared by jobs of all targets
+type Dependencies struct {
+	Client         *kubernetes.Clientset
+	KubeConfig     *rest.Config
+	TelegramBotApi *tgbotapi.BotAPI
+	// Nil when save logs is disabled
+	Storage storage.Provider
+	// Nil when events are disabled
+	Events *kube.EventRecorder
+	// Nil when pod cache is disabled
+	Pods *kube.PodCache
+	// Receivers of finished runs
+	Observers []RunObserver
+	// Reports cron is scheduling jobs, queued runs are dropped, when it is false
+	// Nil means always scheduling
+	Scheduling func() bool
+	// Context of new runs, it is cancelled on loss of leadership
+	// Nil means context of jobs, which is cancelled on shutdown
+	RunContext func() context.Context
+	// Finished runs for catch-up of missed schedules, nil disables catch-up
+	History RunHistory
+	// Filled by info jobs for SLA, bot commands and API, nil disables check of SLA on failed info runs
+	BackupsInfo *LatestBackupsInfo
+}
+
+// targetJob - job of target in cron entry, which may be run out of schedule
+type targetJob interface {
+	cr.Job
+	// Kind of job in runs
+	kind() string
+	// Previous run of job is still running
+	running() bool
+	// Run job by trigger with id, run is skipped, queued or replaces running run by overlap policy
+	// Error is returned, when run is skipped or queued run is cancelled
+	runTriggered(id uuid.UUID, trigger string) error
+}
+
+// Guards of jobs of one target
+type targetGuards struct {
+	backup    *RunGuard
+	info      *RunGuard
+	retention *RunGuard
+	verify    *RunGuard
+	walVerify *RunGuard
+	// State of backups SLA, it is kept with guards, so replaced target does not alert violation again
+	sla *SLAState
+}
+
+// Private func for insert jobs of one target to cron scheduler
+// On error already inserted entries are returned too, so they may be removed
+func insertTargetJobs(ctx context.Context, cron *cr.Cron, cfg *config.Config, target *config.TargetConfig, kj *kube.KubeJob, executor kube.Executor, guards *targetGuards, deps *Dependencies) ([]cr.EntryID, error) {
 	// Init variables
 	var entryIds []cr.EntryID
 	var eId cr.EntryID
@@ -18,26 +72,89 @@ func InsertJobs(cron *cr.Cron, cfg *config.Config, kj *kube.KubeJob, botapi *tgb
 
 	// InfoJob - object for manage job, which send notifications of backups and etc
 	// Required when save logs is enabled or telegram notification is enabled
-	if cfg.CronInfoRequired() {
-		ij := NewInfoJob(&cfg.Telegram, kj, botapi, storageProvider, cfg.Exec.Info)
+	if target.CronInfoRequired(cfg.SaveLogs) {
+		ij := NewInfoJob(ctx, target, kj, guards.info, guards.sla, deps)
 
 		// Add to exists cron object new InfoJob object
-		eId, err = cron.AddJob(cfg.Cron.Info, ij)
+		eId, err = cron.AddJob(target.Cron.Info, ij)
 		if err != nil {
-			return nil, err
+			return entryIds, err
 		}
 		entryIds = append(entryIds, eId)
 	}
 
 	// BackupJob - object for manage job, which send command for backuping postgres db and etc.
-	bj := NewBackupJob(&cfg.Telegram, kj, botapi, cfg.Exec.Backup)
+	bj := NewBackupJob(ctx, target, executor, guards.backup, deps)
 	// Add to exists cron object new BackupJob object
-	eId, err = cron.AddJob(cfg.Cron.Backup, bj)
+	eId, err = cron.AddJob(target.Cron.Backup, bj)
 	if err != nil {
-		return nil, err
+		return entryIds, err
 	}
 	entryIds = append(entryIds, eId)
 
-	// Return array of new cron job ids
+	// RetentionJob - object for manage job, which deletes full backups by GFS policy
+	// Scheduled only when cron retention is set
+	if target.Cron.Retention != "" {
+		rj := NewRetentionJob(ctx, target, kj, guards.retention, deps)
+
+		// Add to exists cron object new RetentionJob object
+		eId, err = cron.AddJob(target.Cron.Retention, rj)
+		if err != nil {
+			return entryIds, err
+		}
+		entryIds = append(entryIds, eId)
+	}
+
+	// WalVerifyJob - object for manage job, which checks WAL archive
+	// Scheduled only when cron wal verify is set
+	if target.Cron.WalVerify != "" {
+		wj := NewWalVerifyJob(ctx, target, kj, guards.walVerify, deps)
+
+		// Add to exists cron object new WalVerifyJob object
+		eId, err = cron.AddJob(target.Cron.WalVerify, wj)
+		if err != nil {
+			return entryIds, err
+		}
+		entryIds = append(entryIds, eId)
+	}
+
+	// VerifyJob - object for manage job, which restores latest full backup in scratch Job
+	// Scheduled only when cron verify is set
+	if target.Cron.Verify != "" {
+		vj, err := NewVerifyJob(ctx, target, kj, guards.verify, deps)
+		if err != nil {
+			return entryIds, err
+		}
+
+		// Add to exists cron object new VerifyJob object
+		eId, err = cron.AddJob(target.Cron.Verify, vj)
+		if err != nil {
+			return entryIds, err
+		}
+		entryIds = append(entryIds, eId)
+	}
+
 	return entryIds, nil
 }
+
+// Private func for create executor of backup command by target executor mode
+func newBackupExecutor(target *config.TargetConfig, client *kubernetes.Clientset, kj *kube.KubeJob) (kube.Executor, error) {
+	if target.Executor.Mode != config.ExecutorModeJob {
+		return kj, nil
+	}
+
+	template, err := kube.LoadJobTemplate(target.Executor.JobTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := kube.NewJobRunner(client, target.Pod.Namespace, template, target.Executor.JobContainer)
+	if err != nil {
+		return nil, err
+	}
+	// Database pods are used for references of events
+	runner.PodSelector = target.PodSelector()
+	runner.Pods = kj.Pods
+
+	return runner, nil
+}
@@ -30,6 +30,8 @@ type BackupInfo struct {
 	Time             time.Time `json:"time"`
 	UncompressedSize int64     `json:"uncompressed_size"`
 	CompressedSize   int64     `json:"compressed_size"`
+	// Permanent backups are not deleted by wal-g delete, filled by backup-list --detail
+	IsPermanent bool `json:"is_permanent"`
 }
 
 // Func for parse json to struct
@@ -44,3 +46,25 @@ func parseBackupsInfoJson(backupsJson string) ([]*BackupInfo, error) {
 
 	return backupsInfo, nil
 }
+
+// Get name of latest backup of any kind, empty when there are no backups
+func latestBackupName(bi []*BackupInfo) string {
+	latest := latestBackup(bi)
+	if latest == nil {
+		return ""
+	}
+
+	return latest.BackupName
+}
+
+// Get latest backup by time, nil when there are no backups
+func latestBackup(bi []*BackupInfo) *BackupInfo {
+	var latest *BackupInfo
+	for _, backupInfo := range bi {
+		if latest == nil || backupInfo.Time.After(latest.Time) {
+			latest = backupInfo
+		}
+	}
+
+	return latest
+}
@@ -0,0 +1,212 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
+
+	cr "github.com/robfig/cron/v3"
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// Sources of targets, targets of each source are synced independently
+const (
+	SourceConfig     = "config"     // Environment variables and config file
+	SourceDiscovery  = "discovery"  // Annotations of StatefulSets and pods
+	SourceController = "controller" // BackupSchedule resources
+)
+
+// Registry - cron entries of targets by names, it adds, replaces and removes jobs,
+// when set of targets of source is changed
+type Registry struct {
+	cron *cr.Cron
+	cfg  *config.Config
+	deps *Dependencies
+	// Parent context of all runs, cancelled on shutdown
+	ctx context.Context
+
+	mu      sync.Mutex
+	targets map[string]*registeredTarget
+	// Guards by target names, they are kept after remove of target,
+	// so added again target does not overlap with its still running jobs
+	guards map[string]*targetGuards
+	// Missed runs of targets are caught up after first start of scheduling
+	caughtUp bool
+	// Runs out of cron: catch-up and manual runs, cron does not wait them on stop
+	runs sync.WaitGroup
+}
+
+// Target with its cron entries
+type registeredTarget struct {
+	source string
+	// JSON of target config, for detect changes
+	spec     string
+	target   *config.TargetConfig
+	entryIds []cr.EntryID
+}
+
+// Constructor
+func NewRegistry(ctx context.Context, cron *cr.Cron, cfg *config.Config, deps *Dependencies) *Registry {
+	return &Registry{
+		cron:    cron,
+		cfg:     cfg,
+		deps:    deps,
+		ctx:     ctx,
+		targets: make(map[string]*registeredTarget),
+		guards:  make(map[string]*targetGuards),
+	}
+}
+
+// Sync jobs of source with targets: new targets are inserted, changed are replaced, missing are removed
+// Failed targets are skipped, their errors are returned together, changed target keeps old jobs on error
+func (r *Registry) Sync(source string, targets []config.TargetConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []string
+	seen := make(map[string]bool, len(targets))
+
+	for i := range targets {
+		// Jobs keep pointer to target, so registry owns copy of it
+		target := targets[i]
+
+		if seen[target.Name] {
+			errs = append(errs, fmt.Sprintf("Target name %q is duplicated", target.Name))
+			continue
+		}
+		seen[target.Name] = true
+
+		spec, err := json.Marshal(target)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Target %s: %s", target.Name, err.Error()))
+			continue
+		}
+
+		current, ok := r.targets[target.Name]
+		if ok && current.source != source {
+			errs = append(errs, fmt.Sprintf("Target %s: name is already used by target of %s", target.Name, current.source))
+			continue
+		}
+		if ok && current.spec == string(spec) {
+			continue
+		}
+
+		entryIds, err := r.insert(&target)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Target %s: %s", target.Name, err.Error()))
+			continue
+		}
+		if ok {
+			r.removeEntries(current.entryIds)
+			r.deps.Pods.Release(current.target.PodSelector())
+			klog.Infof("[Registry] %s: Target is changed, jobs are replaced! JobIds %v", target.Name, entryIds)
+		} else {
+			klog.Infof("[Registry] %s: Target of %s is added! JobIds %v", target.Name, source, entryIds)
+		}
+
+		registered := &registeredTarget{
+			source:   source,
+			spec:     string(spec),
+			target:   &target,
+			entryIds: entryIds,
+		}
+		r.targets[target.Name] = registered
+
+		// Added target, for example resource, which is synced after start, is caught up now
+		if !ok && r.caughtUp && (r.deps.Scheduling == nil || r.deps.Scheduling()) {
+			r.catchUp(registered)
+		}
+	}
+
+	// Targets, which are missing in source now
+	for name, current := range r.targets {
+		if current.source != source || seen[name] {
+			continue
+		}
+
+		r.removeEntries(current.entryIds)
+		r.deps.Pods.Release(current.target.PodSelector())
+		delete(r.targets, name)
+
+		klog.Infof("[Registry] %s: Target of %s is removed, running jobs are not interrupted", name, source)
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Get source of registered target, empty when target is not registered
+func (r *Registry) Source(name string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, ok := r.targets[name]; ok {
+		return current.source
+	}
+
+	return ""
+}
+
+// Private method for insert jobs of target, on error inserted jobs are removed
+func (r *Registry) insert(target *config.TargetConfig) ([]cr.EntryID, error) {
+	// Create new local KubeJob pkg object for target pod
+	kj, err := kube.NewKubeJob(r.deps.Client, r.deps.KubeConfig, target.PodSelector())
+	if err != nil {
+		return nil, err
+	}
+	kj.Pods = r.deps.Pods
+
+	// Executor of backup command: kj or JobRunner
+	executor, err := newBackupExecutor(target, r.deps.Client, kj)
+	if err != nil {
+		return nil, err
+	}
+
+	// Changed target shares guards with its replaced jobs
+	guards, ok := r.guards[target.Name]
+	if !ok {
+		guards = &targetGuards{
+			backup:    NewRunGuard(),
+			info:      NewRunGuard(),
+			retention: NewRunGuard(),
+			verify:    NewRunGuard(),
+			walVerify: NewRunGuard(),
+			sla:       NewSLAState(),
+		}
+		r.guards[target.Name] = guards
+	}
+
+	entryIds, err := insertTargetJobs(r.ctx, r.cron, r.cfg, target, kj, executor, guards, r.deps)
+	if err != nil {
+		r.removeEntries(entryIds)
+
+		return nil, err
+	}
+
+	// Informer of pods works, while target is registered
+	r.deps.Pods.Acquire(target.PodSelector())
+
+	// Targets of config are validated with history store, targets of resources are not
+	if target.CatchUp.Enabled() && r.cfg.History.Store == config.HistoryStoreMemory {
+		klog.Warnf("[Registry] %s: Catch-up is enabled, but history store is %s, runs missed before restart are not caught up",
+			target.Name, config.HistoryStoreMemory)
+	}
+
+	return entryIds, nil
+}
+
+// Private method for remove jobs from cron, running jobs are finished
+func (r *Registry) removeEntries(entryIds []cr.EntryID) {
+	for _, entryId := range entryIds {
+		r.cron.Remove(entryId)
+	}
+}
@@ -0,0 +1,106 @@
+package job
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+)
+
+// Reasons of kept backups
+const (
+	RetentionDaily     = "daily"
+	RetentionWeekly    = "weekly"
+	RetentionMonthly   = "monthly"
+	RetentionPermanent = "permanent"
+)
+
+// GFSPolicy - newest full backups of last days, weeks and months are kept, other full backups are deleted
+type GFSPolicy struct {
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	// Permanent backups are counted by policy and deleted, when they are not kept
+	// Else they are always kept
+	ManagePermanent bool
+}
+
+// Constructor
+func NewGFSPolicy(rtcfg *config.RetentionConfig) *GFSPolicy {
+	return &GFSPolicy{
+		KeepDaily:       rtcfg.KeepDaily,
+		KeepWeekly:      rtcfg.KeepWeekly,
+		KeepMonthly:     rtcfg.KeepMonthly,
+		ManagePermanent: rtcfg.MarkPermanent,
+	}
+}
+
+// RetainedBackup - kept backup with levels of policy, which keep it
+type RetainedBackup struct {
+	Backup  *BackupInfo
+	Reasons []string
+}
+
+// RetentionPlan - result of policy, backups are sorted from newest to oldest
+type RetentionPlan struct {
+	Keep   []*RetainedBackup
+	Delete []*BackupInfo
+}
+
+// Evaluate policy against full backups, incremental backups are deleted with their full backups
+// Days, weeks and months are calculated in loc, weeks are ISO weeks
+func (gp *GFSPolicy) Plan(backups []*BackupInfo, loc *time.Location) *RetentionPlan {
+	full := getOnlyFullBackups(backups)
+	sort.SliceStable(full, func(i, j int) bool {
+		return full[i].Time.After(full[j].Time)
+	})
+
+	reasons := make(map[*BackupInfo][]string, len(full))
+	// Newest backup of each of last keep periods is kept
+	keepPeriods := func(reason string, keep int, period func(t time.Time) string) {
+		seen := make(map[string]bool, keep)
+		for _, backup := range full {
+			if backup.IsPermanent && !gp.ManagePermanent {
+				continue
+			}
+
+			key := period(backup.Time.In(loc))
+			if seen[key] {
+				continue
+			}
+			if len(seen) == keep {
+				return
+			}
+			seen[key] = true
+			reasons[backup] = append(reasons[backup], reason)
+		}
+	}
+
+	keepPeriods(RetentionDaily, gp.KeepDaily, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+	keepPeriods(RetentionWeekly, gp.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+
+		return fmt.Sprintf("%d-%02d", year, week)
+	})
+	keepPeriods(RetentionMonthly, gp.KeepMonthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	plan := &RetentionPlan{}
+	for _, backup := range full {
+		if backup.IsPermanent && !gp.ManagePermanent {
+			reasons[backup] = append(reasons[backup], RetentionPermanent)
+		}
+
+		if len(reasons[backup]) > 0 {
+			plan.Keep = append(plan.Keep, &RetainedBackup{Backup: backup, Reasons: reasons[backup]})
+		} else {
+			plan.Delete = append(plan.Delete, backup)
+		}
+	}
+
+	return plan
+}
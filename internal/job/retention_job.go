@@ -0,0 +1,298 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+)
+
+// RetentionJob - struct for manage job, which deletes full backups by GFS policy
+type RetentionJob struct {
+	Target         string
+	KubeJob        *kube.KubeJob
+	Notification   *config.TelegramNotificationRetentionConfig
+	Policy         *GFSPolicy
+	Retention      *config.RetentionConfig
+	Overlap        *config.OverlapConfig
+	Guard          *RunGuard
+	TelegramBotApi *tgbotapi.BotAPI
+	// Nil when events are disabled
+	Events     *kube.EventRecorder
+	Observers  []RunObserver
+	Scheduling func() bool
+	// Context of new runs, cancelled on loss of leadership, nil means ctx
+	RunContext func() context.Context
+
+	// Parent context of all runs, cancelled on shutdown
+	ctx context.Context
+}
+
+// Result of applied plan, backups are listed in order of commands
+type retentionResult struct {
+	plan    *RetentionPlan
+	marked  []string
+	deleted []string
+}
+
+// Constructor
+func NewRetentionJob(ctx context.Context, target *config.TargetConfig, kj *kube.KubeJob, guard *RunGuard, deps *Dependencies) *RetentionJob {
+	return &RetentionJob{
+		Target:         target.Name,
+		KubeJob:        kj,
+		Notification:   &target.Notification.Retention,
+		Policy:         NewGFSPolicy(&target.Retention),
+		Retention:      &target.Retention,
+		Overlap:        &target.Overlap,
+		Guard:          guard,
+		TelegramBotApi: deps.TelegramBotApi,
+		Events:         deps.Events,
+		Observers:      deps.Observers,
+		Scheduling:     deps.Scheduling,
+		RunContext:     deps.RunContext,
+		ctx:            ctx,
+	}
+}
+
+// Main required method, which implements cron.Job interface
+// Run is skipped, queued or replaces previous run by overlap policy, when previous run is still running
+func (rj *RetentionJob) Run() {
+	rj.runTriggered(uuid.New(), TriggerSchedule)
+}
+
+// Private method for get kind of job in runs
+func (rj *RetentionJob) kind() string {
+	return JobRetention
+}
+
+// Private method for check previous run of job is still running
+func (rj *RetentionJob) running() bool {
+	return rj.Guard.Running()
+}
+
+// Private method for run job by trigger in guard by overlap policy, see runGuarded
+// Error is returned, when run is skipped or queued run is cancelled
+func (rj *RetentionJob) runTriggered(id uuid.UUID, trigger string) error {
+	return runGuarded(rj.ctx, "[RetentionJob]", rj.Target, rj.Guard, rj.Overlap, rj.Scheduling, rj.RunContext, nil, func(ctx context.Context) {
+		rj.run(ctx, id, trigger)
+	})
+}
+
+// Private method for run retention in guard, ctx is cancelled on shutdown or by replacing run
+func (rj *RetentionJob) run(ctx context.Context, id uuid.UUID, trigger string) {
+	klog.Infof("[RetentionJob] %s: Start processing Job!", rj.Target)
+
+	run := newRun(id, rj.Target, JobRetention, trigger)
+	run.Attempts = 1
+
+	// Commands are cancelled after timeout, on shutdown or by replacing run
+	ctx, cancel := context.WithTimeout(ctx, rj.Retention.Timeout.Duration())
+	defer cancel()
+
+	// Select pod by readiness and role policy
+	placement, err := rj.KubeJob.Prepare(ctx)
+	if err != nil {
+		rj.fail(run, nil, nil, nil, err)
+
+		return
+	}
+	run.Pod = placement.Pod
+
+	rj.Events.Record(placement, v1.EventTypeNormal, "RetentionStarted",
+		fmt.Sprintf("Retention %s is started, dry run: %t", run.Id, rj.Retention.DryRun))
+
+	result, res, err := rj.apply(ctx, placement)
+	if err != nil {
+		rj.fail(run, placement, result, res, err)
+
+		return
+	}
+
+	rj.succeed(run, placement, result, res)
+}
+
+// Private method for list backups, evaluate policy and execute mark and delete commands
+// Result is returned on error too, with already executed commands
+func (rj *RetentionJob) apply(ctx context.Context, placement *kube.Placement) (*kube.ExecResult, *retentionResult, error) {
+	var stdout bytes.Buffer
+
+	result, err := rj.KubeJob.ExecIn(ctx, placement, rj.Retention.List, nil, &stdout, os.Stderr)
+	if err != nil {
+		return result, nil, err
+	}
+	backups, err := parseBackupsInfoJson(stdout.String())
+	if err != nil {
+		return result, nil, fmt.Errorf("%w: parse json: %s", errInvalidOutput, err.Error())
+	}
+
+	res := &retentionResult{plan: rj.Policy.Plan(backups, config.TimeZone)}
+	if rj.Retention.DryRun {
+		return result, res, nil
+	}
+
+	// Kept backups are marked before delete, so they are protected from deletes of older backups
+	if rj.Retention.MarkPermanent {
+		for _, kept := range res.plan.Keep {
+			if kept.Backup.IsPermanent {
+				continue
+			}
+
+			result, err = rj.exec(ctx, placement, rj.Retention.Mark, kept.Backup.BackupName)
+			if err != nil {
+				return result, res, err
+			}
+			res.marked = append(res.marked, kept.Backup.BackupName)
+		}
+	}
+
+	// Delete from oldest to newest
+	for i := len(res.plan.Delete) - 1; i >= 0; i-- {
+		backup := res.plan.Delete[i]
+
+		// Permanent backup is not deleted by wal-g, it is in plan only when mark permanent is enabled
+		if backup.IsPermanent {
+			result, err = rj.exec(ctx, placement, rj.Retention.Unmark, backup.BackupName)
+			if err != nil {
+				return result, res, err
+			}
+		}
+
+		result, err = rj.exec(ctx, placement, rj.Retention.Delete, backup.BackupName)
+		if err != nil {
+			return result, res, err
+		}
+		res.deleted = append(res.deleted, backup.BackupName)
+	}
+
+	return result, res, nil
+}
+
+// Private method for execute command with backup name, output is written to os stdout and stderr
+func (rj *RetentionJob) exec(ctx context.Context, placement *kube.Placement, command string, backupName string) (*kube.ExecResult, error) {
+	command = strings.ReplaceAll(command, config.BackupNamePlaceholder, backupName)
+	klog.Infof("[RetentionJob] %s: Execute: %s", rj.Target, command)
+
+	return rj.KubeJob.ExecIn(ctx, placement, command, nil, os.Stdout, os.Stderr)
+}
+
+// Private method for log, record event, report and notify applied retention
+func (rj *RetentionJob) succeed(run *Run, placement *kube.Placement, result *kube.ExecResult, res *retentionResult) {
+	summary := fmt.Sprintf("kept %d, deleted %d full backups", len(res.plan.Keep), len(res.plan.Delete))
+	if rj.Retention.DryRun {
+		summary = fmt.Sprintf("dry run: kept %d, would delete %d full backups", len(res.plan.Keep), len(res.plan.Delete))
+	}
+	klog.Infof("[RetentionJob] %s: %s", rj.Target, summary)
+	for _, backup := range res.plan.Delete {
+		klog.Infof("[RetentionJob] %s: Not kept: %s", rj.Target, backup.BackupName)
+	}
+
+	run.succeed(result, summary)
+	observeRun(rj.Observers, run)
+
+	rj.Events.Record(placement, v1.EventTypeNormal, "RetentionSucceeded",
+		fmt.Sprintf("Retention %s: %s", run.Id, summary))
+
+	if rj.Notification.Enabled {
+		klog.Infof("[RetentionJob] %s: Send retention telegram notifications", run.Id)
+
+		sendTelegram(rj.TelegramBotApi, "[RetentionJob]", rj.Notification.ChatIds, rj.retentionMessage(run, res), true)
+	}
+
+	klog.Infof("[RetentionJob] %s: End processing Job!", rj.Target)
+}
+
+// Private method for log, record event, report and notify failed retention
+// Placement, result and res are nil, when they are not known before failure
+func (rj *RetentionJob) fail(run *Run, placement *kube.Placement, result *kube.ExecResult, res *retentionResult, err error) {
+	run.fail(result, err)
+
+	klog.Errorf("[RetentionJob] %s: %s", rj.Target, run.Message)
+	if res != nil && len(res.deleted) > 0 {
+		klog.Errorf("[RetentionJob] %s: Deleted before failure: %s", rj.Target, strings.Join(res.deleted, ", "))
+	}
+
+	recordFailureEvent(rj.Events, placement, rj.Target, "Retention", run.Reason,
+		fmt.Sprintf("Retention %s: %s", run.Id, run.Message))
+
+	observeRun(rj.Observers, run)
+
+	if rj.Notification.Enabled {
+		klog.Infof("[RetentionJob] %s: Send failed retention telegram notifications", run.Id)
+
+		msg := rj.retentionMessage(run, res)
+		msg += fmt.Sprintf("\nError: <code>%s</code>\n", html.EscapeString(run.Message))
+		sendTelegram(rj.TelegramBotApi, "[RetentionJob]", rj.Notification.ChatIds, msg, true)
+	}
+
+	klog.Errorf("[RetentionJob] %s: Exit Job!", rj.Target)
+}
+
+// Private method for generate retention message with kept and deleted backups
+// Res is nil, when backups are not listed
+func (rj *RetentionJob) retentionMessage(run *Run, res *retentionResult) string {
+	// Get now date with Russian format
+	date := utils.NowDateTz().Format("02.01.2006 15:04")
+
+	title := "retention"
+	if rj.Retention.DryRun {
+		title = "retention (dry run)"
+	}
+	if run.Status == RunFailed {
+		title += " failed"
+	}
+
+	msg := fmt.Sprintf("<b>%s</b>: %s", strings.ToUpper(rj.Target), title)
+	msg += fmt.Sprintf("\n\nUuid: <b>%s</b>", run.Id.String())
+	msg += triggerMessage(run.Trigger)
+	msg += fmt.Sprintf("\nPolicy: daily <b>%d</b>, weekly <b>%d</b>, monthly <b>%d</b>",
+		rj.Policy.KeepDaily, rj.Policy.KeepWeekly, rj.Policy.KeepMonthly)
+	msg += fmt.Sprintf("\nDate: <b>%s</b>\n", date)
+
+	if res == nil {
+		return msg
+	}
+
+	msg += fmt.Sprintf("\n<b>Kept: %d</b>", len(res.plan.Keep))
+	for _, kept := range res.plan.Keep {
+		msg += fmt.Sprintf("\n%s (%s) - %s", kept.Backup.BackupName,
+			kept.Backup.Time.In(config.TimeZone).Format("02.01.2006 15:04"), strings.Join(kept.Reasons, ", "))
+	}
+
+	if len(res.marked) > 0 {
+		msg += fmt.Sprintf("\n\n<b>Marked permanent: %d</b>", len(res.marked))
+		for _, name := range res.marked {
+			msg += "\n" + name
+		}
+	}
+
+	deleted := make([]string, 0, len(res.plan.Delete))
+	for _, backup := range res.plan.Delete {
+		deleted = append(deleted, backup.BackupName)
+	}
+	if !rj.Retention.DryRun && run.Status == RunFailed {
+		deleted = res.deleted
+	}
+
+	label := "Deleted"
+	if rj.Retention.DryRun {
+		label = "To delete"
+	}
+	msg += fmt.Sprintf("\n\n<b>%s: %d</b>", label, len(deleted))
+	for _, name := range deleted {
+		msg += "\n" + name
+	}
+	msg += "\n"
+
+	return msg
+}
@@ -0,0 +1,119 @@
+package job
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGFSPolicyPlan(t *testing.T) {
+	backup := func(name string, date string, permanent bool) *BackupInfo {
+		backupTime, err := time.Parse("2006-01-02 15:04", date)
+		if err != nil {
+			t.Fatalf("time.Parse() error = %v", err)
+		}
+
+		return &BackupInfo{BackupName: name, Time: backupTime, IsPermanent: permanent}
+	}
+
+	// ISO weeks: 2023-12-31 is in week 52 of 2023, 2024-01-10 and 2024-01-14 are in week 2,
+	// 2024-01-30 - 2024-02-01 are in week 5
+	backups := []*BackupInfo{
+		backup("base_01", "2023-12-31 21:00", false),
+		backup("base_02", "2024-01-10 21:00", false),
+		backup("base_03", "2024-01-14 21:00", false),
+		backup("base_04", "2024-01-30 09:00", false),
+		backup("base_04_D_03", "2024-01-30 15:00", false),
+		backup("base_05", "2024-01-30 21:00", false),
+		backup("base_06", "2024-01-31 21:00", false),
+		backup("base_07", "2024-02-01 21:00", false),
+	}
+
+	tests := []struct {
+		name       string
+		policy     *GFSPolicy
+		backups    []*BackupInfo
+		wantKeep   map[string][]string
+		wantDelete []string
+	}{
+		{
+			name:    "test newest backup of each day is kept",
+			policy:  &GFSPolicy{KeepDaily: 3},
+			backups: backups,
+			wantKeep: map[string][]string{
+				"base_07": {RetentionDaily},
+				"base_06": {RetentionDaily},
+				"base_05": {RetentionDaily},
+			},
+			wantDelete: []string{"base_04", "base_03", "base_02", "base_01"},
+		},
+		{
+			name:    "test daily, weekly and monthly levels",
+			policy:  &GFSPolicy{KeepDaily: 1, KeepWeekly: 3, KeepMonthly: 3},
+			backups: backups,
+			wantKeep: map[string][]string{
+				"base_07": {RetentionDaily, RetentionWeekly, RetentionMonthly},
+				"base_03": {RetentionWeekly},
+				"base_06": {RetentionMonthly},
+				"base_01": {RetentionWeekly, RetentionMonthly},
+			},
+			wantDelete: []string{"base_05", "base_04", "base_02"},
+		},
+		{
+			name:   "test permanent backups are kept and not counted",
+			policy: &GFSPolicy{KeepDaily: 1},
+			backups: []*BackupInfo{
+				backup("base_01", "2024-01-01 21:00", true),
+				backup("base_02", "2024-01-02 21:00", false),
+				backup("base_03", "2024-01-03 21:00", true),
+			},
+			wantKeep: map[string][]string{
+				"base_03": {RetentionPermanent},
+				"base_02": {RetentionDaily},
+				"base_01": {RetentionPermanent},
+			},
+			wantDelete: nil,
+		},
+		{
+			name:   "test permanent backups are managed",
+			policy: &GFSPolicy{KeepDaily: 1, ManagePermanent: true},
+			backups: []*BackupInfo{
+				backup("base_01", "2024-01-01 21:00", true),
+				backup("base_02", "2024-01-02 21:00", false),
+			},
+			wantKeep: map[string][]string{
+				"base_02": {RetentionDaily},
+			},
+			wantDelete: []string{"base_01"},
+		},
+		{
+			name:       "test without backups",
+			policy:     &GFSPolicy{KeepDaily: 7},
+			backups:    nil,
+			wantKeep:   map[string][]string{},
+			wantDelete: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := tt.policy.Plan(tt.backups, time.UTC)
+
+			gotKeep := make(map[string][]string, len(plan.Keep))
+			for _, kept := range plan.Keep {
+				gotKeep[kept.Backup.BackupName] = kept.Reasons
+			}
+			var gotDelete []string
+			for _, backup := range plan.Delete {
+				gotDelete = append(gotDelete, backup.BackupName)
+			}
+
+			if !reflect.DeepEqual(gotKeep, tt.wantKeep) {
+				t.Errorf("Plan() keep \ngot = %v\nwant %v", gotKeep, tt.wantKeep)
+			}
+			if !reflect.DeepEqual(gotDelete, tt.wantDelete) {
+				t.Errorf("Plan() delete \ngot = %v\nwant %v", gotDelete, tt.wantDelete)
+			}
+		})
+	}
+}
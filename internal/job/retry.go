@@ -0,0 +1,70 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+)
+
+// RetryPolicy - attempts of run and exponential backoff between them
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Failure reasons, which are retried
+	RetryOn []string
+}
+
+// Constructor
+func NewRetryPolicy(rcfg *config.RetryConfig) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    rcfg.MaxAttempts,
+		InitialBackoff: rcfg.InitialBackoff.Duration(),
+		MaxBackoff:     rcfg.MaxBackoff.Duration(),
+		RetryOn:        rcfg.RetryOn,
+	}
+}
+
+// Get delay before next attempt after failed attempt with reason, false when run must not be retried
+// Attempts are numbered from 1
+func (rp *RetryPolicy) Next(attempt int, reason string) (time.Duration, bool) {
+	if attempt >= rp.MaxAttempts || !containsReason(rp.RetryOn, reason) {
+		return 0, false
+	}
+
+	// Backoff is doubled after each attempt up to max
+	delay := rp.InitialBackoff
+	for i := 1; i < attempt && delay < rp.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > rp.MaxBackoff {
+		delay = rp.MaxBackoff
+	}
+
+	return delay, true
+}
+
+// Private func for wait delay before next attempt, false when ctx is done before
+func waitRetry(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Private func for check reason is in list
+func containsReason(reasons []string, reason string) bool {
+	for _, item := range reasons {
+		if item == reason {
+			return true
+		}
+	}
+
+	return false
+}
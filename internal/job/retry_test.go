@@ -0,0 +1,66 @@
+package job
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyNext(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     3 * time.Minute,
+		RetryOn:        []string{FailurePodNotFound, FailureStream},
+	}
+
+	tests := []struct {
+		name      string
+		attempt   int
+		reason    string
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{
+			name:      "test first failed attempt uses initial backoff",
+			attempt:   1,
+			reason:    FailurePodNotFound,
+			wantDelay: time.Minute,
+			wantRetry: true,
+		},
+		{
+			name:      "test backoff is doubled",
+			attempt:   2,
+			reason:    FailureStream,
+			wantDelay: 2 * time.Minute,
+			wantRetry: true,
+		},
+		{
+			name:      "test backoff is limited by max backoff",
+			attempt:   4,
+			reason:    FailureStream,
+			wantDelay: 3 * time.Minute,
+			wantRetry: true,
+		},
+		{
+			name:      "test not retryable reason",
+			attempt:   1,
+			reason:    FailureExitCode,
+			wantRetry: false,
+		},
+		{
+			name:      "test attempts are over",
+			attempt:   5,
+			reason:    FailureStream,
+			wantRetry: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := policy.Next(tt.attempt, tt.reason)
+			if retry != tt.wantRetry || delay != tt.wantDelay {
+				t.Errorf("Next() = %s, %t, want %s, %t", delay, retry, tt.wantDelay, tt.wantRetry)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package job
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
+)
+
+// Kinds of jobs in runs
+const (
+	JobBackup    = "backup"
+	JobInfo      = "info"
+	JobRetention = "retention"
+	JobVerify    = "verify"
+	JobWalVerify = "wal_verify"
+)
+
+// Triggers of runs
+const (
+	TriggerSchedule = "schedule" // Run by cron
+	TriggerCatchUp  = "catchup"  // Run of missed schedule after start of scheduling
+	TriggerManual   = "manual"   // Run by request to HTTP API
+)
+
+// Statuses of finished runs
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// Run - one execution of job of target
+type Run struct {
+	Id         uuid.UUID `json:"id"`
+	Target     string    `json:"target"`
+	Job        string    `json:"job"`
+	Trigger    string    `json:"trigger"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Status     string    `json:"status"`
+	// Failure reason, empty when run is succeeded
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message"`
+	ExitCode int    `json:"exit_code"`
+	// Attempts of run, more than one when failed attempts are retried
+	Attempts int `json:"attempts"`
+	// Pod or Job name of last attempt, empty when pod is not selected
+	Pod string `json:"pod,omitempty"`
+	// Tail of command output of last attempt, stderr is preferred
+	Output string `json:"output,omitempty"`
+	// Name of latest backup, filled by info runs
+	BackupName string `json:"backup_name,omitempty"`
+}
+
+// RunObserver - receives finished runs of jobs, for example for write status of BackupSchedule
+// Method is called in goroutine of job, so it must not block for long
+type RunObserver interface {
+	ObserveRun(run *Run)
+}
+
+// RunHistory - finished runs of jobs, which are kept after restart
+type RunHistory interface {
+	// Last succeeded run of job of target, nil when it is not found
+	LastSucceeded(target string, job string) *Run
+}
+
+// Private func for make run, which is started now
+func newRun(id uuid.UUID, target string, job string, trigger string) *Run {
+	return &Run{
+		Id:        id,
+		Target:    target,
+		Job:       job,
+		Trigger:   trigger,
+		StartedAt: time.Now(),
+		ExitCode:  kube.UnknownExitCode,
+	}
+}
+
+// Private method for finish run as succeeded
+func (run *Run) succeed(result *kube.ExecResult, message string) {
+	run.FinishedAt = time.Now()
+	run.Status = RunSucceeded
+	run.Message = message
+	if result != nil {
+		run.ExitCode = result.ExitCode
+	}
+}
+
+// Private method for finish run as failed
+func (run *Run) fail(result *kube.ExecResult, err error) {
+	run.FinishedAt = time.Now()
+	run.Status = RunFailed
+	run.Reason = failureReason(result, err)
+	run.Message = failureMessage(result, err)
+	if result != nil {
+		run.ExitCode = result.ExitCode
+	}
+}
+
+// Private func for pass finished run to all observers
+func observeRun(observers []RunObserver, run *Run) {
+	for _, observer := range observers {
+		observer.ObserveRun(run)
+	}
+}
+
+// Help func for make line of message about trigger of run, scheduled runs are not labeled
+func triggerMessage(trigger string) string {
+	switch trigger {
+	case TriggerCatchUp:
+		return "\nTrigger: <b>catch-up of missed schedule</b>"
+	case TriggerManual:
+		return "\nTrigger: <b>manual run</b>"
+	}
+
+	return ""
+}
@@ -0,0 +1,131 @@
+package job
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+)
+
+// Kinds of freshness SLA of backups
+const (
+	SLAFullBackup = "full_backup" // Newest full backup
+	SLABackup     = "backup"      // Newest backup, full or incremental
+)
+
+// SLACheck - result of one SLA for parsed backups info
+type SLACheck struct {
+	Kind   string
+	MaxAge time.Duration
+	// Newest backup of kind, nil when there are no backups of kind
+	Backup *BackupInfo
+	Age    time.Duration
+	// Backups info is not available, for example info command fails since start
+	Unknown bool
+}
+
+// Check is violated, when backup is missing, unknown or older than max age
+func (sc *SLACheck) Violated() bool {
+	return sc.Backup == nil || sc.Age > sc.MaxAge
+}
+
+// Func for check backups info by SLA of target, only set SLA are checked
+func CheckSLA(sla *config.SLAConfig, bi []*BackupInfo, now time.Time) []*SLACheck {
+	var checks []*SLACheck
+
+	if sla.MaxFullBackupAge > 0 {
+		checks = append(checks, newSLACheck(SLAFullBackup, sla.MaxFullBackupAge.Duration(), getOnlyFullBackups(bi), now))
+	}
+	if sla.MaxBackupAge > 0 {
+		checks = append(checks, newSLACheck(SLABackup, sla.MaxBackupAge.Duration(), bi, now))
+	}
+
+	return checks
+}
+
+// Func for make checks of SLA of target, when backups info is not available
+// Such checks are violated, because freshness of backups is unknown
+func UnknownSLA(sla *config.SLAConfig) []*SLACheck {
+	checks := CheckSLA(sla, nil, time.Now())
+	for _, check := range checks {
+		check.Unknown = true
+	}
+
+	return checks
+}
+
+// Private func for check newest of backups
+func newSLACheck(kind string, maxAge time.Duration, bi []*BackupInfo, now time.Time) *SLACheck {
+	check := &SLACheck{Kind: kind, MaxAge: maxAge, Backup: latestBackup(bi)}
+	if check.Backup != nil {
+		check.Age = now.Sub(check.Backup.Time)
+	}
+
+	return check
+}
+
+// Help func for make one line description of check for logs and events
+func slaMessage(check *SLACheck) string {
+	if check.Unknown {
+		return fmt.Sprintf("%s is unknown, backups info is not received, max age %s", slaKindName(check.Kind), check.MaxAge)
+	}
+	if check.Backup == nil {
+		return fmt.Sprintf("%s is not found, max age %s", slaKindName(check.Kind), check.MaxAge)
+	}
+
+	return fmt.Sprintf("%s %s is %s old, max age %s",
+		slaKindName(check.Kind), check.Backup.BackupName, check.Age.Round(time.Minute), check.MaxAge)
+}
+
+// Help func for get readable name of SLA kind
+func slaKindName(kind string) string {
+	if kind == SLAFullBackup {
+		return "newest full backup"
+	}
+
+	return "newest backup"
+}
+
+// SLAState - last known violations of SLA of target, it is used for notify only changes of state
+// State is kept in memory, so after restart violated SLA is alerted again
+type SLAState struct {
+	mu sync.Mutex
+	// Kinds of SLA, which were checked, by violation
+	violated map[string]bool
+}
+
+// Constructor
+func NewSLAState() *SLAState {
+	return &SLAState{violated: make(map[string]bool)}
+}
+
+// Update state by checks and return violated and recovered checks
+// SLA, which is met on first check, is not reported as recovered
+func (ss *SLAState) Update(checks []*SLACheck) (violated []*SLACheck, recovered []*SLACheck) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	checked := make(map[string]bool, len(checks))
+	for _, check := range checks {
+		checked[check.Kind] = true
+
+		wasViolated := ss.violated[check.Kind]
+		switch {
+		case check.Violated() && !wasViolated:
+			violated = append(violated, check)
+		case !check.Violated() && wasViolated:
+			recovered = append(recovered, check)
+		}
+		ss.violated[check.Kind] = check.Violated()
+	}
+
+	// SLA is removed from config, its violation is forgotten
+	for kind := range ss.violated {
+		if !checked[kind] {
+			delete(ss.violated, kind)
+		}
+	}
+
+	return violated, recovered
+}
@@ -0,0 +1,189 @@
+package job
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+)
+
+func TestCheckSLA(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	backups := []*BackupInfo{
+		{BackupName: "base_01", Time: now.Add(-30 * time.Hour)},
+		{BackupName: "base_01_D_02", Time: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		name         string
+		sla          *config.SLAConfig
+		backups      []*BackupInfo
+		wantViolated map[string]bool
+	}{
+		{
+			name: "test full backup is too old, incremental backup is fresh",
+			sla: &config.SLAConfig{
+				MaxFullBackupAge: config.Duration(26 * time.Hour),
+				MaxBackupAge:     config.Duration(6 * time.Hour),
+			},
+			backups:      backups,
+			wantViolated: map[string]bool{SLAFullBackup: true, SLABackup: false},
+		},
+		{
+			name:         "test only set SLA is checked",
+			sla:          &config.SLAConfig{MaxFullBackupAge: config.Duration(48 * time.Hour)},
+			backups:      backups,
+			wantViolated: map[string]bool{SLAFullBackup: false},
+		},
+		{
+			name: "test without backups SLA is violated",
+			sla: &config.SLAConfig{
+				MaxFullBackupAge: config.Duration(26 * time.Hour),
+				MaxBackupAge:     config.Duration(6 * time.Hour),
+			},
+			backups:      nil,
+			wantViolated: map[string]bool{SLAFullBackup: true, SLABackup: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotViolated := make(map[string]bool)
+			for _, check := range CheckSLA(tt.sla, tt.backups, now) {
+				gotViolated[check.Kind] = check.Violated()
+			}
+
+			if !reflect.DeepEqual(gotViolated, tt.wantViolated) {
+				t.Errorf("CheckSLA() \ngot = %v\nwant %v", gotViolated, tt.wantViolated)
+			}
+		})
+	}
+}
+
+func TestSLAStateUpdate(t *testing.T) {
+	check := func(kind string, violated bool) *SLACheck {
+		check := &SLACheck{Kind: kind, MaxAge: time.Hour, Backup: &BackupInfo{BackupName: "base_01"}}
+		if violated {
+			check.Age = 2 * time.Hour
+		}
+
+		return check
+	}
+	kinds := func(checks []*SLACheck) []string {
+		var kinds []string
+		for _, check := range checks {
+			kinds = append(kinds, check.Kind)
+		}
+
+		return kinds
+	}
+
+	state := NewSLAState()
+	steps := []struct {
+		name          string
+		checks        []*SLACheck
+		wantViolated  []string
+		wantRecovered []string
+	}{
+		{
+			name:   "test met SLA on first check is not reported",
+			checks: []*SLACheck{check(SLAFullBackup, false), check(SLABackup, false)},
+		},
+		{
+			name:         "test violation is reported",
+			checks:       []*SLACheck{check(SLAFullBackup, true), check(SLABackup, false)},
+			wantViolated: []string{SLAFullBackup},
+		},
+		{
+			name:   "test repeated violation is not reported",
+			checks: []*SLACheck{check(SLAFullBackup, true), check(SLABackup, false)},
+		},
+		{
+			name:          "test recovery is reported",
+			checks:        []*SLACheck{check(SLAFullBackup, false), check(SLABackup, false)},
+			wantRecovered: []string{SLAFullBackup},
+		},
+		{
+			name:         "test removed SLA is forgotten",
+			checks:       []*SLACheck{check(SLAFullBackup, true)},
+			wantViolated: []string{SLAFullBackup},
+		},
+		{
+			name:         "test readded SLA is checked from start",
+			checks:       []*SLACheck{check(SLAFullBackup, true), check(SLABackup, true)},
+			wantViolated: []string{SLABackup},
+		},
+	}
+
+	// Steps share state, so they are run in order
+	for _, step := range steps {
+		violated, recovered := state.Update(step.checks)
+
+		if got := kinds(violated); !reflect.DeepEqual(got, step.wantViolated) {
+			t.Errorf("%s: Update() violated \ngot = %v\nwant %v", step.name, got, step.wantViolated)
+		}
+		if got := kinds(recovered); !reflect.DeepEqual(got, step.wantRecovered) {
+			t.Errorf("%s: Update() recovered \ngot = %v\nwant %v", step.name, got, step.wantRecovered)
+		}
+	}
+}
+
+func TestInfoJobFailChecksStaleSLA(t *testing.T) {
+	config.TimeZone = time.UTC
+
+	sla := &config.SLAConfig{MaxFullBackupAge: config.Duration(26 * time.Hour)}
+	backupsInfo := NewLatestBackupsInfo()
+
+	ij := &InfoJob{
+		Target:          "main",
+		SLA:             sla,
+		SLAState:        NewSLAState(),
+		SLANotification: &config.TelegramNotificationSLAConfig{},
+		BackupsInfo:     backupsInfo,
+	}
+
+	// Last received backup becomes stale, while info command fails
+	backupsInfo.Update("main", []*BackupInfo{{BackupName: "base_01", Time: time.Now().Add(-30 * time.Hour)}}, time.Now().Add(-4*time.Hour))
+	ij.fail(newRun(uuid.New(), "main", JobInfo, TriggerSchedule), nil, nil, errors.New("pod is gone"))
+
+	_, recovered := ij.SLAState.Update(CheckSLA(sla, []*BackupInfo{{BackupName: "base_02", Time: time.Now()}}, time.Now()))
+	if len(recovered) != 1 || recovered[0].Kind != SLAFullBackup {
+		t.Errorf("recovered = %v, want violation of full backup SLA by failed info run", recovered)
+	}
+}
+
+func TestInfoJobFailedFirstRunViolatesSLA(t *testing.T) {
+	config.TimeZone = time.UTC
+
+	ij := &InfoJob{
+		Target:          "main",
+		SLA:             &config.SLAConfig{MaxFullBackupAge: config.Duration(26 * time.Hour)},
+		SLAState:        NewSLAState(),
+		SLANotification: &config.TelegramNotificationSLAConfig{},
+		BackupsInfo:     NewLatestBackupsInfo(),
+	}
+
+	// Backups info is not received since start, freshness of backups is unknown
+	run := newRun(uuid.New(), "main", JobInfo, TriggerSchedule)
+	ij.fail(run, nil, nil, errors.New("storage credentials are invalid"))
+	if !ij.SLAState.violated[SLAFullBackup] {
+		t.Fatalf("SLA state = %v, want violation of full backup SLA", ij.SLAState.violated)
+	}
+
+	checks := UnknownSLA(ij.SLA)
+	if len(checks) != 1 || !checks[0].Violated() {
+		t.Fatalf("UnknownSLA() = %v, want one violated check", checks)
+	}
+
+	// Alert has reason and error of failed run
+	msg := ij.slaNotificationMessage("backup SLA violated", checks[0], run, time.Time{})
+	for _, want := range []string{"Backup: <b>unknown</b>", "not received since start", "Reason: <b>" + run.Reason + "</b>", "storage credentials are invalid"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("slaNotificationMessage() = %q, want contains %q", msg, want)
+		}
+	}
+}
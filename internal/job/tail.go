@@ -0,0 +1,89 @@
+package job
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Limits of tail of command output in notifications
+const (
+	tailMaxBytes = 2048
+	tailMaxLines = 20
+)
+
+// Max length of telegram message, tags of HTML are counted too, so notification is not longer in any case
+const messageMaxLength = 4096
+
+// tailWriter - keeps end of stream, for show last lines of command output in notifications
+type tailWriter struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Constructor
+func newTailWriter() *tailWriter {
+	return &tailWriter{}
+}
+
+// Implements io.Writer, only last tailMaxBytes bytes are kept
+func (tw *tailWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.buf = append(tw.buf, p...)
+	if len(tw.buf) > tailMaxBytes {
+		tw.buf = append(tw.buf[:0], tw.buf[len(tw.buf)-tailMaxBytes:]...)
+	}
+
+	return len(p), nil
+}
+
+// Get last tailMaxLines lines, first line is dropped when it is cut by byte limit
+func (tw *tailWriter) String() string {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tail := string(tw.buf)
+	if len(tw.buf) == tailMaxBytes {
+		if i := strings.IndexByte(tail, '\n'); i >= 0 {
+			tail = tail[i+1:]
+		}
+		// Line without line break may be cut inside of UTF-8 symbol
+		for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+			tail = tail[1:]
+		}
+	}
+
+	lines := strings.Split(strings.TrimRight(tail, "\n"), "\n")
+	if len(lines) > tailMaxLines {
+		lines = lines[len(lines)-tailMaxLines:]
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Help func for add escaped output to notification message, first lines or symbols of output are dropped,
+// so message is not longer than telegram limit
+func appendOutput(msg string, output string) string {
+	const format = "\nOutput:\n<pre>%s</pre>"
+
+	max := messageMaxLength - utf8.RuneCountInString(msg) - utf8.RuneCountInString(fmt.Sprintf(format, ""))
+	escaped := html.EscapeString(output)
+	for output != "" && utf8.RuneCountInString(escaped) > max {
+		if i := strings.IndexByte(output, '\n'); i >= 0 {
+			output = output[i+1:]
+		} else {
+			_, size := utf8.DecodeRuneInString(output)
+			output = output[size:]
+		}
+		escaped = html.EscapeString(output)
+	}
+	if output == "" {
+		return msg
+	}
+
+	return msg + fmt.Sprintf(format, escaped)
+}
@@ -0,0 +1,101 @@
+package job
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTailWriter(t *testing.T) {
+	manyLines := make([]string, 0, 30)
+	for i := 1; i <= 30; i++ {
+		manyLines = append(manyLines, fmt.Sprintf("line %d", i))
+	}
+
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{
+			name:   "test empty output",
+			writes: nil,
+			want:   "",
+		},
+		{
+			name:   "test output in several writes",
+			writes: []string{"first li", "ne\nsecond line\n"},
+			want:   "first line\nsecond line",
+		},
+		{
+			name:   "test only last lines are kept",
+			writes: []string{strings.Join(manyLines, "\n") + "\n"},
+			want:   strings.Join(manyLines[10:], "\n"),
+		},
+		{
+			name:   "test line cut by byte limit is dropped",
+			writes: []string{strings.Repeat("x", tailMaxBytes), "\nlast line\n"},
+			want:   "last line",
+		},
+		{
+			name:   "test line without line break is cut by symbols",
+			writes: []string{strings.Repeat("я", tailMaxBytes/2) + "x"},
+			want:   strings.Repeat("я", tailMaxBytes/2-1) + "x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tw := newTailWriter()
+			for _, write := range tt.writes {
+				if _, err := tw.Write([]byte(write)); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if got := tw.String(); got != tt.want {
+				t.Errorf("String() \ngot = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		output  string
+		wantEnd string
+	}{
+		{
+			name:    "test output is escaped",
+			msg:     "backup failed",
+			output:  "ERROR: <nil> & more",
+			wantEnd: "<pre>ERROR: &lt;nil&gt; &amp; more</pre>",
+		},
+		{
+			name:    "test first lines of long escaped output are dropped",
+			msg:     strings.Repeat("m", 3000),
+			output:  strings.Repeat("<>\n", 400) + "last line",
+			wantEnd: "&lt;&gt;\nlast line</pre>",
+		},
+		{
+			name:    "test output is not added without space",
+			msg:     strings.Repeat("m", messageMaxLength),
+			output:  "last line",
+			wantEnd: "mmm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := appendOutput(tt.msg, tt.output)
+			if !strings.HasSuffix(got, tt.wantEnd) {
+				t.Errorf("appendOutput() = %q, want suffix %q", got, tt.wantEnd)
+			}
+			if n := utf8.RuneCountInString(got); n > messageMaxLength {
+				t.Errorf("length = %d, want at most %d", n, messageMaxLength)
+			}
+		})
+	}
+}
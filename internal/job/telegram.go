@@ -0,0 +1,22 @@
+package job
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// Help func for send HTML message of job to chats, each message is sent in own goroutine
+// Silent message is sent without sound, tag is prefix of logs of job, for example [BackupJob]
+func sendTelegram(api *tgbotapi.BotAPI, tag string, chatIds []int64, msg string, silent bool) {
+	for _, chatId := range chatIds {
+		tgmsg := tgbotapi.NewMessage(chatId, msg)
+		tgmsg.ParseMode = tgbotapi.ModeHTML
+		tgmsg.DisableNotification = silent
+
+		go func(tgmsg tgbotapi.MessageConfig) {
+			if _, err := api.Send(tgmsg); err != nil {
+				klog.Errorf("%s Can't send tg notification: %s", tag, err.Error())
+			}
+		}(tgmsg)
+	}
+}
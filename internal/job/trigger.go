@@ -0,0 +1,146 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+)
+
+// Errors of manual runs
+var (
+	ErrTargetNotFound = errors.New("target is not found")
+	ErrJobNotFound    = errors.New("job is not scheduled for target")
+	ErrNotScheduling  = errors.New("scheduling is stopped, replica is not leader or shuts down")
+)
+
+// ScheduledEntry - cron entry of job of target
+type ScheduledEntry struct {
+	Target string `json:"target"`
+	Job    string `json:"job"`
+	// Nil, when cron is not started on this replica
+	Next *time.Time `json:"next,omitempty"`
+	// Nil, when job was not run by cron since start
+	Prev *time.Time `json:"prev,omitempty"`
+}
+
+// Entries of jobs of all targets, sorted by target and job
+func (r *Registry) Entries() []*ScheduledEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []*ScheduledEntry
+	for name, registered := range r.targets {
+		for _, entryId := range registered.entryIds {
+			entry := r.cron.Entry(entryId)
+			job, ok := entry.Job.(targetJob)
+			if !ok {
+				continue
+			}
+
+			scheduled := &ScheduledEntry{Target: name, Job: job.kind()}
+			if !entry.Next.IsZero() {
+				next := entry.Next
+				scheduled.Next = &next
+			}
+			if !entry.Prev.IsZero() {
+				prev := entry.Prev
+				scheduled.Prev = &prev
+			}
+			entries = append(entries, scheduled)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Target == entries[j].Target {
+			return entries[i].Job < entries[j].Job
+		}
+
+		return entries[i].Target < entries[j].Target
+	})
+
+	return entries
+}
+
+// Trigger run of job of target out of schedule, run shares guard and overlap policy with scheduled runs
+// Id of run is returned at once, channel receives result of runTriggered, when run is finished, skipped or dropped
+// ErrRunning is returned at once, when previous run is running and overlap policy is skip
+func (r *Registry) Trigger(target string, jobKind string) (uuid.UUID, <-chan error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Queued runs are dropped, when replica stops scheduling, so run is not accepted
+	if r.deps.Scheduling != nil && !r.deps.Scheduling() {
+		return uuid.Nil, nil, ErrNotScheduling
+	}
+
+	registered, ok := r.targets[target]
+	if !ok {
+		return uuid.Nil, nil, ErrTargetNotFound
+	}
+
+	job := r.findJob(registered, jobKind)
+	if job == nil {
+		return uuid.Nil, nil, ErrJobNotFound
+	}
+	if registered.target.Overlap.Policy == config.OverlapPolicySkip && job.running() {
+		return uuid.Nil, nil, ErrRunning
+	}
+
+	id := uuid.New()
+	done := make(chan error, 1)
+
+	klog.Infof("[Registry] %s: Manual run %s of %s job is triggered", target, id, jobKind)
+
+	r.runs.Add(1)
+	go func() {
+		defer r.runs.Done()
+
+		done <- job.runTriggered(id, TriggerManual)
+	}()
+
+	return id, done, nil
+}
+
+// Fetch backups info of target by info command out of runs, backups info of target is updated
+// It is used, when backups info is requested before first info run, events and notifications are not sent
+func (r *Registry) FetchBackups(ctx context.Context, target string) ([]*BackupInfo, error) {
+	r.mu.Lock()
+	registered, ok := r.targets[target]
+	if !ok {
+		r.mu.Unlock()
+
+		return nil, ErrTargetNotFound
+	}
+	infoJob, ok := r.findJob(registered, JobInfo).(*InfoJob)
+	r.mu.Unlock()
+
+	// Command may run long, so it is executed without lock of registry
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+
+	return infoJob.fetchBackups(ctx)
+}
+
+// Wait catch-up and manual runs, which are started out of cron, it is called on shutdown after stop of scheduling
+func (r *Registry) Wait() {
+	r.runs.Wait()
+}
+
+// Private method for find job of target by kind in cron entries, nil when job is not scheduled
+func (r *Registry) findJob(registered *registeredTarget, jobKind string) targetJob {
+	for _, entryId := range registered.entryIds {
+		job, ok := r.cron.Entry(entryId).Job.(targetJob)
+		if ok && job.kind() == jobKind {
+			return job
+		}
+	}
+
+	return nil
+}
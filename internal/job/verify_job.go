@@ -0,0 +1,265 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/utils"
+	"k8s.io/client-go/kubernetes"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Backups info has no full backups for verification
+var errNoFullBackups = errors.New("full backups are not found")
+
+// VerifyJob - struct for manage job, which restores latest full backup in scratch Job and checks it by SQL
+type VerifyJob struct {
+	Target string
+	// Backups are listed by info command in database pod
+	Info *InfoJob
+	// Restore is executed in Job from template
+	Runner         *kube.JobRunner
+	Verify         *config.VerifyConfig
+	Notification   *config.TelegramNotificationVerifyConfig
+	Overlap        *config.OverlapConfig
+	Guard          *RunGuard
+	TelegramBotApi *tgbotapi.BotAPI
+	// Nil when events are disabled
+	Events     *kube.EventRecorder
+	Observers  []RunObserver
+	Scheduling func() bool
+	// Context of new runs, cancelled on loss of leadership, nil means ctx
+	RunContext func() context.Context
+
+	// Parent context of all runs, cancelled on shutdown
+	ctx context.Context
+}
+
+// Constructor, Job template of verification is loaded here
+func NewVerifyJob(ctx context.Context, target *config.TargetConfig, kj *kube.KubeJob, guard *RunGuard, deps *Dependencies) (*VerifyJob, error) {
+	runner, err := newVerifyRunner(target, deps.Client, kj)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VerifyJob{
+		Target:         target.Name,
+		Info:           NewInfoJob(ctx, target, kj, nil, nil, deps),
+		Runner:         runner,
+		Verify:         &target.Verify,
+		Notification:   &target.Notification.Verify,
+		Overlap:        &target.Overlap,
+		Guard:          guard,
+		TelegramBotApi: deps.TelegramBotApi,
+		Events:         deps.Events,
+		Observers:      deps.Observers,
+		Scheduling:     deps.Scheduling,
+		RunContext:     deps.RunContext,
+		ctx:            ctx,
+	}, nil
+}
+
+// Main required method, which implements cron.Job interface
+// Run is skipped, queued or replaces previous run by overlap policy, when previous run is still running
+func (vj *VerifyJob) Run() {
+	vj.runTriggered(uuid.New(), TriggerSchedule)
+}
+
+// Private method for get kind of job in runs
+func (vj *VerifyJob) kind() string {
+	return JobVerify
+}
+
+// Private method for check previous run of job is still running
+func (vj *VerifyJob) running() bool {
+	return vj.Guard.Running()
+}
+
+// Private method for run job by trigger in guard by overlap policy, see runGuarded
+// Error is returned, when run is skipped or queued run is cancelled
+func (vj *VerifyJob) runTriggered(id uuid.UUID, trigger string) error {
+	return runGuarded(vj.ctx, "[VerifyJob]", vj.Target, vj.Guard, vj.Overlap, vj.Scheduling, vj.RunContext, nil, func(ctx context.Context) {
+		vj.run(ctx, id, trigger)
+	})
+}
+
+// Private method for run verification in guard, ctx is cancelled on shutdown or by replacing run
+func (vj *VerifyJob) run(ctx context.Context, id uuid.UUID, trigger string) {
+	klog.Infof("[VerifyJob] %s: Start processing Job!", vj.Target)
+
+	run := newRun(id, vj.Target, JobVerify, trigger)
+	run.Attempts = 1
+
+	// Listing and restore are cancelled after timeout, on shutdown or by replacing run
+	ctx, cancel := context.WithTimeout(ctx, vj.Verify.Timeout.Duration())
+	defer cancel()
+
+	backup, err := vj.latestFullBackup(ctx)
+	if err != nil {
+		vj.fail(run, nil, nil, err)
+
+		return
+	}
+	run.BackupName = backup.BackupName
+
+	placement, err := vj.Runner.Prepare(ctx)
+	if err != nil {
+		vj.fail(run, nil, nil, err)
+
+		return
+	}
+	run.Pod = placement.Job
+
+	vj.Events.Record(placement, v1.EventTypeNormal, "VerifyStarted",
+		fmt.Sprintf("Restore verification %s of backup %s is started in Job %s", run.Id, backup.BackupName, placement.Job))
+
+	// Logs of Job are written to os stdout, tail of them is kept for failure notification
+	outputTail := newTailWriter()
+	result, err := vj.Runner.ExecIn(ctx, placement, vj.script(backup.BackupName), nil,
+		io.MultiWriter(os.Stdout, outputTail), os.Stderr)
+	run.Output = outputTail.String()
+	if result != nil && result.Pod != "" {
+		run.Pod = result.Pod
+	}
+	if err != nil {
+		vj.fail(run, placement, result, err)
+
+		return
+	}
+
+	vj.succeed(run, placement, result)
+}
+
+// Private method for select latest full backup by info command in database pod
+func (vj *VerifyJob) latestFullBackup(ctx context.Context) (*BackupInfo, error) {
+	backups, err := vj.Info.fetchBackups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := latestBackup(getOnlyFullBackups(backups))
+	if latest == nil {
+		return nil, errNoFullBackups
+	}
+
+	return latest, nil
+}
+
+// Private method for make script of Job: restore of backup, then SQL check
+func (vj *VerifyJob) script(backupName string) string {
+	restore := strings.ReplaceAll(vj.Verify.Restore, config.BackupNamePlaceholder, backupName)
+	check := strings.ReplaceAll(vj.Verify.Check, config.SQLPlaceholder, shellQuote(vj.Verify.SQL))
+
+	return fmt.Sprintf("set -e\n%s\n%s\n", restore, check)
+}
+
+// Private method for log, record event, report and notify passed verification
+func (vj *VerifyJob) succeed(run *Run, placement *kube.Placement, result *kube.ExecResult) {
+	duration := result.Duration().Round(time.Second)
+	message := fmt.Sprintf("backup %s is restored and checked in %s", run.BackupName, duration)
+
+	klog.Infof("[VerifyJob] %s: %s", vj.Target, message)
+
+	run.succeed(result, message)
+	observeRun(vj.Observers, run)
+
+	vj.Events.Record(placement, v1.EventTypeNormal, "VerifySucceeded",
+		fmt.Sprintf("Restore verification %s: %s", run.Id, message))
+
+	if vj.Notification.Enabled {
+		klog.Infof("[VerifyJob] %s: Send passed verification telegram notifications", run.Id)
+
+		sendTelegram(vj.TelegramBotApi, "[VerifyJob]", vj.Notification.ChatIds, vj.verifyMessage(run), true)
+	}
+
+	klog.Infof("[VerifyJob] %s: End processing Job!", vj.Target)
+}
+
+// Private method for log, record event, report and notify failed verification
+// Placement and result are nil, when Job was not started
+func (vj *VerifyJob) fail(run *Run, placement *kube.Placement, result *kube.ExecResult, err error) {
+	run.fail(result, err)
+
+	klog.Errorf("[VerifyJob] %s: %s", vj.Target, run.Message)
+
+	recordFailureEvent(vj.Events, placement, vj.Target, "Verify", run.Reason,
+		fmt.Sprintf("Restore verification %s: %s", run.Id, run.Message))
+
+	observeRun(vj.Observers, run)
+
+	if vj.Notification.Enabled {
+		klog.Infof("[VerifyJob] %s: Send failed verification telegram notifications", run.Id)
+
+		// Failed verification is sent with sound
+		sendTelegram(vj.TelegramBotApi, "[VerifyJob]", vj.Notification.ChatIds, vj.verifyMessage(run), false)
+	}
+
+	klog.Errorf("[VerifyJob] %s: Exit Job!", vj.Target)
+}
+
+// Private method for generate message of passed or failed verification
+func (vj *VerifyJob) verifyMessage(run *Run) string {
+	// Get now date with Russian format
+	date := utils.NowDateTz().Format("02.01.2006 15:04")
+
+	result := "restore verification passed"
+	if run.Status == RunFailed {
+		result = "restore verification failed"
+	}
+
+	msg := fmt.Sprintf("<b>%s</b>: %s", strings.ToUpper(vj.Target), result)
+	msg += fmt.Sprintf("\n\nUuid: <b>%s</b>", run.Id.String())
+	msg += triggerMessage(run.Trigger)
+	if run.BackupName != "" {
+		msg += fmt.Sprintf("\nBackup: <b>%s</b>", run.BackupName)
+	}
+	if run.Pod != "" {
+		msg += fmt.Sprintf("\nPod: <b>%s</b>", run.Pod)
+	}
+	msg += fmt.Sprintf("\nDuration: <b>%s</b>", run.FinishedAt.Sub(run.StartedAt).Round(time.Second))
+	if run.Status == RunFailed {
+		msg += fmt.Sprintf("\nReason: <b>%s</b>", run.Reason)
+		msg += fmt.Sprintf("\nError: <code>%s</code>", html.EscapeString(run.Message))
+	}
+	msg += fmt.Sprintf("\nDate: <b>%s</b>\n", date)
+	if run.Status == RunFailed && run.Output != "" {
+		msg = appendOutput(msg, run.Output)
+	}
+
+	return msg
+}
+
+// Private func for create runner of verification Job from template of target
+func newVerifyRunner(target *config.TargetConfig, client *kubernetes.Clientset, kj *kube.KubeJob) (*kube.JobRunner, error) {
+	template, err := kube.LoadJobTemplate(target.Verify.JobTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := kube.NewJobRunner(client, target.Pod.Namespace, template, target.Verify.JobContainer)
+	if err != nil {
+		return nil, err
+	}
+	// Database pods are used for references of events
+	runner.PodSelector = target.PodSelector()
+	runner.Pods = kj.Pods
+
+	return runner, nil
+}
+
+// Help func for quote string as one argument of sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,43 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+)
+
+func TestVerifyJobScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		verify *config.VerifyConfig
+		want   string
+	}{
+		{
+			name: "test backup name and SQL are substituted",
+			verify: &config.VerifyConfig{
+				Restore: "wal-g backup-fetch /data {backup}",
+				Check:   "psql -At -c {sql}",
+				SQL:     "SELECT count(*) FROM users",
+			},
+			want: "set -e\nwal-g backup-fetch /data base_01\npsql -At -c 'SELECT count(*) FROM users'\n",
+		},
+		{
+			name: "test quotes in SQL are escaped",
+			verify: &config.VerifyConfig{
+				Restore: "restore {backup}",
+				Check:   "psql -c {sql}",
+				SQL:     "SELECT 'ok'",
+			},
+			want: "set -e\nrestore base_01\npsql -c 'SELECT '\\''ok'\\'''\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vj := &VerifyJob{Verify: tt.verify}
+			if got := vj.script("base_01"); got != tt.want {
+				t.Errorf("script() \ngot = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package job
+
+import (
+	"encoding/json"
+)
+
+// Statuses of checks of wal-g wal-verify
+const (
+	WalVerifyOk      = "OK"
+	WalVerifyWarning = "WARNING"
+	WalVerifyFailure = "FAILURE"
+)
+
+// Status of range of segments, which are found in storage
+const WalSegmentsFound = "FOUND"
+
+// Example WalVerifyReport Json
+// {
+// 	"integrity": {
+// 		"status": "OK",
+// 		"details": [{
+// 			"timeline_id": 1,
+// 			"start_segment": "000000010000000000000002",
+// 			"end_segment": "000000010000000000000006",
+// 			"segments_count": 5,
+// 			"status": "FOUND"
+// 		}]
+// 	},
+// 	"timeline": {
+// 		"status": "OK",
+// 		"details": {
+// 			"current_timeline_id": 1,
+// 			"highest_storage_timeline_id": 1
+// 		}
+// 	}
+// }
+
+// Helper struct for parse output of wal-g wal-verify --json, check is nil, when it is not requested
+type WalVerifyReport struct {
+	Integrity *WalIntegrityCheck `json:"integrity"`
+	Timeline  *WalTimelineCheck  `json:"timeline"`
+}
+
+type WalIntegrityCheck struct {
+	Status  string             `json:"status"`
+	Details []*WalSegmentRange `json:"details"`
+}
+
+// WalSegmentRange - range of segments of timeline with same status
+// Statuses: FOUND, MISSING_DELAYED, MISSING_UPLOADING, MISSING_LOST
+type WalSegmentRange struct {
+	TimelineId    uint32 `json:"timeline_id"`
+	StartSegment  string `json:"start_segment"`
+	EndSegment    string `json:"end_segment"`
+	SegmentsCount int    `json:"segments_count"`
+	Status        string `json:"status"`
+}
+
+type WalTimelineCheck struct {
+	Status  string              `json:"status"`
+	Details *WalTimelineDetails `json:"details"`
+}
+
+type WalTimelineDetails struct {
+	CurrentTimelineId        uint32 `json:"current_timeline_id"`
+	HighestStorageTimelineId uint32 `json:"highest_storage_timeline_id"`
+}
+
+// Func for parse json to struct
+func parseWalVerifyJson(reportJson string) (*WalVerifyReport, error) {
+	var report WalVerifyReport
+
+	err := json.Unmarshal([]byte(reportJson), &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// Worst status of checks: FAILURE, WARNING or OK, report without checks is failure
+func (wvr *WalVerifyReport) Status() string {
+	checkStatuses := wvr.checkStatuses()
+	if len(checkStatuses) == 0 {
+		return WalVerifyFailure
+	}
+
+	status := WalVerifyOk
+	for _, checkStatus := range checkStatuses {
+		switch {
+		case checkStatus == WalVerifyOk:
+		case checkStatus == WalVerifyWarning && status == WalVerifyOk:
+			status = WalVerifyWarning
+		case checkStatus != WalVerifyWarning:
+			// Unknown status is failure too
+			status = WalVerifyFailure
+		}
+	}
+
+	return status
+}
+
+// Ranges of segments, which are missing in storage
+func (wvr *WalVerifyReport) Gaps() []*WalSegmentRange {
+	if wvr.Integrity == nil {
+		return nil
+	}
+
+	var gaps []*WalSegmentRange
+	for _, segments := range wvr.Integrity.Details {
+		if segments.Status != WalSegmentsFound {
+			gaps = append(gaps, segments)
+		}
+	}
+
+	return gaps
+}
+
+// Name of last segment, which is found in storage, empty when integrity is not checked
+// Names of segments have same length, so they are compared as strings
+func (wvr *WalVerifyReport) LastArchivedSegment() string {
+	if wvr.Integrity == nil {
+		return ""
+	}
+
+	var last string
+	for _, segments := range wvr.Integrity.Details {
+		if segments.Status == WalSegmentsFound && segments.EndSegment > last {
+			last = segments.EndSegment
+		}
+	}
+
+	return last
+}
+
+// Private method for get statuses of requested checks
+func (wvr *WalVerifyReport) checkStatuses() []string {
+	var statuses []string
+	if wvr.Integrity != nil {
+		statuses = append(statuses, wvr.Integrity.Status)
+	}
+	if wvr.Timeline != nil {
+		statuses = append(statuses, wvr.Timeline.Status)
+	}
+
+	return statuses
+}
@@ -0,0 +1,306 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/suchimauz/walg-k8s-cron-backup/internal/config"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/kube"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/storage"
+	"github.com/suchimauz/walg-k8s-cron-backup/pkg/utils"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Status of WAL archive is not OK
+var errWalVerify = errors.New("WAL archive is not OK")
+
+// WalVerifyJob - struct for manage job, which checks WAL archive by wal-g wal-verify
+// Report is sent to chats of info notifications and saved to storage like backups info
+type WalVerifyJob struct {
+	Target         string
+	Storage        storage.Provider
+	KubeJob        *kube.KubeJob
+	Notification   *config.TelegramNotificationInfoConfig
+	Exec           string
+	Timeout        time.Duration
+	Retry          *RetryPolicy
+	Overlap        *config.OverlapConfig
+	Guard          *RunGuard
+	TelegramBotApi *tgbotapi.BotAPI
+	// Nil when events are disabled
+	Events     *kube.EventRecorder
+	Observers  []RunObserver
+	Scheduling func() bool
+	// Context of new runs, cancelled on loss of leadership, nil means ctx
+	RunContext func() context.Context
+
+	// Parent context of all runs, cancelled on shutdown
+	ctx context.Context
+}
+
+// Constructor
+func NewWalVerifyJob(ctx context.Context, target *config.TargetConfig, kj *kube.KubeJob, guard *RunGuard, deps *Dependencies) *WalVerifyJob {
+	return &WalVerifyJob{
+		Target:         target.Name,
+		Storage:        deps.Storage,
+		KubeJob:        kj,
+		Notification:   &target.Notification.Info,
+		Exec:           target.Exec.WalVerify,
+		Timeout:        target.Exec.WalVerifyTimeout.Duration(),
+		Retry:          NewRetryPolicy(&target.Retry),
+		Overlap:        &target.Overlap,
+		Guard:          guard,
+		TelegramBotApi: deps.TelegramBotApi,
+		Events:         deps.Events,
+		Observers:      deps.Observers,
+		Scheduling:     deps.Scheduling,
+		RunContext:     deps.RunContext,
+		ctx:            ctx,
+	}
+}
+
+// Main required method, which implements cron.Job interface
+// Run is skipped, queued or replaces previous run by overlap policy, when previous run is still running
+func (wj *WalVerifyJob) Run() {
+	wj.runTriggered(uuid.New(), TriggerSchedule)
+}
+
+// Private method for get kind of job in runs
+func (wj *WalVerifyJob) kind() string {
+	return JobWalVerify
+}
+
+// Private method for check previous run of job is still running
+func (wj *WalVerifyJob) running() bool {
+	return wj.Guard.Running()
+}
+
+// Private method for run job by trigger in guard by overlap policy, see runGuarded
+// Error is returned, when run is skipped or queued run is cancelled
+func (wj *WalVerifyJob) runTriggered(id uuid.UUID, trigger string) error {
+	return runGuarded(wj.ctx, "[WalVerifyJob]", wj.Target, wj.Guard, wj.Overlap, wj.Scheduling, wj.RunContext, nil, func(ctx context.Context) {
+		wj.run(ctx, id, trigger)
+	})
+}
+
+// Private method for run check in guard, ctx is cancelled on shutdown or by replacing run
+func (wj *WalVerifyJob) run(ctx context.Context, id uuid.UUID, trigger string) {
+	klog.Infof("[WalVerifyJob] %s: Start processing Job!", wj.Target)
+
+	run := newRun(id, wj.Target, JobWalVerify, trigger)
+
+	for {
+		run.Attempts++
+
+		placement, result, report, err := wj.attempt(ctx)
+		if err == nil {
+			wj.report(run, placement, result, report)
+
+			return
+		}
+
+		// Run is failed, when failure is not retryable or attempts are over
+		delay, retry := wj.Retry.Next(run.Attempts, failureReason(result, err))
+		if !retry {
+			wj.fail(run, placement, result, err)
+
+			return
+		}
+
+		klog.Warnf("[WalVerifyJob] %s: Attempt %d/%d is failed: %s, retry in %s",
+			wj.Target, run.Attempts, wj.Retry.MaxAttempts, failureMessage(result, err), delay)
+
+		if !waitRetry(ctx, delay) {
+			wj.fail(run, placement, nil, fmt.Errorf("%w: retry is cancelled", ctx.Err()))
+
+			return
+		}
+	}
+}
+
+// Private method for run one attempt: select pod, execute command with timeout and parse its output
+// Placement is nil, when pod is not selected
+func (wj *WalVerifyJob) attempt(ctx context.Context) (*kube.Placement, *kube.ExecResult, *WalVerifyReport, error) {
+	var stdout, stderr bytes.Buffer
+
+	// Command is cancelled after timeout, on shutdown or by replacing run
+	ctx, cancel := context.WithTimeout(ctx, wj.Timeout)
+	defer cancel()
+
+	// Select pod by readiness and role policy
+	placement, err := wj.KubeJob.Prepare(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	wj.Events.Record(placement, v1.EventTypeNormal, "WalVerifyStarted",
+		fmt.Sprintf("WAL archive check is started: %s", wj.Exec))
+
+	// wal-g writes logs to stderr, so only stdout is parsed
+	result, err := wj.KubeJob.ExecIn(ctx, placement, wj.Exec, nil, &stdout, &stderr)
+	if stderr.Len() > 0 {
+		klog.Infof("[WalVerifyJob] %s: stderr: %s", wj.Target, stderr.String())
+	}
+	if err != nil {
+		return placement, result, nil, err
+	}
+
+	report, err := parseWalVerifyJson(stdout.String())
+	if err != nil {
+		return placement, result, nil, fmt.Errorf("%w: parse json: %s", errInvalidOutput, err.Error())
+	}
+
+	return placement, result, report, nil
+}
+
+// Private method for report parsed check: run is failed and alert is sent with sound, when status is not OK
+func (wj *WalVerifyJob) report(run *Run, placement *kube.Placement, result *kube.ExecResult, report *WalVerifyReport) {
+	status := report.Status()
+	summary := walVerifySummary(report)
+
+	if status == WalVerifyOk {
+		klog.Infof("[WalVerifyJob] %s: %s", wj.Target, summary)
+
+		wj.Events.Record(placement, v1.EventTypeNormal, "WalVerifySucceeded", summary)
+		run.succeed(result, summary)
+	} else {
+		klog.Errorf("[WalVerifyJob] %s: %s", wj.Target, summary)
+
+		wj.Events.Record(placement, v1.EventTypeWarning, "WalVerifyFailed", summary)
+		run.fail(result, fmt.Errorf("%w: %s", errWalVerify, summary))
+	}
+	observeRun(wj.Observers, run)
+
+	if wj.Notification.Enabled {
+		klog.Infof("[WalVerifyJob] %s: Send telegram notifications!", wj.Target)
+
+		sendTelegram(wj.TelegramBotApi, "[WalVerifyJob]", wj.Notification.ChatIds, wj.walVerifyMessage(run, report), status == WalVerifyOk)
+	}
+
+	// Save report to storage, storage is nil when save logs is disabled
+	if wj.Storage != nil {
+		// Upload is cancelled after timeout or on shutdown
+		ctx, cancel := context.WithTimeout(wj.ctx, wj.Timeout)
+		defer cancel()
+
+		err := wj.saveReportFile(ctx, report)
+		if err != nil {
+			klog.Errorf("[WalVerifyJob] %s: Error on upload file: %s", wj.Target, err.Error())
+		}
+	}
+
+	klog.Infof("[WalVerifyJob] %s: End processing Job!", wj.Target)
+}
+
+// Private method for log, record event, report and notify failed command
+// Placement and result are nil, when command was not started
+func (wj *WalVerifyJob) fail(run *Run, placement *kube.Placement, result *kube.ExecResult, err error) {
+	run.fail(result, err)
+
+	klog.Errorf("[WalVerifyJob] %s: %s", wj.Target, run.Message)
+
+	recordFailureEvent(wj.Events, placement, wj.Target, "WalVerify", run.Reason, run.Message)
+
+	observeRun(wj.Observers, run)
+
+	if wj.Notification.Enabled {
+		klog.Infof("[WalVerifyJob] %s: Send failed check telegram notifications", run.Id)
+
+		sendTelegram(wj.TelegramBotApi, "[WalVerifyJob]", wj.Notification.ChatIds, wj.walVerifyMessage(run, nil), false)
+	}
+
+	klog.Errorf("[WalVerifyJob] %s: Exit Job!", wj.Target)
+}
+
+// Private method for generate message of check, report is nil, when command is failed
+func (wj *WalVerifyJob) walVerifyMessage(run *Run, report *WalVerifyReport) string {
+	// Get now date with Russian format
+	date := utils.NowDateTz().Format("02.01.2006 15:04")
+
+	if report == nil {
+		msg := fmt.Sprintf("<b>%s</b>: WAL archive check failed", strings.ToUpper(wj.Target))
+		msg += fmt.Sprintf("\n\nUuid: <b>%s</b>", run.Id.String())
+		msg += triggerMessage(run.Trigger)
+		msg += fmt.Sprintf("\nReason: <b>%s</b>", run.Reason)
+		msg += fmt.Sprintf("\nError: <code>%s</code>", html.EscapeString(run.Message))
+		msg += fmt.Sprintf("\nDate: <b>%s</b>\n", date)
+
+		return msg
+	}
+
+	msg := fmt.Sprintf("<b>%s</b>: WAL archive <b>%s</b>", strings.ToUpper(wj.Target), report.Status())
+	msg += fmt.Sprintf("\n\nUuid: <b>%s</b>", run.Id.String())
+	msg += triggerMessage(run.Trigger)
+	if report.Integrity != nil {
+		msg += fmt.Sprintf("\nIntegrity: <b>%s</b>", report.Integrity.Status)
+	}
+	if report.Timeline != nil {
+		msg += fmt.Sprintf("\nTimeline: <b>%s</b>", report.Timeline.Status)
+		if details := report.Timeline.Details; details != nil {
+			msg += fmt.Sprintf(" (current %d, highest in storage %d)",
+				details.CurrentTimelineId, details.HighestStorageTimelineId)
+		}
+	}
+	if last := report.LastArchivedSegment(); last != "" {
+		msg += fmt.Sprintf("\nLast archived segment: <code>%s</code>", last)
+	}
+	msg += fmt.Sprintf("\nDate: <b>%s</b>\n", date)
+
+	if gaps := report.Gaps(); len(gaps) > 0 {
+		msg += fmt.Sprintf("\n<b>Gaps: %d</b>", len(gaps))
+		for _, gap := range gaps {
+			msg += fmt.Sprintf("\n<code>%s - %s</code> %s, %d segments",
+				gap.StartSegment, gap.EndSegment, gap.Status, gap.SegmentsCount)
+		}
+		msg += "\n"
+	}
+
+	return msg
+}
+
+// Private method for save report to storage
+func (wj *WalVerifyJob) saveReportFile(ctx context.Context, report *WalVerifyReport) error {
+	reportJson, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	// Upload file to storage
+	path, err := saveLogFile(ctx, wj.Storage, wj.Target, "wal_verify", reportJson)
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("[FileStorage] Save WAL archive check: %s", path)
+
+	return nil
+}
+
+// Help func for make one line summary of check for logs, events and runs
+func walVerifySummary(report *WalVerifyReport) string {
+	parts := []string{fmt.Sprintf("WAL archive status %s", report.Status())}
+	if report.Integrity != nil {
+		parts = append(parts, fmt.Sprintf("integrity %s", report.Integrity.Status))
+	}
+	if report.Timeline != nil {
+		parts = append(parts, fmt.Sprintf("timeline %s", report.Timeline.Status))
+	}
+	if gaps := report.Gaps(); len(gaps) > 0 {
+		parts = append(parts, fmt.Sprintf("%d gaps", len(gaps)))
+	}
+	if last := report.LastArchivedSegment(); last != "" {
+		parts = append(parts, fmt.Sprintf("last archived segment %s", last))
+	}
+
+	return strings.Join(parts, ", ")
+}
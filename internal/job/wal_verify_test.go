@@ -0,0 +1,93 @@
+package job
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWalVerifyJson(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     string
+		wantErr  bool
+		wantStat string
+		wantGaps []string
+		wantLast string
+	}{
+		{
+			name: "test archive without gaps",
+			json: `{
+				"integrity": {"status": "OK", "details": [
+					{"timeline_id": 1, "start_segment": "000000010000000000000002", "end_segment": "000000010000000000000006", "segments_count": 5, "status": "FOUND"},
+					{"timeline_id": 2, "start_segment": "000000020000000000000007", "end_segment": "000000020000000000000009", "segments_count": 3, "status": "FOUND"}
+				]},
+				"timeline": {"status": "OK", "details": {"current_timeline_id": 2, "highest_storage_timeline_id": 2}}
+			}`,
+			wantStat: WalVerifyOk,
+			wantLast: "000000020000000000000009",
+		},
+		{
+			name: "test lost segments",
+			json: `{
+				"integrity": {"status": "FAILURE", "details": [
+					{"timeline_id": 1, "start_segment": "000000010000000000000002", "end_segment": "000000010000000000000003", "segments_count": 2, "status": "FOUND"},
+					{"timeline_id": 1, "start_segment": "000000010000000000000004", "end_segment": "000000010000000000000005", "segments_count": 2, "status": "MISSING_LOST"},
+					{"timeline_id": 1, "start_segment": "000000010000000000000006", "end_segment": "000000010000000000000006", "segments_count": 1, "status": "FOUND"}
+				]},
+				"timeline": {"status": "OK", "details": {"current_timeline_id": 1, "highest_storage_timeline_id": 1}}
+			}`,
+			wantStat: WalVerifyFailure,
+			wantGaps: []string{"000000010000000000000004"},
+			wantLast: "000000010000000000000006",
+		},
+		{
+			name: "test warning of timeline",
+			json: `{
+				"timeline": {"status": "WARNING", "details": {"current_timeline_id": 1, "highest_storage_timeline_id": 2}}
+			}`,
+			wantStat: WalVerifyWarning,
+		},
+		{
+			name:     "test unknown status",
+			json:     `{"integrity": {"status": "UNKNOWN"}}`,
+			wantStat: WalVerifyFailure,
+		},
+		{
+			name:     "test report without checks",
+			json:     `{}`,
+			wantStat: WalVerifyFailure,
+		},
+		{
+			name:    "test invalid json",
+			json:    `INFO: 2024/01/01 00:00:00 wal-verify`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := parseWalVerifyJson(tt.json)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWalVerifyJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var gotGaps []string
+			for _, gap := range report.Gaps() {
+				gotGaps = append(gotGaps, gap.StartSegment)
+			}
+
+			if got := report.Status(); got != tt.wantStat {
+				t.Errorf("Status() = %v, want %v", got, tt.wantStat)
+			}
+			if !reflect.DeepEqual(gotGaps, tt.wantGaps) {
+				t.Errorf("Gaps() = %v, want %v", gotGaps, tt.wantGaps)
+			}
+			if got := report.LastArchivedSegment(); got != tt.wantLast {
+				t.Errorf("LastArchivedSegment() = %v, want %v", got, tt.wantLast)
+			}
+		})
+	}
+}
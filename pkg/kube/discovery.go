@@ -0,0 +1,149 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Size of page of list of pods metadata in discovery
+const discoveryPageSize = 500
+
+// AnnotatedObject - StatefulSet or standalone pod, which is marked by annotation for backup
+type AnnotatedObject struct {
+	Kind      string
+	Namespace string
+	Name      string
+	UID       types.UID
+	// Selectors of pods of object, pass them to PodSelector
+	LabelSelector string
+	FieldSelector string
+	// First container of pod template, it is used when container is not annotated
+	DefaultContainer string
+	Annotations      map[string]string
+}
+
+// Make reference to object for record events on it
+func (ao *AnnotatedObject) Reference() *v1.ObjectReference {
+	apiVersion := "v1"
+	if ao.Kind == "StatefulSet" {
+		apiVersion = "apps/v1"
+	}
+
+	return &v1.ObjectReference{
+		APIVersion: apiVersion,
+		Kind:       ao.Kind,
+		Namespace:  ao.Namespace,
+		Name:       ao.Name,
+		UID:        ao.UID,
+	}
+}
+
+// Find StatefulSets and pods without controller, which have annotation, in namespaces
+// All namespaces are used, when namespaces are empty
+// Pods are listed by metadata only and annotations are checked locally, so full pods are read only for annotated pods
+func FindAnnotatedObjects(ctx context.Context, client kubernetes.Interface, meta metadata.Interface, namespaces []string, annotation string) ([]AnnotatedObject, error) {
+	if len(namespaces) < 1 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var objects []AnnotatedObject
+	for _, namespace := range namespaces {
+		statefulSets, err := client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sts := range statefulSets.Items {
+			if _, ok := sts.Annotations[annotation]; !ok {
+				continue
+			}
+
+			selector, err := metav1.LabelSelectorAsSelector(sts.Spec.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("StatefulSet %s/%s: %s", sts.Namespace, sts.Name, err.Error())
+			}
+
+			objects = append(objects, AnnotatedObject{
+				Kind:             "StatefulSet",
+				Namespace:        sts.Namespace,
+				Name:             sts.Name,
+				UID:              sts.UID,
+				LabelSelector:    selector.String(),
+				DefaultContainer: firstContainerName(sts.Spec.Template.Spec.Containers),
+				Annotations:      sts.Annotations,
+			})
+		}
+
+		pods, err := findAnnotatedPods(ctx, client, meta, namespace, annotation)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, pods...)
+	}
+
+	return objects, nil
+}
+
+// Private func for find pods without controller, which have annotation, in namespace
+// Pods are listed by pages of metadata, only annotated pods are read for containers
+func findAnnotatedPods(ctx context.Context, client kubernetes.Interface, meta metadata.Interface, namespace string, annotation string) ([]AnnotatedObject, error) {
+	podsMeta := meta.Resource(v1.SchemeGroupVersion.WithResource("pods")).Namespace(namespace)
+
+	var objects []AnnotatedObject
+	options := metav1.ListOptions{Limit: discoveryPageSize}
+	for {
+		list, err := podsMeta.List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range list.Items {
+			podMeta := &list.Items[i]
+			// Pods of controllers are annotated by template, controller itself must be annotated
+			if _, ok := podMeta.Annotations[annotation]; !ok || metav1.GetControllerOf(podMeta) != nil {
+				continue
+			}
+
+			pod, err := client.CoreV1().Pods(podMeta.Namespace).Get(ctx, podMeta.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			objects = append(objects, AnnotatedObject{
+				Kind:             "Pod",
+				Namespace:        pod.Namespace,
+				Name:             pod.Name,
+				UID:              pod.UID,
+				FieldSelector:    fields.OneTermEqualSelector("metadata.name", pod.Name).String(),
+				DefaultContainer: firstContainerName(pod.Spec.Containers),
+				Annotations:      pod.Annotations,
+			})
+		}
+
+		if list.Continue == "" {
+			return objects, nil
+		}
+		options.Continue = list.Continue
+	}
+}
+
+// Private func for get name of first container, empty when there are no containers
+func firstContainerName(containers []v1.Container) string {
+	if len(containers) < 1 {
+		return ""
+	}
+
+	return containers[0].Name
+}
@@ -0,0 +1,82 @@
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+func TestFindAnnotatedObjects(t *testing.T) {
+	annotation := "walg-backup/schedule"
+	controller := true
+	annotations := map[string]string{annotation: "0 0 1 * * *"}
+
+	newPod := func(name string, annotations map[string]string, owners []metav1.OwnerReference) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "db", Annotations: annotations, OwnerReferences: owners},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "postgres"}}},
+		}
+	}
+	pods := []*v1.Pod{
+		newPod("standalone", annotations, nil),
+		newPod("plain", nil, nil),
+		newPod("db-0", annotations, []metav1.OwnerReference{{Kind: "StatefulSet", Name: "db", Controller: &controller}}),
+	}
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "db", Annotations: annotations},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+			Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "postgres"}}}},
+		},
+	}
+
+	client := fake.NewSimpleClientset(sts, pods[0], pods[1], pods[2])
+
+	// Metadata client knows same pods by metadata only
+	scheme := runtime.NewScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	var metas []runtime.Object
+	for _, pod := range pods {
+		metas = append(metas, &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: pod.ObjectMeta,
+		})
+	}
+	meta := metadatafake.NewSimpleMetadataClient(scheme, metas...)
+
+	got, err := FindAnnotatedObjects(context.Background(), client, meta, nil, annotation)
+	if err != nil {
+		t.Fatalf("FindAnnotatedObjects() error = %v", err)
+	}
+
+	want := []AnnotatedObject{
+		{
+			Kind:             "StatefulSet",
+			Namespace:        "db",
+			Name:             "db",
+			LabelSelector:    "app=db",
+			DefaultContainer: "postgres",
+			Annotations:      annotations,
+		},
+		{
+			Kind:             "Pod",
+			Namespace:        "db",
+			Name:             "standalone",
+			FieldSelector:    "metadata.name=standalone",
+			DefaultContainer: "postgres",
+			Annotations:      annotations,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindAnnotatedObjects() \ngot = %+v\nwant %+v", got, want)
+	}
+}
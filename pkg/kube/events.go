@@ -0,0 +1,126 @@
+package kube
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// Source component of recorded events
+const eventComponent = "walg-k8s-cron-backup"
+
+// Namespace of pod of service, it is mounted with token of ServiceAccount
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// EventRecorder - records core/v1 Events about jobs on target pod or its owning StatefulSet,
+// so backup history is shown by kubectl describe next to database
+type EventRecorder struct {
+	// Record events on owning StatefulSet of pod, pod is used when it has no owner
+	OnOwner bool
+	// Object of events, when pod of target is not selected, for example pod of service, nil means not recorded
+	Fallback *v1.ObjectReference
+
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+}
+
+// Create new EventRecorder struct object [Constructor]
+func NewEventRecorder(client *kubernetes.Clientset, onOwner bool) *EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+
+	return &EventRecorder{
+		OnOwner:     onOwner,
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventComponent}),
+	}
+}
+
+// Record event on object of placement, eventType is v1.EventTypeNormal or v1.EventTypeWarning
+// Nil recorder is allowed, event of placement without object is recorded on fallback object
+func (er *EventRecorder) Record(placement *Placement, eventType string, reason string, message string) {
+	if er == nil {
+		return
+	}
+
+	ref := er.Fallback
+	if placement != nil && placement.PodRef != nil {
+		ref = placement.PodRef
+		if er.OnOwner && placement.OwnerRef != nil {
+			ref = placement.OwnerRef
+		}
+	}
+	if ref == nil {
+		return
+	}
+
+	er.recorder.Event(ref, eventType, reason, message)
+}
+
+// Find reference to pod of service by hostname and namespace of ServiceAccount, nil out of cluster
+// Uid is filled, when pod is readable, event is recorded by name and namespace without it
+func SelfReference(ctx context.Context, client kubernetes.Interface) *v1.ObjectReference {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil
+	}
+	namespace, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return nil
+	}
+
+	ref := &v1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  strings.TrimSpace(string(namespace)),
+		Name:       hostname,
+	}
+	if pod, err := client.CoreV1().Pods(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{}); err == nil {
+		ref, _ = podReferences(pod)
+	}
+
+	return ref
+}
+
+// Stop sending events to api server
+func (er *EventRecorder) Shutdown() {
+	if er == nil {
+		return
+	}
+
+	er.broadcaster.Shutdown()
+}
+
+// Private func for make references to pod and its owning StatefulSet, owner is nil when pod has no one
+func podReferences(pod *v1.Pod) (*v1.ObjectReference, *v1.ObjectReference) {
+	podRef := &v1.ObjectReference{
+		APIVersion:      "v1",
+		Kind:            "Pod",
+		Namespace:       pod.Namespace,
+		Name:            pod.Name,
+		UID:             pod.UID,
+		ResourceVersion: pod.ResourceVersion,
+	}
+
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "StatefulSet" && owner.Controller != nil && *owner.Controller {
+			return podRef, &v1.ObjectReference{
+				APIVersion: owner.APIVersion,
+				Kind:       owner.Kind,
+				Namespace:  pod.Namespace,
+				Name:       owner.Name,
+				UID:        owner.UID,
+			}
+		}
+	}
+
+	return podRef, nil
+}
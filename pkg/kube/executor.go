@@ -0,0 +1,21 @@
+package kube
+
+import (
+	"context"
+	"io"
+)
+
+// Executor - way of command execution for backup target
+// KubeJob executes command in database pod, JobRunner creates batch/v1 Job for command
+type Executor interface {
+	// Select where command will be executed
+	Prepare(ctx context.Context) (*Placement, error)
+	// Execute command in placement, result is returned with error too, when command was started
+	ExecIn(ctx context.Context, placement *Placement, command string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*ExecResult, error)
+}
+
+// Both executors implement Executor interface
+var (
+	_ Executor = (*KubeJob)(nil)
+	_ Executor = (*JobRunner)(nil)
+)
@@ -0,0 +1,287 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+const (
+	// Label of Jobs, which are created by JobRunner
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "walg-k8s-cron-backup"
+
+	// Timeout of Job deletion, it is not bound to context of command
+	jobCleanupTimeout = 30 * time.Second
+)
+
+// Interval of check Job status
+var jobPollInterval = 5 * time.Second
+
+// JobRunner - executor, which runs command in new batch/v1 Job from template,
+// waits for completion, writes logs of Job pod to stdout and deletes Job
+type JobRunner struct {
+	Client        kubernetes.Interface
+	Namespace     string
+	Template      *batchv1.Job
+	ContainerName string
+	// Optional selector of database pods, it is used only for references of events
+	PodSelector *PodSelector
+	// Optional cache of database pods
+	Pods *PodCache
+}
+
+// Create new JobRunner struct object [Constructor]
+// When containerName is empty, first container of template is used
+func NewJobRunner(client kubernetes.Interface, namespace string, template *batchv1.Job, containerName string) (*JobRunner, error) {
+	containers := template.Spec.Template.Spec.Containers
+	if len(containers) < 1 {
+		return nil, errors.New("Job template has no containers")
+	}
+	if containerName == "" {
+		containerName = containers[0].Name
+	}
+	if findContainerIndex(containers, containerName) < 0 {
+		return nil, fmt.Errorf("%w: %s in Job template", ErrContainerNotFound, containerName)
+	}
+	if template.Name == "" {
+		return nil, errors.New("Job template has no metadata.name, it is used as prefix of Job names")
+	}
+
+	return &JobRunner{
+		Client:        client,
+		Namespace:     namespace,
+		Template:      template,
+		ContainerName: containerName,
+	}, nil
+}
+
+// Read batch/v1 Job manifest from YAML or JSON file
+func LoadJobTemplate(path string) (*batchv1.Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var job batchv1.Job
+	if err := yaml.UnmarshalStrict(data, &job); err != nil {
+		return nil, fmt.Errorf("Job template %s: %s", path, err.Error())
+	}
+
+	return &job, nil
+}
+
+// Generate name of new Job, Job is created in ExecIn
+func (jr *JobRunner) Prepare(ctx context.Context) (*Placement, error) {
+	placement := &Placement{
+		Namespace: jr.Namespace,
+		Job:       fmt.Sprintf("%s-%s", jr.Template.Name, rand.String(5)),
+		Container: jr.ContainerName,
+	}
+
+	// Database pod is not required for Job, so lookup errors are ignored
+	if jr.PodSelector != nil {
+		pods, err := listPods(ctx, jr.Client, jr.Pods, jr.PodSelector)
+		if err == nil && len(pods) > 0 {
+			placement.PodRef, placement.OwnerRef = podReferences(&pods[0])
+		}
+	}
+
+	return placement, nil
+}
+
+// Create Job with command, wait for completion and write logs of pod to stdout
+// Job pod has one log stream, so stderr is not used
+// When context is done, Job is deleted with pod, so command is terminated
+func (jr *JobRunner) ExecIn(ctx context.Context, placement *Placement, command string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*ExecResult, error) {
+	result := &ExecResult{
+		Container: placement.Container,
+		ExitCode:  UnknownExitCode,
+	}
+
+	if stdin != nil {
+		return result, errors.New("stdin is not supported by Job executor")
+	}
+
+	jobs := jr.Client.BatchV1().Jobs(placement.Namespace)
+
+	result.StartedAt = time.Now()
+	job, err := jobs.Create(ctx, jr.newJob(placement, command), metav1.CreateOptions{})
+	if err != nil {
+		return result, err
+	}
+	defer jr.cleanup(job)
+
+	// Wait Complete or Failed condition of Job
+	// Errors of api server are transient for long commands, so only deleted Job stops waiting
+	err = wait.PollImmediateUntilWithContext(ctx, jobPollInterval, func(ctx context.Context) (bool, error) {
+		current, err := jobs.Get(ctx, placement.Job, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("job %s/%s is deleted before completion", placement.Namespace, placement.Job)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				klog.Warnf("[JobRunner] Can't get job %s/%s, retry: %s", placement.Namespace, placement.Job, err.Error())
+			}
+
+			return false, nil
+		}
+
+		return jobFinished(current), nil
+	})
+	result.FinishedAt = time.Now()
+	if err != nil {
+		if ctx.Err() != nil {
+			return result, fmt.Errorf("%w: job %s/%s", ctx.Err(), placement.Namespace, placement.Job)
+		}
+
+		return result, err
+	}
+
+	pod, err := jr.findJobPod(ctx, placement)
+	if err != nil {
+		return result, err
+	}
+	result.Pod = pod.Name
+
+	// Write logs of Job pod to stdout
+	stdoutCounter := newCountingWriter(stdout)
+	if err := jr.copyLogs(ctx, pod, placement.Container, stdoutCounter); err != nil {
+		return result, err
+	}
+	result.StdoutBytes = stdoutCounter.count
+
+	// Exit code from terminated state of container
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == placement.Container && status.State.Terminated != nil {
+			result.ExitCode = int(status.State.Terminated.ExitCode)
+		}
+	}
+
+	if result.ExitCode > 0 {
+		return result, utilexec.CodeExitError{
+			Err:  fmt.Errorf("job %s/%s failed: container exited with code %d", placement.Namespace, placement.Job, result.ExitCode),
+			Code: result.ExitCode,
+		}
+	}
+	if result.ExitCode == UnknownExitCode {
+		return result, fmt.Errorf("job %s/%s is finished, but container %s is not terminated",
+			placement.Namespace, placement.Job, placement.Container)
+	}
+
+	return result, nil
+}
+
+// Private method for make Job from template with command
+func (jr *JobRunner) newJob(placement *Placement, command string) *batchv1.Job {
+	job := jr.Template.DeepCopy()
+	job.ObjectMeta = metav1.ObjectMeta{
+		Name:        placement.Job,
+		Namespace:   placement.Namespace,
+		Labels:      job.Labels,
+		Annotations: job.Annotations,
+	}
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[managedByLabel] = managedByValue
+
+	// Retries are not made by Job, pod is not restarted
+	backoffLimit := int32(0)
+	job.Spec.BackoffLimit = &backoffLimit
+	job.Spec.Template.Spec.RestartPolicy = v1.RestartPolicyNever
+
+	containers := job.Spec.Template.Spec.Containers
+	container := &containers[findContainerIndex(containers, placement.Container)]
+	container.Command = []string{"sh", "-c", command}
+	container.Args = nil
+
+	return job
+}
+
+// Private method for find pod of finished Job
+func (jr *JobRunner) findJobPod(ctx context.Context, placement *Placement) (*v1.Pod, error) {
+	pods, err := jr.Client.CoreV1().Pods(placement.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", placement.Job),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(pods.Items) < 1 {
+		return nil, fmt.Errorf("%w: job %s/%s", ErrPodNotFound, placement.Namespace, placement.Job)
+	}
+
+	// Retries are disabled, so Job has one pod
+	pod := pods.Items[0]
+
+	return &pod, nil
+}
+
+// Private method for write logs of container to writer
+func (jr *JobRunner) copyLogs(ctx context.Context, pod *v1.Pod, containerName string, writer io.Writer) error {
+	logs, err := jr.Client.CoreV1().Pods(pod.Namespace).
+		GetLogs(pod.Name, &v1.PodLogOptions{Container: containerName}).
+		Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	_, err = io.Copy(writer, logs)
+
+	return err
+}
+
+// Private method for delete Job with pods, it is called after command even on cancelled context
+func (jr *JobRunner) cleanup(job *batchv1.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobCleanupTimeout)
+	defer cancel()
+
+	propagation := metav1.DeletePropagationBackground
+	err := jr.Client.BatchV1().Jobs(job.Namespace).Delete(ctx, job.Name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil {
+		klog.Errorf("[JobRunner] Can't delete job %s/%s: %s", job.Namespace, job.Name, err.Error())
+	}
+}
+
+// Private func for check Job has Complete or Failed condition
+func jobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		if condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Private func for find index of container by name, -1 when not found
+func findContainerIndex(containers []v1.Container, name string) int {
+	for i := range containers {
+		if containers[i].Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
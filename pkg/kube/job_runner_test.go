@@ -0,0 +1,71 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestJobRunnerSurvivesGetError(t *testing.T) {
+	jobPollInterval = 10 * time.Millisecond
+
+	template := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "verify"},
+		Spec: batchv1.JobSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "postgres"}},
+		}}},
+	}
+	placement := &Placement{Namespace: "db", Job: "verify-abcde", Container: "postgres"}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "verify-abcde-x1", Namespace: "db", Labels: map[string]string{"job-name": placement.Job}},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+			Name:  "postgres",
+			State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}},
+		}}},
+	}
+	client := fake.NewSimpleClientset(pod)
+
+	// First get of Job fails, next gets return completed Job
+	gets := 0
+	client.PrependReactor("get", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets == 1 {
+			return true, nil, errors.New("connection refused")
+		}
+
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: placement.Job, Namespace: placement.Namespace}}
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}
+
+		return true, job, nil
+	})
+
+	runner, err := NewJobRunner(client, "db", template, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	result, err := runner.ExecIn(ctx, placement, "true", nil, &stdout, nil)
+	if err != nil {
+		t.Fatalf("ExecIn() error = %v, want nil", err)
+	}
+	if gets < 2 {
+		t.Errorf("gets = %d, want retry after error", gets)
+	}
+	if result.ExitCode != 0 || result.Pod != pod.Name {
+		t.Errorf("result = %+v, want exit code 0 of pod %s", result, pod.Name)
+	}
+}
@@ -1,24 +1,57 @@
 package kube
 
 import (
+	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
 
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// Environment variable of exec command, all processes of command inherit it, so they are found for termination
+	execRunEnv = "WALG_K8S_CRON_BACKUP_RUN"
+	// Timeout of termination of command, it is not bound to context of command
+	execTerminateTimeout = 30 * time.Second
+)
+
 type PodSelector struct {
 	LabelSelector string
+	// Optional, for select standalone pod by name
+	FieldSelector string
 	ContainerName string
 	Namespace     string
+	// Selection by role label, for example spilo-role of Patroni, not used when RoleLabel is empty
+	RoleLabel     string
+	RolePolicy    string
+	LeaderValues  []string
+	ReplicaValues []string
+}
+
+// Placement - pod and container, where command will be executed
+type Placement struct {
+	Namespace string
+	Pod       string
+	Container string
+	// Name of Job, when command is executed by JobRunner, pod is known after Job is finished
+	Job string
+	// Value of role label, empty when role label is not configured
+	Role string
+	// Explanation of fallback, when preferred role is unavailable
+	Note string
+	// Objects for record events: target pod and its owning StatefulSet, nil when unknown
+	PodRef   *v1.ObjectReference
+	OwnerRef *v1.ObjectReference
 }
 
 // Assembly of necessary methods and fields for kubernetes for project
@@ -26,40 +59,78 @@ type KubeJob struct {
 	Client      *kubernetes.Clientset
 	KubeConfig  *rest.Config
 	PodSelector *PodSelector
+	// Optional cache of pods, pods are listed from api server when it is nil
+	Pods *PodCache
 }
 
 // Create new KubeJob struct object [Constructor]
-func NewKubeJob(client *kubernetes.Clientset, k8scfg *rest.Config, namespace string, labelSelector string, containerName string) (*KubeJob, error) {
+func NewKubeJob(client *kubernetes.Clientset, k8scfg *rest.Config, selector *PodSelector) (*KubeJob, error) {
 	return &KubeJob{
-		Client:     client,
-		KubeConfig: k8scfg,
-		PodSelector: &PodSelector{
-			LabelSelector: labelSelector,
-			ContainerName: containerName,
-			Namespace:     namespace,
-		},
+		Client:      client,
+		KubeConfig:  k8scfg,
+		PodSelector: selector,
 	}, nil
 }
 
-func findPodByLabels(client *kubernetes.Clientset, namespace string, labelSelector string) (*v1.Pod, error) {
-	pods, err := client.CoreV1().Pods(namespace).List(
-		context.TODO(), // empty context
+// List pods of selector from cache, from api server when cache is nil or not synced
+func listPods(ctx context.Context, client kubernetes.Interface, cache *PodCache, ps *PodSelector) ([]v1.Pod, error) {
+	if cache != nil {
+		pods, err := cache.List(ctx, ps)
+		if err == nil {
+			return pods, nil
+		}
+		klog.Warnf("[PodCache] %s, list pods from api server", err.Error())
+	}
+
+	pods, err := client.CoreV1().Pods(ps.Namespace).List(
+		ctx,
 		metav1.ListOptions{
-			LabelSelector: labelSelector, // labelSelector for pod from config
+			LabelSelector: ps.LabelSelector, // labelSelector for pod from config
+			FieldSelector: ps.FieldSelector,
 		})
 	if err != nil {
 		return nil, err
 	}
 
-	if len(pods.Items) < 1 {
-		errMsg := fmt.Sprintf("Pod with labels %s in %s namespace not found!", labelSelector, namespace)
+	return pods.Items, nil
+}
+
+// Find pod by labels, which is suitable by readiness and role policy, with note about role fallback
+func findPodByLabels(ctx context.Context, client kubernetes.Interface, cache *PodCache, ps *PodSelector) (*v1.Pod, string, error) {
+	pods, err := listPods(ctx, client, cache, ps)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(pods) < 1 {
+		return nil, "", fmt.Errorf("%w: labels %s in %s namespace", ErrPodNotFound, ps.selectorString(), ps.Namespace)
+	}
+
+	if containerMissing(pods, ps.ContainerName) {
+		return nil, "", fmt.Errorf("%w: %s in pods with labels %s in %s namespace",
+			ErrContainerNotFound, ps.ContainerName, ps.selectorString(), ps.Namespace)
+	}
 
-		return nil, errors.New(errMsg)
+	// Skip pods, which are not running, have not ready container or have not suitable role
+	pod, note, skipped := selectPodByRole(pods, ps)
+	if pod == nil {
+		return nil, "", fmt.Errorf("%w: labels %s in %s namespace, role policy %s, skipped pods: %s",
+			ErrPodNotReady, ps.selectorString(), ps.Namespace, ps.RolePolicy, formatSkippedPods(skipped))
 	}
 
-	pod := pods.Items[0]
+	return pod, note, nil
+}
 
-	return &pod, nil
+// Private method for describe selector in errors
+func (ps *PodSelector) selectorString() string {
+	if ps.FieldSelector == "" {
+		return ps.LabelSelector
+	}
+	if ps.LabelSelector == "" {
+		return ps.FieldSelector
+	}
+
+	return ps.LabelSelector + "," + ps.FieldSelector
 }
 
 func findContainerByName(pod *v1.Pod, containerName string) (*v1.Container, error) {
@@ -74,17 +145,15 @@ func findContainerByName(pod *v1.Pod, containerName string) (*v1.Container, erro
 
 	// When not found container
 	if len(foundContainers) < 1 {
-		errMsg := fmt.Sprintf("Container %s in pod %s/%s not found!", containerName, pod.Namespace, pod.Name)
-
-		return nil, errors.New(errMsg)
+		return nil, fmt.Errorf("%w: %s in pod %s/%s", ErrContainerNotFound, containerName, pod.Namespace, pod.Name)
 	}
 	foundContainer := foundContainers[0]
 
 	return &foundContainer, nil
 }
 
-func (kj *KubeJob) GetPod() (*v1.Pod, error) {
-	pod, err := findPodByLabels(kj.Client, kj.PodSelector.Namespace, kj.PodSelector.LabelSelector)
+func (kj *KubeJob) GetPod(ctx context.Context) (*v1.Pod, error) {
+	pod, _, err := findPodByLabels(ctx, kj.Client, kj.Pods, kj.PodSelector)
 	if err != nil {
 		return nil, err
 	}
@@ -102,58 +171,133 @@ func (kj *KubeJob) GetContainerFromPod(pod *v1.Pod) (*v1.Container, error) {
 	return container, nil
 }
 
-func (kj *KubeJob) Exec(command string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
-	pod, err := kj.GetPod()
+// Select pod and container for command, placement is passed to ExecIn
+func (kj *KubeJob) Prepare(ctx context.Context) (*Placement, error) {
+	pod, note, err := findPodByLabels(ctx, kj.Client, kj.Pods, kj.PodSelector)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	container, err := kj.GetContainerFromPod(pod)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	placement := &Placement{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container.Name,
+		Note:      note,
+	}
+	if kj.PodSelector.RoleLabel != "" {
+		placement.Role = pod.Labels[kj.PodSelector.RoleLabel]
+	}
+	placement.PodRef, placement.OwnerRef = podReferences(pod)
+
+	return placement, nil
+}
+
+// Select pod and execute command in it, see Prepare and ExecIn
+func (kj *KubeJob) Exec(ctx context.Context, command string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*ExecResult, error) {
+	placement, err := kj.Prepare(ctx)
+	if err != nil {
+		return &ExecResult{Container: kj.PodSelector.ContainerName, ExitCode: UnknownExitCode}, err
+	}
+
+	return kj.ExecIn(ctx, placement, command, stdin, stdout, stderr)
+}
+
+// Execute command in pod container, result is returned with error too, when command was started
+// When context is done, stream is closed, processes of command are terminated by second exec
+// and context error is returned
+func (kj *KubeJob) ExecIn(ctx context.Context, placement *Placement, command string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*ExecResult, error) {
+	// Closing of stream does not stop remote process, so processes of command are marked for termination
+	runId := rand.String(10)
+
+	result, err := kj.stream(ctx, placement, []string{"env", execRunEnv + "=" + runId, "sh", "-c", command}, stdin, stdout, stderr)
+
+	// Stream error after closing connection is not informative, context error is returned
+	if err != nil && ctx.Err() != nil {
+		kj.terminate(placement, runId)
+
+		return result, fmt.Errorf("%w: %s", ctx.Err(), err.Error())
+	}
+
+	return result, err
+}
+
+// Private method for execute command in pod container over remotecommand, bound to context
+func (kj *KubeJob) stream(ctx context.Context, placement *Placement, command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*ExecResult, error) {
+	result := &ExecResult{
+		Pod:       placement.Pod,
+		Container: placement.Container,
+		ExitCode:  UnknownExitCode,
 	}
 
 	req := kj.Client.CoreV1().RESTClient().Post().
 		Resource("pods").
-		Name(pod.Name).
-		Namespace(pod.Namespace).
+		Name(placement.Pod).
+		Namespace(placement.Namespace).
 		SubResource("exec")
 	scheme := runtime.NewScheme()
-	err = v1.AddToScheme(scheme)
+	err := v1.AddToScheme(scheme)
 	if err != nil {
-		return err
+		return result, err
 	}
 
 	parameterCodec := runtime.NewParameterCodec(scheme)
 	req.VersionedParams(&v1.PodExecOptions{
-		Command: []string{
-			"sh",
-			"-c",
-			command,
-		},
-		Container: container.Name,
+		Command:   command,
+		Container: placement.Container,
 		Stdin:     stdin != nil,
 		Stdout:    true,
 		Stderr:    true,
 		TTY:       false,
 	}, parameterCodec)
 
-	// Execute over remotecommand
-	exec, err := remotecommand.NewSPDYExecutor(kj.KubeConfig, "POST", req.URL())
+	// Execute over remotecommand, bound to context
+	exec, err := newContextSPDYExecutor(ctx, kj.KubeConfig, req)
 	if err != nil {
-		return err
+		return result, err
 	}
 
+	// Count bytes of container streams
+	stdoutCounter := newCountingWriter(stdout)
+	stderrCounter := newCountingWriter(stderr)
+
 	// Write container stream to buffers
+	result.StartedAt = time.Now()
 	err = exec.Stream(remotecommand.StreamOptions{
 		Stdin:  stdin,
-		Stdout: stdout,
-		Stderr: stderr,
+		Stdout: stdoutCounter,
+		Stderr: stderrCounter,
 		Tty:    false,
 	})
-	if err != nil {
-		return err
+	result.FinishedAt = time.Now()
+	result.StdoutBytes = stdoutCounter.count
+	result.StderrBytes = stderrCounter.count
+	result.ExitCode = exitCodeFromError(err)
+
+	return result, err
+}
+
+// Private method for terminate processes of cancelled command, they are found by environment variable of run
+// Only shell builtins, tr and grep are used, so it works in minimal images without ps and pkill
+func (kj *KubeJob) terminate(placement *Placement, runId string) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTerminateTimeout)
+	defer cancel()
+
+	script := fmt.Sprintf(`for p in /proc/[0-9]*; do `+
+		`{ tr '\0' '\n' < "$p/environ" | grep -qx '%s=%s'; } 2>/dev/null && kill -TERM "${p#/proc/}" 2>/dev/null; `+
+		`done; true`, execRunEnv, runId)
+
+	var stderr bytes.Buffer
+	if _, err := kj.stream(ctx, placement, []string{"sh", "-c", script}, nil, nil, &stderr); err != nil {
+		klog.Errorf("[KubeJob] Can't terminate cancelled command in pod %s/%s: %s %s",
+			placement.Namespace, placement.Pod, err.Error(), stderr.String())
+
+		return
 	}
 
-	return nil
+	klog.Infof("[KubeJob] Cancelled command is terminated in pod %s/%s", placement.Namespace, placement.Pod)
 }
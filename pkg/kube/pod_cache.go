@@ -0,0 +1,216 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	klog "github.com/suchimauz/walg-k8s-cron-backup/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+// Max time for wait first sync of informer, after it pods are listed from api server
+const podCacheSyncTimeout = 30 * time.Second
+
+// PodCache - shared informers of pods by namespace and selectors, pods are read from local cache
+// Selector is acquired by targets, informer is started on first lookup of selector
+// and is stopped, when last target of selector is removed or context of cache is cancelled
+type PodCache struct {
+	client kubernetes.Interface
+	ctx    context.Context
+
+	mu        sync.Mutex
+	informers map[podCacheKey]*podInformer
+}
+
+// Key of informer, targets with same selector share one informer
+type podCacheKey struct {
+	namespace     string
+	labelSelector string
+	fieldSelector string
+}
+
+type podInformer struct {
+	// Count of targets, which use selector
+	refs int
+	// Stop of informer, it is bound to context of cache
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Nil until first lookup
+	informer cache.SharedIndexInformer
+	lister   corelisters.PodNamespaceLister
+}
+
+// Create new PodCache struct object [Constructor]
+func NewPodCache(ctx context.Context, client kubernetes.Interface) *PodCache {
+	return &PodCache{
+		client:    client,
+		ctx:       ctx,
+		informers: make(map[podCacheKey]*podInformer),
+	}
+}
+
+// Acquire selector for target, nil receiver does nothing, so callers do not check cache is enabled
+func (pc *PodCache) Acquire(ps *PodSelector) {
+	if pc == nil {
+		return
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	key := newPodCacheKey(ps)
+	pi, ok := pc.informers[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(pc.ctx)
+		pi = &podInformer{ctx: ctx, cancel: cancel}
+		pc.informers[key] = pi
+	}
+	pi.refs++
+}
+
+// Release selector of removed target, informer is stopped, when selector is not used by other targets
+func (pc *PodCache) Release(ps *PodSelector) {
+	if pc == nil {
+		return
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	key := newPodCacheKey(ps)
+	pi, ok := pc.informers[key]
+	if !ok {
+		return
+	}
+
+	pi.refs--
+	if pi.refs > 0 {
+		return
+	}
+
+	pi.cancel()
+	delete(pc.informers, key)
+	if pi.informer != nil {
+		klog.Infof("[PodCache] Informer of %s in %s namespace is stopped", ps.selectorString(), ps.Namespace)
+	}
+}
+
+// List pods of selector from cache, error is returned, when selector is not acquired or informer is not synced in time
+func (pc *PodCache) List(ctx context.Context, ps *PodSelector) ([]v1.Pod, error) {
+	pi := pc.informer(ps)
+	if pi == nil {
+		return nil, fmt.Errorf("Pod cache of %s in %s namespace is not acquired", ps.selectorString(), ps.Namespace)
+	}
+
+	// Waiting is stopped too, when informer is stopped by release of selector
+	syncCtx, cancel := context.WithTimeout(ctx, podCacheSyncTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-pi.ctx.Done():
+			cancel()
+		case <-syncCtx.Done():
+		}
+	}()
+	if !cache.WaitForCacheSync(syncCtx.Done(), pi.informer.HasSynced) {
+		return nil, fmt.Errorf("Pod cache of %s in %s namespace is not synced", ps.selectorString(), ps.Namespace)
+	}
+
+	// Informer watches only pods of selector
+	cached, err := pi.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]v1.Pod, 0, len(cached))
+	for _, pod := range cached {
+		pods = append(pods, *pod)
+	}
+
+	return pods, nil
+}
+
+// Private method for get informer of acquired selector, it is started on first call, nil when selector is not acquired
+func (pc *PodCache) informer(ps *PodSelector) *podInformer {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pi, ok := pc.informers[newPodCacheKey(ps)]
+	if !ok {
+		return nil
+	}
+	if pi.informer != nil {
+		return pi
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(pc.client, 0,
+		informers.WithNamespace(ps.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = ps.LabelSelector
+			options.FieldSelector = ps.FieldSelector
+		}))
+	pods := factory.Core().V1().Pods()
+
+	pi.informer = pods.Informer()
+	pi.lister = pods.Lister().Pods(ps.Namespace)
+	pi.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			logPodChanges(oldObj.(*v1.Pod), newObj.(*v1.Pod))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if pod, ok := obj.(*v1.Pod); ok {
+				klog.Infof("[PodCache] Pod %s/%s is deleted", pod.Namespace, pod.Name)
+			}
+		},
+	})
+	factory.Start(pi.ctx.Done())
+
+	return pi
+}
+
+// Private func for make key of informer from selector
+func newPodCacheKey(ps *PodSelector) podCacheKey {
+	return podCacheKey{
+		namespace:     ps.Namespace,
+		labelSelector: ps.LabelSelector,
+		fieldSelector: ps.FieldSelector,
+	}
+}
+
+// Private func for log changes of pod between runs: rescheduling, phase, readiness and restarts of containers
+func logPodChanges(oldPod *v1.Pod, newPod *v1.Pod) {
+	name := newPod.Namespace + "/" + newPod.Name
+
+	if oldPod.Spec.NodeName != newPod.Spec.NodeName {
+		klog.Infof("[PodCache] Pod %s is scheduled to node %s", name, newPod.Spec.NodeName)
+	}
+	if oldPod.Status.Phase != newPod.Status.Phase {
+		klog.Infof("[PodCache] Pod %s phase: %s -> %s", name, oldPod.Status.Phase, newPod.Status.Phase)
+	}
+
+	oldStatuses := make(map[string]v1.ContainerStatus, len(oldPod.Status.ContainerStatuses))
+	for _, status := range oldPod.Status.ContainerStatuses {
+		oldStatuses[status.Name] = status
+	}
+	for _, status := range newPod.Status.ContainerStatuses {
+		oldStatus, ok := oldStatuses[status.Name]
+		if !ok {
+			continue
+		}
+		if status.RestartCount > oldStatus.RestartCount {
+			klog.Warnf("[PodCache] Pod %s: container %s is restarted, restarts: %d", name, status.Name, status.RestartCount)
+		}
+		if status.Ready != oldStatus.Ready {
+			klog.Infof("[PodCache] Pod %s: container %s ready: %t", name, status.Name, status.Ready)
+		}
+	}
+}
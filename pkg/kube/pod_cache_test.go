@@ -0,0 +1,47 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodCacheRelease(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "db", Labels: map[string]string{"app": "db"}},
+	})
+	pc := NewPodCache(ctx, client)
+	ps := &PodSelector{Namespace: "db", LabelSelector: "app=db"}
+
+	if _, err := pc.List(ctx, ps); err == nil {
+		t.Fatalf("List() of not acquired selector error = nil, want error")
+	}
+
+	// Two targets with same selector share informer
+	pc.Acquire(ps)
+	pc.Acquire(ps)
+	pods, err := pc.List(ctx, ps)
+	if err != nil || len(pods) != 1 {
+		t.Fatalf("List() = %d pods, %v, want 1 pod", len(pods), err)
+	}
+	pi := pc.informer(ps)
+
+	pc.Release(ps)
+	if pi.ctx.Err() != nil {
+		t.Fatalf("informer is stopped, while selector is used by second target")
+	}
+
+	pc.Release(ps)
+	if pi.ctx.Err() == nil {
+		t.Errorf("informer is not stopped, after last target is removed")
+	}
+	if pc.informer(ps) != nil {
+		t.Errorf("informer of released selector is kept")
+	}
+}
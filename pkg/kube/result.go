@@ -0,0 +1,87 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+var (
+	// Pod by selector is not found, command was not started
+	ErrPodNotFound = errors.New("pod not found")
+	// Pods by selector are found, but no one is running with ready container, command was not started
+	ErrPodNotReady = errors.New("no ready pod")
+	// Container by name is not found in pod, command was not started
+	ErrContainerNotFound = errors.New("container not found")
+)
+
+// Exit code of command, which was not started or stream was broken before exit
+const UnknownExitCode = -1
+
+// ExecResult - details of command, which executed in pod container
+type ExecResult struct {
+	Pod         string
+	Container   string
+	ExitCode    int
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	StdoutBytes int64
+	StderrBytes int64
+}
+
+// Duration of command execution
+func (er *ExecResult) Duration() time.Duration {
+	if er.StartedAt.IsZero() || er.FinishedAt.IsZero() {
+		return 0
+	}
+
+	return er.FinishedAt.Sub(er.StartedAt)
+}
+
+// Command is finished with exit code, success or not
+func (er *ExecResult) Exited() bool {
+	return er.ExitCode != UnknownExitCode
+}
+
+func (er *ExecResult) String() string {
+	return fmt.Sprintf("pod %s, container %s, exit code %d, duration %s, stdout %d bytes, stderr %d bytes",
+		er.Pod, er.Container, er.ExitCode, er.Duration().Round(time.Second), er.StdoutBytes, er.StderrBytes)
+}
+
+// Get exit code from remotecommand error, UnknownExitCode when error is not exit error
+func exitCodeFromError(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return exitErr.ExitStatus()
+	}
+
+	return UnknownExitCode
+}
+
+// Writer, which counts written bytes
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func newCountingWriter(writer io.Writer) *countingWriter {
+	if writer == nil {
+		writer = io.Discard
+	}
+
+	return &countingWriter{writer: writer}
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.writer.Write(p)
+	cw.count += int64(n)
+
+	return n, err
+}
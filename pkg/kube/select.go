@@ -0,0 +1,187 @@
+package kube
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Policies of pod selection by role label
+const (
+	RolePolicyAny           = "any"            // Role is not checked
+	RolePolicyPreferReplica = "prefer-replica" // Replica, fallback to leader when no ready replica
+	RolePolicyRequireLeader = "require-leader" // Leader only, no fallback
+)
+
+// Pod, which is not used for exec, and reason why
+type SkippedPod struct {
+	Name   string
+	Reason string
+}
+
+// Private func for select pod for exec: Running, not terminating, with Ready target container
+// When some pods are suitable, oldest pod is selected, then by name, so selection is deterministic
+func selectReadyPod(pods []v1.Pod, containerName string) (*v1.Pod, []SkippedPod) {
+	var candidates []*v1.Pod
+	var skipped []SkippedPod
+
+	for i := range pods {
+		pod := &pods[i]
+
+		if reason := podNotReadyReason(pod, containerName); reason != "" {
+			skipped = append(skipped, SkippedPod{Name: pod.Name, Reason: reason})
+
+			continue
+		}
+		candidates = append(candidates, pod)
+	}
+
+	if len(candidates) < 1 {
+		return nil, skipped
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+
+		return a.Name < b.Name
+	})
+
+	return candidates[0], skipped
+}
+
+// Private func for select ready pod by role policy of selector
+// Returns note, when preferred role is unavailable and pod of other role is selected
+func selectPodByRole(pods []v1.Pod, ps *PodSelector) (*v1.Pod, string, []SkippedPod) {
+	if ps.RoleLabel == "" || ps.RolePolicy == "" || ps.RolePolicy == RolePolicyAny {
+		pod, skipped := selectReadyPod(pods, ps.ContainerName)
+
+		return pod, "", skipped
+	}
+
+	var leaders, replicas []v1.Pod
+	var skipped []SkippedPod
+
+	// Split pods by role, pods with unknown role are not used
+	for _, pod := range pods {
+		role := pod.Labels[ps.RoleLabel]
+
+		switch {
+		case containsString(ps.LeaderValues, role):
+			leaders = append(leaders, pod)
+		case containsString(ps.ReplicaValues, role):
+			replicas = append(replicas, pod)
+		default:
+			skipped = append(skipped, SkippedPod{Name: pod.Name, Reason: fmt.Sprintf("role %q is unknown", role)})
+		}
+	}
+
+	if ps.RolePolicy == RolePolicyRequireLeader {
+		for _, pod := range replicas {
+			skipped = append(skipped, SkippedPod{Name: pod.Name, Reason: "replica, leader is required"})
+		}
+
+		leader, skippedLeaders := selectReadyPod(leaders, ps.ContainerName)
+
+		return leader, "", append(skipped, skippedLeaders...)
+	}
+
+	// RolePolicyPreferReplica
+	replica, skippedReplicas := selectReadyPod(replicas, ps.ContainerName)
+	skipped = append(skipped, skippedReplicas...)
+	if replica != nil {
+		return replica, "", skipped
+	}
+
+	leader, skippedLeaders := selectReadyPod(leaders, ps.ContainerName)
+	skipped = append(skipped, skippedLeaders...)
+	if leader == nil {
+		return nil, "", skipped
+	}
+
+	note := "no replica pods, fallback to leader"
+	if len(skippedReplicas) > 0 {
+		note = fmt.Sprintf("no ready replica (%s), fallback to leader", formatSkippedPods(skippedReplicas))
+	}
+
+	return leader, note, skipped
+}
+
+// Private func for check string is in list
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Private func for get reason, why pod is not suitable for exec, empty string when pod is suitable
+func podNotReadyReason(pod *v1.Pod, containerName string) string {
+	if pod.DeletionTimestamp != nil {
+		return "terminating"
+	}
+	if pod.Status.Phase != v1.PodRunning {
+		return fmt.Sprintf("phase %s", pod.Status.Phase)
+	}
+	if !hasContainer(pod, containerName) {
+		return fmt.Sprintf("container %s not found", containerName)
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != containerName {
+			continue
+		}
+		if status.Ready {
+			return ""
+		}
+
+		reason := fmt.Sprintf("container %s is not ready", containerName)
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			reason += fmt.Sprintf(" (%s)", status.State.Waiting.Reason)
+		}
+
+		return reason
+	}
+
+	return fmt.Sprintf("container %s has no status", containerName)
+}
+
+// Private func for check container is declared in spec of pod
+func hasContainer(pod *v1.Pod, containerName string) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Private func for check container is declared in none of pods, for example by misspelled name
+// Such selection fails by missing container, not by readiness, so it is not retried
+func containerMissing(pods []v1.Pod, containerName string) bool {
+	for i := range pods {
+		if hasContainer(&pods[i], containerName) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Help func for join skipped pods to one line for error message
+func formatSkippedPods(skipped []SkippedPod) string {
+	reasons := make([]string, 0, len(skipped))
+	for _, pod := range skipped {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", pod.Name, pod.Reason))
+	}
+
+	return strings.Join(reasons, "; ")
+}
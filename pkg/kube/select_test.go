@@ -0,0 +1,231 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSelectReadyPod(t *testing.T) {
+	created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newPod := func(name string, age time.Duration, phase v1.PodPhase, ready bool) v1.Pod {
+		return v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created.Add(-age)),
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "postgres"}},
+			},
+			Status: v1.PodStatus{
+				Phase: phase,
+				ContainerStatuses: []v1.ContainerStatus{
+					{Name: "postgres", Ready: ready},
+				},
+			},
+		}
+	}
+
+	terminating := newPod("db-terminating", 3*time.Hour, v1.PodRunning, true)
+	terminating.DeletionTimestamp = &metav1.Time{Time: created}
+
+	sidecarOnly := newPod("db-sidecar", 3*time.Hour, v1.PodRunning, true)
+	sidecarOnly.Spec.Containers[0].Name = "exporter"
+	sidecarOnly.Status.ContainerStatuses[0].Name = "exporter"
+
+	crashLooping := newPod("db-crash", 3*time.Hour, v1.PodRunning, false)
+	crashLooping.Status.ContainerStatuses[0].State.Waiting = &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}
+
+	tests := []struct {
+		name        string
+		pods        []v1.Pod
+		wantPod     string
+		wantSkipped []SkippedPod
+	}{
+		{
+			name: "test oldest ready pod is selected",
+			pods: []v1.Pod{
+				newPod("db-b", time.Hour, v1.PodRunning, true),
+				newPod("db-a", 2*time.Hour, v1.PodRunning, true),
+			},
+			wantPod: "db-a",
+		},
+		{
+			name: "test pods with same age are selected by name",
+			pods: []v1.Pod{
+				newPod("db-b", time.Hour, v1.PodRunning, true),
+				newPod("db-a", time.Hour, v1.PodRunning, true),
+			},
+			wantPod: "db-a",
+		},
+		{
+			name: "test not suitable pods are skipped with reasons",
+			pods: []v1.Pod{
+				terminating,
+				sidecarOnly,
+				crashLooping,
+				newPod("db-pending", 3*time.Hour, v1.PodPending, false),
+				newPod("db-ready", time.Hour, v1.PodRunning, true),
+			},
+			wantPod: "db-ready",
+			wantSkipped: []SkippedPod{
+				{Name: "db-terminating", Reason: "terminating"},
+				{Name: "db-sidecar", Reason: "container postgres not found"},
+				{Name: "db-crash", Reason: "container postgres is not ready (CrashLoopBackOff)"},
+				{Name: "db-pending", Reason: "phase Pending"},
+			},
+		},
+		{
+			name: "test no suitable pods",
+			pods: []v1.Pod{
+				newPod("db-pending", time.Hour, v1.PodPending, false),
+			},
+			wantPod: "",
+			wantSkipped: []SkippedPod{
+				{Name: "db-pending", Reason: "phase Pending"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod, skipped := selectReadyPod(tt.pods, "postgres")
+
+			gotPod := ""
+			if pod != nil {
+				gotPod = pod.Name
+			}
+			if gotPod != tt.wantPod {
+				t.Errorf("selectReadyPod() \npod = %v\nwant %v", gotPod, tt.wantPod)
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+				t.Errorf("selectReadyPod() \nskipped = %v\nwant %v", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestSelectPodByRole(t *testing.T) {
+	newPod := func(name string, role string, ready bool) v1.Pod {
+		return v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{"spilo-role": role},
+			},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "postgres"}},
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodRunning,
+				ContainerStatuses: []v1.ContainerStatus{
+					{Name: "postgres", Ready: ready},
+				},
+			},
+		}
+	}
+
+	selector := func(policy string) *PodSelector {
+		return &PodSelector{
+			ContainerName: "postgres",
+			RoleLabel:     "spilo-role",
+			RolePolicy:    policy,
+			LeaderValues:  []string{"master"},
+			ReplicaValues: []string{"replica"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		pods     []v1.Pod
+		selector *PodSelector
+		wantPod  string
+		wantNote string
+	}{
+		{
+			name:     "test prefer replica selects replica",
+			pods:     []v1.Pod{newPod("db-0", "master", true), newPod("db-1", "replica", true)},
+			selector: selector(RolePolicyPreferReplica),
+			wantPod:  "db-1",
+		},
+		{
+			name:     "test prefer replica falls back to leader, when replica is not ready",
+			pods:     []v1.Pod{newPod("db-0", "master", true), newPod("db-1", "replica", false)},
+			selector: selector(RolePolicyPreferReplica),
+			wantPod:  "db-0",
+			wantNote: "no ready replica (db-1: container postgres is not ready), fallback to leader",
+		},
+		{
+			name:     "test prefer replica falls back to leader, when no replica pods",
+			pods:     []v1.Pod{newPod("db-0", "master", true)},
+			selector: selector(RolePolicyPreferReplica),
+			wantPod:  "db-0",
+			wantNote: "no replica pods, fallback to leader",
+		},
+		{
+			name:     "test require leader selects leader",
+			pods:     []v1.Pod{newPod("db-0", "replica", true), newPod("db-1", "master", true)},
+			selector: selector(RolePolicyRequireLeader),
+			wantPod:  "db-1",
+		},
+		{
+			name:     "test require leader without ready leader",
+			pods:     []v1.Pod{newPod("db-0", "replica", true), newPod("db-1", "master", false)},
+			selector: selector(RolePolicyRequireLeader),
+			wantPod:  "",
+		},
+		{
+			name:     "test any policy ignores role",
+			pods:     []v1.Pod{newPod("db-0", "", true)},
+			selector: selector(RolePolicyAny),
+			wantPod:  "db-0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod, note, _ := selectPodByRole(tt.pods, tt.selector)
+
+			gotPod := ""
+			if pod != nil {
+				gotPod = pod.Name
+			}
+			if gotPod != tt.wantPod {
+				t.Errorf("selectPodByRole() \npod = %v\nwant %v", gotPod, tt.wantPod)
+			}
+			if note != tt.wantNote {
+				t.Errorf("selectPodByRole() \nnote = %v\nwant %v", note, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestFindPodByLabelsContainerNotFound(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-0", Namespace: "db", Labels: map[string]string{"app": "db"}},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "postgres"}},
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "postgres", Ready: true},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(pod)
+
+	// Misspelled container is not a readiness problem of pod
+	ps := &PodSelector{Namespace: "db", LabelSelector: "app=db", ContainerName: "postgre"}
+
+	_, _, err := findPodByLabels(context.Background(), client, nil, ps)
+	if !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("findPodByLabels() error = %v, want %v", err, ErrContainerNotFound)
+	}
+}
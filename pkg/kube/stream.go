@@ -0,0 +1,59 @@
+package kube
+
+import (
+	"context"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// remotecommand.Executor in this client-go version has no context support,
+// so request and upgraded connection are bound to context by wrappers of transports
+func newContextSPDYExecutor(ctx context.Context, config *rest.Config, req *rest.Request) (remotecommand.Executor, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return remotecommand.NewSPDYExecutorForTransports(
+		&contextRoundTripper{ctx: ctx, next: transport},
+		&contextUpgrader{ctx: ctx, next: upgrader},
+		"POST", req.URL(),
+	)
+}
+
+// Round tripper, which sends request with context, for cancel connecting to api server
+type contextRoundTripper struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (rt *contextRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.next.RoundTrip(req.WithContext(rt.ctx))
+}
+
+// Upgrader, which closes upgraded stream connection when context is done
+type contextUpgrader struct {
+	ctx  context.Context
+	next spdy.Upgrader
+}
+
+func (u *contextUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.next.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-u.ctx.Done():
+			conn.Close()
+		case <-conn.CloseChan():
+		}
+	}()
+
+	return conn, nil
+}